@@ -2,18 +2,24 @@ package client
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
+	"sync"
 	"testing"
 	"github.com/jaybennett89/thorium-go/model"
 	"github.com/jaybennett89/thorium-go/requests"
 	"time"
+
+	_ "github.com/lib/pq"
 )
 
 var masterEndpoint = "localhost:6960"
+var databaseSource = "port=5432 host=db user=postgres password=secret dbname=postgres sslmode=disable"
 var sessionKey string
 var characterIds []int
 var gameList []model.Game
@@ -356,6 +362,75 @@ func Test4C_ConnectToGame(t *testing.T) {
 	fmt.Println("Test 4C: Pass")
 }
 
+// Test 4D: Friend Presence
+// the character selected in 3B shows in a friend's list, in the game it
+// connected to in 4C, and the friend can join it
+func Test4D_FriendPresence(t *testing.T) {
+
+	fmt.Println("Test4D: Friend Presence")
+
+	ctx := context.Background()
+
+	friend := NewMaster(masterEndpoint, nil, 5*time.Second, DefaultRetryPolicy)
+	friendName := fmt.Sprintf("friend%d", rand.Intn(1000000))
+	_, err := friend.Register(ctx, friendName, password)
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+
+	err = friend.RequestFriend(ctx, user)
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+
+	me := NewMaster(masterEndpoint, nil, 5*time.Second, DefaultRetryPolicy)
+	me.SetSessionKey(sessionKey)
+
+	friends, err := me.GetFriends(ctx)
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+
+	for _, f := range friends {
+		if f.Username == friendName {
+			err = me.AcceptFriend(ctx, f.UserId)
+			if err != nil {
+				log.Print(err)
+				t.FailNow()
+			}
+		}
+	}
+
+	friends, err = friend.GetFriends(ctx)
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+
+	var mine *model.Friend
+	for i := range friends {
+		if friends[i].Username == user {
+			mine = &friends[i]
+		}
+	}
+
+	if mine == nil || mine.Presence != model.PresenceInGame || mine.CharacterId != characterIds[0] || mine.GameId != gameId {
+		log.Printf("unexpected presence %+v", mine)
+		t.FailNow()
+	}
+
+	_, err = friend.JoinFriend(ctx, mine.UserId)
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+
+	fmt.Println("Test 4D: Pass")
+}
+
 type Move struct {
 	SessionKey string        `json:"sessionKey"`
 	MoveDir    model.Vector3 `json:"movedir"`
@@ -446,3 +521,212 @@ func Test5B_PlayerDisconnect(t *testing.T) {
 
 	fmt.Println("Test 5B: Pass")
 }
+
+// Test 6A: Parallel Trades
+// two characters propose, accept, cancel and cross-trade the same stacks
+// at once. Every step either succeeds or is refused with 409, and no item
+// is created or lost on the way.
+func Test6A_ParallelTrades(t *testing.T) {
+
+	fmt.Println("Test 6A: Parallel Trades")
+
+	ctx := context.Background()
+
+	db, err := sql.Open("postgres", databaseSource)
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+	defer db.Close()
+
+	// a single attempt, so a failed step isn't hidden by a retry
+	policy := RetryPolicy{MaxAttempts: 1}
+
+	masters := make([]*Master, 2)
+	ids := make([]int, 2)
+	for i := range masters {
+
+		masters[i] = NewMaster(masterEndpoint, nil, 10*time.Second, policy)
+		name := fmt.Sprintf("trader%d", rand.Intn(1000000))
+		_, err = masters[i].Register(ctx, name, password)
+		if err != nil {
+			log.Print(err)
+			t.FailNow()
+		}
+
+		resp, err := masters[i].CreateCharacter(ctx, name, 1)
+		if err != nil {
+			log.Print(err)
+			t.FailNow()
+		}
+
+		ids[i] = resp.CharacterId
+	}
+
+	// trades need both characters in a game, and there is no client call
+	// that grants items, so both are set up in the database
+	var tradeGameId int
+	err = db.QueryRow("INSERT INTO games (map_name, game_mode) VALUES ('mp_sandbox', 'Tutorial') RETURNING game_id").Scan(&tradeGameId)
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+	defer db.Exec("DELETE FROM games WHERE game_id = $1", tradeGameId)
+
+	seed := []model.Item{{ItemId: 5, Stacks: 100}, {ItemId: 5, Stacks: 100}, {ItemId: 1, Stacks: 20}}
+	seedBytes, err := json.Marshal(seed)
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+
+	for _, id := range ids {
+
+		_, err = db.Exec("INSERT INTO game_players (character_id, game_id, joined_on) VALUES ($1, $2, $3)", id, tradeGameId, time.Now())
+		if err != nil {
+			log.Print(err)
+			t.FailNow()
+		}
+
+		_, err = db.Exec("UPDATE characters SET inventory = $1 WHERE id = $2", string(seedBytes), id)
+		if err != nil {
+			log.Print(err)
+			t.FailNow()
+		}
+	}
+
+	before, err := tradeTotals(db, ids)
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+
+	// refused steps are expected while the trades race, anything else is not
+	var mu sync.Mutex
+	var failures []error
+	check := func(err error) {
+
+		if err == nil {
+			return
+		}
+
+		statusErr, ok := err.(*StatusError)
+		if ok && statusErr.StatusCode == 409 {
+			return
+		}
+
+		mu.Lock()
+		failures = append(failures, err)
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+
+		wg.Add(1)
+		go func(worker int) {
+
+			defer wg.Done()
+			for round := 0; round < 10; round++ {
+
+				// alternate the direction so trades cross each other
+				from, to := worker%2, (worker+1)%2
+				offer := []model.Item{{ItemId: 5, Stacks: 30 + round}}
+				want := []model.Item{{ItemId: 1, Stacks: 1 + round%3}}
+				if round%2 == 1 {
+					want = []model.Item{{ItemId: 5, Stacks: 20}}
+				}
+
+				trade, err := masters[from].ProposeTrade(ctx, ids[from], ids[to], offer, want)
+				check(err)
+				if err != nil {
+					continue
+				}
+
+				// the recipient accepts while the proposer cancels, only one wins
+				var step sync.WaitGroup
+				step.Add(2)
+				go func() {
+					defer step.Done()
+					_, err := masters[to].AcceptTrade(ctx, trade.TradeId, ids[to])
+					check(err)
+				}()
+				go func() {
+					defer step.Done()
+					_, err := masters[from].CancelTrade(ctx, trade.TradeId, ids[from])
+					check(err)
+				}()
+				step.Wait()
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	for _, err := range failures {
+		log.Print(err)
+	}
+
+	if len(failures) > 0 {
+		t.FailNow()
+	}
+
+	var pending int
+	err = db.QueryRow("SELECT COUNT(*) FROM trades WHERE status = $1 AND (from_character_id = ANY($2::int[]) OR to_character_id = ANY($2::int[]))",
+		model.TradePending, fmt.Sprintf("{%d,%d}", ids[0], ids[1])).Scan(&pending)
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+
+	if pending != 0 {
+		log.Printf("%d trades are still pending", pending)
+		t.FailNow()
+	}
+
+	after, err := tradeTotals(db, ids)
+	if err != nil {
+		log.Print(err)
+		t.FailNow()
+	}
+
+	for itemId, count := range before {
+		if after[itemId] != count {
+			log.Printf("item %d: %d stacks before, %d after", itemId, count, after[itemId])
+			t.Fail()
+		}
+	}
+
+	if len(after) != len(before) {
+		log.Printf("items before %v, after %v", before, after)
+		t.Fail()
+	}
+
+	fmt.Println("Test 6A: Pass")
+}
+
+// tradeTotals sums the stacks of each item across the ledgers of the
+// given characters.
+func tradeTotals(db *sql.DB, ids []int) (map[int]int, error) {
+
+	totals := make(map[int]int)
+	for _, id := range ids {
+
+		var ledger string
+		err := db.QueryRow("SELECT inventory FROM characters WHERE id = $1", id).Scan(&ledger)
+		if err != nil {
+			return nil, err
+		}
+
+		var items []model.Item
+		err = json.Unmarshal([]byte(ledger), &items)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			totals[item.ItemId] += item.Stacks
+		}
+	}
+
+	return totals, nil
+}
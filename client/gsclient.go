@@ -1,16 +1,14 @@
 package client
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+
 	"github.com/jaybennett89/thorium-go/model"
 	"github.com/jaybennett89/thorium-go/requests"
 )
 
 // this package contains game server requests
+// new gameservers should use the gameserver package or a Host instead
 
 func PlayerConnect(serviceEndpoint string, gameId int, machineKey string, sessionKey string, characterId int) (statusCode int, body string, err error) {
 
@@ -20,28 +18,7 @@ func PlayerConnect(serviceEndpoint string, gameId int, machineKey string, sessio
 		SessionKey:  sessionKey,
 		CharacterId: characterId}
 
-	json, err := json.Marshal(&data)
-	if err != nil {
-
-		return
-	}
-
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/games/player_connect", serviceEndpoint), bytes.NewBuffer(json))
-	if err != nil {
-
-		return
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-
-		return
-	}
-
-	defer resp.Body.Close()
-	bodyBytes, _ := ioutil.ReadAll(resp.Body)
-	return resp.StatusCode, string(bodyBytes), nil
+	return newDefaultTransport(serviceEndpoint).raw("POST", "/games/player_connect", &data)
 }
 
 func UpdateCharacter(serviceEndpoint string, machineKey string, character *model.Character) (statusCode int, body string, err error) {
@@ -50,28 +27,7 @@ func UpdateCharacter(serviceEndpoint string, machineKey string, character *model
 		MachineKey: machineKey,
 		Snapshot:   character}
 
-	json, err := json.Marshal(&data)
-	if err != nil {
-
-		return
-	}
-
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/characters", serviceEndpoint), bytes.NewBuffer(json))
-	if err != nil {
-
-		return
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-
-		return
-	}
-
-	defer resp.Body.Close()
-	bodyBytes, _ := ioutil.ReadAll(resp.Body)
-	return resp.StatusCode, string(bodyBytes), nil
+	return newDefaultTransport(serviceEndpoint).raw("POST", "/characters", &data)
 }
 
 func PlayerDisconnect(serviceEndpoint string, machineKey string, gameId int, character *model.Character) (statusCode int, body string, err error) {
@@ -81,26 +37,30 @@ func PlayerDisconnect(serviceEndpoint string, machineKey string, gameId int, cha
 		GameId:     gameId,
 		Snapshot:   character}
 
-	json, err := json.Marshal(&data)
-	if err != nil {
+	return newDefaultTransport(serviceEndpoint).raw("POST", "/games/player_disconnect", &data)
+}
 
-		return
-	}
+func ReportGameStatus(serviceEndpoint string, machineKey string, gameId int, status *model.GameServerStatus) (statusCode int, body string, err error) {
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/games/player_disconnect", serviceEndpoint), bytes.NewBuffer(json))
-	if err != nil {
+	data := request.GameServerStatus{
+		MachineKey: machineKey,
+		GameId:     gameId,
+		Status:     *status}
 
-		return
-	}
+	return newDefaultTransport(serviceEndpoint).raw("POST", "/games/server_status", &data)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+func ReportMatchResult(serviceEndpoint string, result *request.MatchResult) (statusCode int, body string, err error) {
+
+	return newDefaultTransport(serviceEndpoint).raw("POST", "/games/match_result", result)
+}
+
+func InventoryOperation(serviceEndpoint string, characterId int, action string, op *request.InventoryOperation) (statusCode int, body string, err error) {
+
+	return newDefaultTransport(serviceEndpoint).raw("POST", fmt.Sprintf("/characters/%d/inventory/%s", characterId, action), op)
+}
 
-		return
-	}
+func GetInventory(serviceEndpoint string, characterId int, data *request.GetInventory) (statusCode int, body string, err error) {
 
-	defer resp.Body.Close()
-	bodyBytes, _ := ioutil.ReadAll(resp.Body)
-	return resp.StatusCode, string(bodyBytes), nil
+	return newDefaultTransport(serviceEndpoint).raw("GET", fmt.Sprintf("/characters/%d/inventory", characterId), data)
 }
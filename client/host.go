@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/generate"
+	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/requests"
+)
+
+// Host is a typed client for the local API that a host-server exposes to
+// the gameservers it launched. Every call is made on behalf of one game.
+type Host struct {
+	*transport
+
+	mu     sync.RWMutex
+	token  string
+	gameId int
+}
+
+// MachineKeyHeader carries the host's machine key on the master's
+// requests to the host. It never reaches gameservers.
+const MachineKeyHeader = "X-Machine-Key"
+
+// GameTokenHeader carries a gameserver's game token on its requests to
+// the host, and the host's replacement token on the responses.
+const GameTokenHeader = "X-Game-Token"
+
+// GameTokenEnv is the environment variable a launched gameserver finds
+// its first game token in.
+const GameTokenEnv = "THORIUM_GAME_TOKEN"
+
+// NewHost creates a host client for the game gameId. endpoint is the
+// host-server's local API, "127.0.0.1:<service port>", and token the
+// game token the gameserver was launched with.
+func NewHost(endpoint string, token string, gameId int, httpClient *http.Client, timeout time.Duration, retry RetryPolicy) *Host {
+
+	h := &Host{
+		transport: newTransport(endpoint, httpClient, timeout, retry),
+		token:     token,
+		gameId:    gameId,
+	}
+
+	h.onRequest = func(req *http.Request) {
+		req.Header.Set(GameTokenHeader, h.Token())
+	}
+
+	h.onResponse = func(resp *http.Response) {
+		token := resp.Header.Get(GameTokenHeader)
+		if token != "" {
+			h.mu.Lock()
+			h.token = token
+			h.mu.Unlock()
+		}
+	}
+
+	return h
+}
+
+// Token is the game token the host client authenticates with. It changes
+// when the host hands out a new one.
+func (h *Host) Token() string {
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.token
+}
+
+func (h *Host) RegisterServer(ctx context.Context, listenPort int) error {
+
+	data := request.RegisterGameServer{
+		GameId: h.gameId,
+		Port:   listenPort}
+
+	_, err := h.call(ctx, "POST", "/games/register_server", &data, 200, nil)
+	return err
+}
+
+func (h *Host) UnregisterServer(ctx context.Context) error {
+
+	data := request.UnregisterGameServer{
+		GameId: h.gameId}
+
+	_, err := h.call(ctx, "POST", "/games/unregister_server", &data, 200, nil)
+	return err
+}
+
+// ReportStatus sends the latest status of the game's match.
+func (h *Host) ReportStatus(ctx context.Context, status *model.GameServerStatus) error {
+
+	data := request.GameServerStatus{
+		GameId: h.gameId,
+		Status: *status}
+
+	_, err := h.call(ctx, "POST", "/games/server_status", &data, 200, nil)
+	return err
+}
+
+// ReportMatchResult archives a finished match and returns its match id.
+func (h *Host) ReportMatchResult(ctx context.Context, result *request.MatchResult) (int, error) {
+
+	result.GameId = h.gameId
+
+	var resp request.MatchResultResponse
+	_, err := h.call(ctx, "POST", "/games/match_result", result, 200, &resp)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.MatchId, nil
+}
+
+// ChangeInventory applies an inventory action, one of grant, consume, move
+// or drop, and returns the character's new inventory and ledger version.
+func (h *Host) ChangeInventory(ctx context.Context, characterId int, action string, op *request.InventoryOperation) ([]model.Item, int, error) {
+
+	var resp request.InventoryResponse
+	_, err := h.call(ctx, "POST", fmt.Sprintf("/characters/%d/inventory/%s", characterId, action), op, 200, &resp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return resp.Inventory, resp.Version, nil
+}
+
+// GetInventory reads a character's inventory and ledger version from the
+// master, after it changed outside the game.
+func (h *Host) GetInventory(ctx context.Context, characterId int) ([]model.Item, int, error) {
+
+	var resp request.InventoryResponse
+	_, err := h.call(ctx, "GET", fmt.Sprintf("/characters/%d/inventory", characterId), nil, 200, &resp)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return resp.Inventory, resp.Version, nil
+}
+
+// GetRegion returns the world region at coord.
+func (h *Host) GetRegion(ctx context.Context, coord generate.Coordinate2D) (*generate.Region, error) {
+
+	var region generate.Region
+	_, err := h.call(ctx, "GET", fmt.Sprintf("/world/regions/%d/%d", coord.X, coord.Y), nil, 200, &region)
+	if err != nil {
+		return nil, err
+	}
+
+	region.Link()
+	return &region, nil
+}
+
+func (h *Host) PlayerConnect(ctx context.Context, sessionKey string, characterId int) (*model.Character, error) {
+
+	data := request.PlayerConnect{
+		GameId:      h.gameId,
+		SessionKey:  sessionKey,
+		CharacterId: characterId}
+
+	var resp request.PlayerConnectResponse
+	_, err := h.call(ctx, "POST", "/games/player_connect", &data, 200, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Character, nil
+}
+
+func (h *Host) UpdateCharacter(ctx context.Context, character *model.Character) error {
+
+	data := request.UpdateCharacter{
+		Snapshot: character}
+
+	_, err := h.call(ctx, "POST", "/characters", &data, 200, nil)
+	return err
+}
+
+func (h *Host) PlayerDisconnect(ctx context.Context, character *model.Character) error {
+
+	data := request.PlayerDisconnect{
+		GameId:   h.gameId,
+		Snapshot: character}
+
+	_, err := h.call(ctx, "POST", "/games/player_disconnect", &data, 200, nil)
+	return err
+}
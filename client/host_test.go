@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+func TestHost_TakesNewToken(t *testing.T) {
+
+	var tokens []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(GameTokenHeader)
+		tokens = append(tokens, token)
+		if token == "old" {
+			w.Header().Set(GameTokenHeader, "new")
+		}
+	}))
+	defer server.Close()
+
+	h := NewHost(server.URL, "old", 3, nil, time.Second, DefaultRetryPolicy)
+	status := model.GameServerStatus{Phase: model.MatchWarmup}
+
+	for i := 0; i < 2; i++ {
+		err := h.ReportStatus(context.Background(), &status)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(tokens) != 2 || tokens[0] != "old" || tokens[1] != "new" || h.Token() != "new" {
+		t.Fatalf("sent tokens %v, host token %q", tokens, h.Token())
+	}
+}
+
+func TestGetHostGames_SendsMachineKey(t *testing.T) {
+
+	var key string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.Header.Get(MachineKeyHeader)
+		w.Write([]byte(`{"games":[]}`))
+	}))
+	defer server.Close()
+
+	rc, body, err := GetHostGames(server.URL, "machine-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rc != 200 || body != `{"games":[]}` || key != "machine-key" {
+		t.Fatalf("got %d %q, sent key %q", rc, body, key)
+	}
+}
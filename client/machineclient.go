@@ -10,17 +10,9 @@ import (
 	"github.com/jaybennett89/thorium-go/requests"
 )
 
-func NewGameServer(endpoint string, gameId int, mapName string, mode string, minLevel int, maxPlayers int) (int, string, error) {
-
-	data := request.NewGameServer{
-		GameId:         gameId,
-		Map:            mapName,
-		Mode:           mode,
-		MinimumLevel:   minLevel,
-		MaximumPlayers: maxPlayers,
-	}
+func NewGameServer(endpoint string, data *request.NewGameServer) (int, string, error) {
 
-	jsonBytes, err := json.Marshal(&data)
+	jsonBytes, err := json.Marshal(data)
 	if err != nil {
 		return 0, "", err
 	}
@@ -35,3 +27,32 @@ func NewGameServer(endpoint string, gameId int, mapName string, mode string, min
 	body, _ := ioutil.ReadAll(resp.Body)
 	return resp.StatusCode, string(body), nil
 }
+
+// RegisterMachine registers a host with the master.
+func RegisterMachine(masterEndpoint string, data *request.RegisterMachine) (int, string, error) {
+
+	return newDefaultTransport(masterEndpoint).raw("POST", "/machines/register", data)
+}
+
+// AnnounceGames hands the games a host still runs to its new registration.
+func AnnounceGames(masterEndpoint string, data *request.AnnounceGames) (int, string, error) {
+
+	return newDefaultTransport(masterEndpoint).raw("POST", "/machines/games", data)
+}
+
+// GetHostGames asks a host for the games it launched. The master sends
+// the host's machine key to authenticate.
+func GetHostGames(endpoint string, machineKey string) (int, string, error) {
+
+	t := newDefaultTransport(endpoint)
+	t.onRequest = func(req *http.Request) { req.Header.Set(MachineKeyHeader, machineKey) }
+	return t.raw("GET", "/games", nil)
+}
+
+// StopHostGame asks a host to kill the gameserver of a game.
+func StopHostGame(endpoint string, machineKey string, gameId int) (int, string, error) {
+
+	t := newDefaultTransport(endpoint)
+	t.onRequest = func(req *http.Request) { req.Header.Set(MachineKeyHeader, machineKey) }
+	return t.raw("DELETE", fmt.Sprintf("/games/%d", gameId), nil)
+}
@@ -0,0 +1,490 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/generate"
+	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/requests"
+	"github.com/jaybennett89/thorium-go/world"
+)
+
+// Master is a reusable client for the master server API. It keeps the
+// session key of the logged in account so later calls don't need it.
+type Master struct {
+	*transport
+
+	mu         sync.RWMutex
+	sessionKey string
+}
+
+// NewMaster creates a master client. baseURL may be a bare "host:port"
+// endpoint as used by the package level functions. A nil httpClient uses
+// a new http.Client, and a zero timeout means requests only end with ctx.
+func NewMaster(baseURL string, httpClient *http.Client, timeout time.Duration, retry RetryPolicy) *Master {
+
+	return &Master{transport: newTransport(baseURL, httpClient, timeout, retry)}
+}
+
+// newDefaultMaster backs the package level functions.
+func newDefaultMaster(endpoint string) *Master {
+	return &Master{transport: newDefaultTransport(endpoint)}
+}
+
+func (m *Master) SessionKey() string {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sessionKey
+}
+
+func (m *Master) SetSessionKey(sessionKey string) {
+
+	m.mu.Lock()
+	m.sessionKey = sessionKey
+	m.mu.Unlock()
+}
+
+func (m *Master) Status(ctx context.Context) error {
+
+	_, err := m.call(ctx, "GET", "/status", nil, 200, nil)
+	return err
+}
+
+func (m *Master) Register(ctx context.Context, username string, password string) (*request.LoginResponse, error) {
+
+	data := request.Authentication{Username: username, Password: password}
+
+	var resp request.LoginResponse
+	_, err := m.call(ctx, "POST", "/clients/register", &data, 200, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	m.SetSessionKey(resp.SessionKey)
+	return &resp, nil
+}
+
+func (m *Master) Login(ctx context.Context, username string, password string) (*request.LoginResponse, error) {
+
+	data := request.Authentication{Username: username, Password: password}
+
+	var resp request.LoginResponse
+	_, err := m.call(ctx, "POST", "/clients/login", &data, 200, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	m.SetSessionKey(resp.SessionKey)
+	return &resp, nil
+}
+
+func (m *Master) Disconnect(ctx context.Context) error {
+
+	data := request.Disconnect{SessionKey: m.SessionKey()}
+
+	_, err := m.call(ctx, "POST", "/clients/disconnect", &data, 200, nil)
+	if err != nil {
+		return err
+	}
+
+	m.SetSessionKey("")
+	return nil
+}
+
+func (m *Master) CreateCharacter(ctx context.Context, name string, classId int) (*request.NewCharacterResponse, error) {
+
+	data := request.CreateCharacter{
+		SessionKey: m.SessionKey(),
+		Name:       name,
+		ClassId:    classId}
+
+	var resp request.NewCharacterResponse
+	_, err := m.call(ctx, "POST", "/characters/new", &data, 200, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (m *Master) SelectCharacter(ctx context.Context, characterId int) (*model.Character, error) {
+
+	data := request.SelectCharacter{
+		SessionKey:  m.SessionKey(),
+		CharacterId: characterId}
+
+	var character model.Character
+	_, err := m.call(ctx, "POST", "/characters/select", &data, 200, &character)
+	if err != nil {
+		return nil, err
+	}
+
+	return &character, nil
+}
+
+// ListGames returns one page of the game browser. A nil query lists
+// every hosted game in the default order. Pass resp.NextCursor in the
+// query's Cursor to get the next page, it is empty on the last page.
+func (m *Master) ListGames(ctx context.Context, query *request.GameListQuery) (*request.GetGamesResponse, error) {
+
+	path := "/games"
+	if query != nil {
+		if values := query.Values(); len(values) > 0 {
+			path += "?" + values.Encode()
+		}
+	}
+
+	list := make([]model.Game, 0)
+	_, header, err := m.callHeader(ctx, "GET", path, nil, 200, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	return &request.GetGamesResponse{List: list, NextCursor: header.Get(request.NextCursorHeader)}, nil
+}
+
+func (m *Master) CreateGame(ctx context.Context, mapName string, gameMode string, minimumLevel int, maxPlayers int) (*request.CreateNewGameResponse, error) {
+
+	return m.createGame(ctx, &request.CreateNewGame{
+		SessionKey:   m.SessionKey(),
+		Map:          mapName,
+		GameMode:     gameMode,
+		MinimumLevel: minimumLevel,
+		MaxPlayers:   maxPlayers})
+}
+
+// CreateWorldGame creates an mp_openworld game hosting the region at coord.
+func (m *Master) CreateWorldGame(ctx context.Context, coord generate.Coordinate2D, gameMode string, minimumLevel int, maxPlayers int) (*request.CreateNewGameResponse, error) {
+
+	return m.createGame(ctx, &request.CreateNewGame{
+		SessionKey:   m.SessionKey(),
+		Map:          world.OpenWorldMap,
+		GameMode:     gameMode,
+		MinimumLevel: minimumLevel,
+		MaxPlayers:   maxPlayers,
+		WorldRegion:  &coord})
+}
+
+func (m *Master) createGame(ctx context.Context, data *request.CreateNewGame) (*request.CreateNewGameResponse, error) {
+
+	var resp request.CreateNewGameResponse
+	_, err := m.call(ctx, "POST", "/games", data, 201, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetMaps returns the map catalog games can be created from.
+func (m *Master) GetMaps(ctx context.Context) ([]model.MapEntry, error) {
+
+	list := make([]model.MapEntry, 0)
+	_, err := m.call(ctx, "GET", "/maps", nil, 200, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// SetMap adds or replaces a map of the catalog with the admin key.
+func (m *Master) SetMap(ctx context.Context, adminKey string, entry *model.MapEntry) error {
+
+	data := request.SetMapEntry{AdminKey: adminKey, MapEntry: *entry}
+	_, err := m.call(ctx, "POST", "/maps", &data, 200, nil)
+	return err
+}
+
+// DeleteMap removes a map from the catalog with the admin key.
+func (m *Master) DeleteMap(ctx context.Context, adminKey string, mapName string) error {
+
+	data := request.DeleteMapEntry{AdminKey: adminKey}
+	_, err := m.call(ctx, "DELETE", "/maps/"+url.PathEscape(mapName), &data, 200, nil)
+	return err
+}
+
+// GetServerInfo returns the address of a game's server. The second return
+// value is false while the game server is still loading.
+func (m *Master) GetServerInfo(ctx context.Context, gameId int) (*request.ServerInfoResponse, bool, error) {
+
+	var resp request.ServerInfoResponse
+	rc, err := m.call(ctx, "GET", fmt.Sprintf("/games/%d/server_info", gameId), nil, 200, &resp)
+	switch {
+	case rc == 202:
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	}
+
+	return &resp, true, nil
+}
+
+// GetGame returns the detail of a game in any lifecycle state.
+func (m *Master) GetGame(ctx context.Context, gameId int) (*model.GameDetail, error) {
+
+	var game model.GameDetail
+	_, err := m.call(ctx, "GET", fmt.Sprintf("/games/%d", gameId), nil, 200, &game)
+	if err != nil {
+		return nil, err
+	}
+
+	return &game, nil
+}
+
+func (m *Master) GetMatch(ctx context.Context, matchId int) (*model.Match, error) {
+
+	var match model.Match
+	_, err := m.call(ctx, "GET", fmt.Sprintf("/matches/%d", matchId), nil, 200, &match)
+	if err != nil {
+		return nil, err
+	}
+
+	return &match, nil
+}
+
+// GetCharacterMatches returns up to limit recent matches of a character,
+// newest first. A limit of 0 uses the master's default.
+func (m *Master) GetCharacterMatches(ctx context.Context, characterId int, limit int) ([]model.CharacterMatch, error) {
+
+	path := fmt.Sprintf("/characters/%d/matches", characterId)
+	if limit > 0 {
+		path += fmt.Sprintf("?limit=%d", limit)
+	}
+
+	list := make([]model.CharacterMatch, 0)
+	_, err := m.call(ctx, "GET", path, nil, 200, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// ProposeTrade offers items of fromId, a character of the session, to
+// toId. The offered items stay in escrow until the trade is closed.
+func (m *Master) ProposeTrade(ctx context.Context, fromId int, toId int, offer []model.Item, want []model.Item) (*model.Trade, error) {
+
+	data := request.ProposeTrade{
+		SessionKey:      m.SessionKey(),
+		FromCharacterId: fromId,
+		ToCharacterId:   toId,
+		Offer:           offer,
+		Request:         want}
+
+	var trade model.Trade
+	_, err := m.call(ctx, "POST", "/trades", &data, 200, &trade)
+	if err != nil {
+		return nil, err
+	}
+
+	return &trade, nil
+}
+
+func (m *Master) AcceptTrade(ctx context.Context, tradeId int, characterId int) (*model.Trade, error) {
+
+	return m.tradeAction(ctx, tradeId, "accept", characterId)
+}
+
+func (m *Master) CancelTrade(ctx context.Context, tradeId int, characterId int) (*model.Trade, error) {
+
+	return m.tradeAction(ctx, tradeId, "cancel", characterId)
+}
+
+func (m *Master) tradeAction(ctx context.Context, tradeId int, action string, characterId int) (*model.Trade, error) {
+
+	data := request.TradeAction{
+		SessionKey:  m.SessionKey(),
+		CharacterId: characterId}
+
+	var trade model.Trade
+	_, err := m.call(ctx, "POST", fmt.Sprintf("/trades/%d/%s", tradeId, action), &data, 200, &trade)
+	if err != nil {
+		return nil, err
+	}
+
+	return &trade, nil
+}
+
+// GetTrades returns the recent trades of a character of the session.
+func (m *Master) GetTrades(ctx context.Context, characterId int, limit int) ([]model.Trade, error) {
+
+	data := request.CharacterTrades{
+		SessionKey: m.SessionKey(),
+		Limit:      limit}
+
+	list := make([]model.Trade, 0)
+	_, err := m.call(ctx, "GET", fmt.Sprintf("/characters/%d/trades", characterId), &data, 200, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// GetRegion returns the world region at coord.
+func (m *Master) GetRegion(ctx context.Context, coord generate.Coordinate2D) (*generate.Region, error) {
+
+	var region generate.Region
+	_, err := m.call(ctx, "GET", fmt.Sprintf("/world/regions/%d/%d", coord.X, coord.Y), nil, 200, &region)
+	if err != nil {
+		return nil, err
+	}
+
+	region.Link()
+	return &region, nil
+}
+
+// GetWorldMap returns the ownership of generated regions with spiral
+// indices from first to last.
+func (m *Master) GetWorldMap(ctx context.Context, first int, last int) ([]world.RegionOwnership, error) {
+
+	list := make([]world.RegionOwnership, 0)
+	_, err := m.call(ctx, "GET", fmt.Sprintf("/world/map?from=%d&to=%d", first, last), nil, 200, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (m *Master) JoinGame(ctx context.Context, gameId int) (*request.JoinGameResponse, error) {
+
+	data := request.JoinGame{
+		GameId:     gameId,
+		SessionKey: m.SessionKey()}
+
+	var resp request.JoinGameResponse
+	_, err := m.call(ctx, "POST", "/games/join_queue", &data, 200, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// JoinFriend joins the game an accepted friend is playing in.
+func (m *Master) JoinFriend(ctx context.Context, friendId int) (*request.JoinGameResponse, error) {
+
+	data := request.JoinGame{
+		FriendId:   friendId,
+		SessionKey: m.SessionKey()}
+
+	var resp request.JoinGameResponse
+	_, err := m.call(ctx, "POST", "/games/join_queue", &data, 200, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetParty returns the account's party. Members join the game the leader
+// joined with the server in Join, once it is set.
+func (m *Master) GetParty(ctx context.Context) (*request.PartyResponse, error) {
+
+	data := request.GetParty{SessionKey: m.SessionKey()}
+
+	var resp request.PartyResponse
+	_, err := m.call(ctx, "GET", "/party", &data, 200, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (m *Master) CreateParty(ctx context.Context) (*request.PartyResponse, error) {
+
+	data := request.GetParty{SessionKey: m.SessionKey()}
+
+	var resp request.PartyResponse
+	_, err := m.call(ctx, "POST", "/party", &data, 200, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (m *Master) InviteToParty(ctx context.Context, username string) error {
+
+	return m.partyAction(ctx, "invite", &request.PartyAction{Username: username}, nil)
+}
+
+func (m *Master) AcceptPartyInvite(ctx context.Context, partyId int) (*request.PartyResponse, error) {
+
+	var resp request.PartyResponse
+	err := m.partyAction(ctx, "accept", &request.PartyAction{PartyId: partyId}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (m *Master) LeaveParty(ctx context.Context) error {
+
+	return m.partyAction(ctx, "leave", &request.PartyAction{}, nil)
+}
+
+func (m *Master) KickFromParty(ctx context.Context, userId int) error {
+
+	return m.partyAction(ctx, "kick", &request.PartyAction{UserId: userId}, nil)
+}
+
+func (m *Master) partyAction(ctx context.Context, action string, data *request.PartyAction, out interface{}) error {
+
+	data.SessionKey = m.SessionKey()
+	_, err := m.call(ctx, "POST", "/party/"+action, data, 200, out)
+	return err
+}
+
+// GetFriends lists the account's friends, requests and blocks, with the
+// presence of accepted friends.
+func (m *Master) GetFriends(ctx context.Context) ([]model.Friend, error) {
+
+	data := request.GetFriends{SessionKey: m.SessionKey()}
+
+	list := make([]model.Friend, 0)
+	_, err := m.call(ctx, "GET", "/friends", &data, 200, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// RequestFriend sends a friend request to the account named username.
+func (m *Master) RequestFriend(ctx context.Context, username string) error {
+
+	return m.friendAction(ctx, "request", &request.FriendAction{Username: username})
+}
+
+func (m *Master) AcceptFriend(ctx context.Context, userId int) error {
+
+	return m.friendAction(ctx, "accept", &request.FriendAction{UserId: userId})
+}
+
+func (m *Master) RemoveFriend(ctx context.Context, userId int) error {
+
+	return m.friendAction(ctx, "remove", &request.FriendAction{UserId: userId})
+}
+
+func (m *Master) BlockFriend(ctx context.Context, userId int) error {
+
+	return m.friendAction(ctx, "block", &request.FriendAction{UserId: userId})
+}
+
+func (m *Master) friendAction(ctx context.Context, action string, data *request.FriendAction) error {
+
+	data.SessionKey = m.SessionKey()
+	_, err := m.call(ctx, "POST", "/friends/"+action, data, 200, nil)
+	return err
+}
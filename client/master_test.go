@@ -0,0 +1,209 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/requests"
+)
+
+// These tests run against a local httptest server, not the cluster.
+
+func TestMaster_LoginKeepsSessionKey(t *testing.T) {
+
+	var created request.CreateCharacter
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/clients/login":
+			json.NewEncoder(w).Encode(&request.LoginResponse{SessionKey: "abc", CharacterIDs: []int{7}})
+		case "/characters/new":
+			json.NewDecoder(r.Body).Decode(&created)
+			json.NewEncoder(w).Encode(&request.NewCharacterResponse{CharacterId: 8})
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	m := NewMaster(server.URL, nil, time.Second, DefaultRetryPolicy)
+
+	resp, err := m.Login(context.Background(), "test", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.SessionKey != "abc" || len(resp.CharacterIDs) != 1 || m.SessionKey() != "abc" {
+		t.Fatalf("unexpected login response %+v", resp)
+	}
+
+	character, err := m.CreateCharacter(context.Background(), "hero", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if character.CharacterId != 8 || created.SessionKey != "abc" {
+		t.Fatalf("character %d created with session key %q", character.CharacterId, created.SessionKey)
+	}
+}
+
+func TestMaster_RetriesUnavailable(t *testing.T) {
+
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(503)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	m := NewMaster(server.URL, nil, time.Second, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	resp, err := m.ListGames(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 3 || len(resp.List) != 0 {
+		t.Fatalf("attempts %d list %v", attempts, resp.List)
+	}
+}
+
+func TestMaster_ListGamesReadsCursor(t *testing.T) {
+
+	var query string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Header().Set(request.NextCursorHeader, "next")
+		w.Write([]byte(`[{"gameId":4}]`))
+	}))
+	defer server.Close()
+
+	m := NewMaster(server.URL, nil, time.Second, DefaultRetryPolicy)
+
+	resp, err := m.ListGames(context.Background(), &request.GameListQuery{Limit: 1, Cursor: "prev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.List) != 1 || resp.List[0].GameId != 4 || resp.NextCursor != "next" {
+		t.Fatalf("unexpected page %+v", resp)
+	}
+
+	if query != "cursor=prev&limit=1" {
+		t.Fatalf("unexpected query %q", query)
+	}
+}
+
+func TestMaster_DoesNotRetryPost(t *testing.T) {
+
+	attempts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(504)
+	}))
+	defer server.Close()
+
+	m := NewMaster(server.URL, nil, time.Second, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	_, err := m.CreateGame(context.Background(), "mp_sandbox", "basic", 0, 16)
+	if err == nil || attempts != 1 {
+		t.Fatalf("attempts %d err %v", attempts, err)
+	}
+}
+
+// failFirstDial fails the first request as if the service couldn't be
+// reached, before anything was sent.
+type failFirstDial struct {
+	attempts int
+}
+
+func (f *failFirstDial) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	f.attempts++
+	if f.attempts == 1 {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestMaster_RetriesPostNotSent(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(201)
+		w.Write([]byte(`{"gameId":7}`))
+	}))
+	defer server.Close()
+
+	dial := &failFirstDial{}
+	m := NewMaster(server.URL, &http.Client{Transport: dial}, time.Second, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	resp, err := m.CreateGame(context.Background(), "mp_sandbox", "basic", 0, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dial.attempts != 2 || resp.GameId != 7 {
+		t.Fatalf("attempts %d game %d", dial.attempts, resp.GameId)
+	}
+}
+
+func TestMaster_StatusError(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+		w.Write([]byte("Bad Request"))
+	}))
+	defer server.Close()
+
+	m := NewMaster(server.URL, nil, time.Second, DefaultRetryPolicy)
+
+	_, err := m.Login(context.Background(), "test", "wrong")
+	statusErr, ok := err.(*StatusError)
+	if !ok || statusErr.StatusCode != 400 {
+		t.Fatalf("expected status error, got %v", err)
+	}
+
+	if m.SessionKey() != "" {
+		t.Fatal("session key set after failed login")
+	}
+}
+
+func TestMaster_JoinFriend(t *testing.T) {
+
+	var joined request.JoinGame
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/games/join_queue" {
+			w.WriteHeader(404)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&joined)
+		json.NewEncoder(w).Encode(&request.JoinGameResponse{RemoteAddress: "10.0.0.2", ListenPort: 9000})
+	}))
+	defer server.Close()
+
+	m := NewMaster(server.URL, nil, time.Second, DefaultRetryPolicy)
+	m.SetSessionKey("abc")
+
+	resp, err := m.JoinFriend(context.Background(), 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if joined.FriendId != 12 || joined.SessionKey != "abc" || resp.ListenPort != 9000 {
+		t.Fatalf("joined %+v, got %+v", joined, resp)
+	}
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how many times a request is attempted when the
+// remote service cannot be reached or answers with a gateway/unavailable
+// status. Requests that may have changed something, POSTs that reached
+// the service, are never retried. The delay before each retry doubles,
+// starting at Backoff.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: 250 * time.Millisecond}
+
+// StatusError is returned by the typed methods when the service answers
+// with an unexpected status code.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("client: unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// transport carries the settings shared by the typed clients and sends
+// JSON requests to a single base URL.
+type transport struct {
+	baseURL string
+	http    *http.Client
+	timeout time.Duration
+	retry   RetryPolicy
+
+	// sees every request before it is sent
+	onRequest func(req *http.Request)
+
+	// sees every response before its body is read
+	onResponse func(resp *http.Response)
+}
+
+func newTransport(baseURL string, httpClient *http.Client, timeout time.Duration, retry RetryPolicy) *transport {
+
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+
+	return &transport{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    httpClient,
+		timeout: timeout,
+		retry:   retry,
+	}
+}
+
+// newDefaultTransport backs the package level functions, which make a
+// single attempt without a timeout.
+func newDefaultTransport(endpoint string) *transport {
+	return newTransport(endpoint, nil, 0, RetryPolicy{MaxAttempts: 1})
+}
+
+// raw backs the package level functions, which hand back the status code
+// and body without interpreting them.
+func (t *transport) raw(method string, path string, data interface{}) (int, string, error) {
+
+	rc, _, body, err := t.do(context.Background(), method, path, data)
+	if err != nil {
+		log.Print("error with sending request: ", err)
+		return rc, "", err
+	}
+
+	return rc, string(body), nil
+}
+
+// call executes a request and decodes a successful response into out.
+// The status code is returned even when it doesn't match expect.
+func (t *transport) call(ctx context.Context, method string, path string, data interface{}, expect int, out interface{}) (int, error) {
+
+	rc, _, err := t.callHeader(ctx, method, path, data, expect, out)
+	return rc, err
+}
+
+// callHeader is call for responses that carry more than the body, it
+// also returns the response headers.
+func (t *transport) callHeader(ctx context.Context, method string, path string, data interface{}, expect int, out interface{}) (int, http.Header, error) {
+
+	rc, header, body, err := t.do(ctx, method, path, data)
+	if err != nil {
+		return rc, header, err
+	}
+
+	if rc != expect {
+		return rc, header, &StatusError{StatusCode: rc, Body: string(body)}
+	}
+
+	if out != nil {
+		err = json.Unmarshal(body, out)
+		if err != nil {
+			return rc, header, err
+		}
+	}
+
+	return rc, header, nil
+}
+
+// do sends the request, retrying according to the retry policy, and
+// returns the raw status code, headers and body of the last attempt.
+func (t *transport) do(ctx context.Context, method string, path string, data interface{}) (int, http.Header, []byte, error) {
+
+	var payload []byte
+	if data != nil {
+		var err error
+		payload, err = json.Marshal(data)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+	}
+
+	var rc int
+	var header http.Header
+	var body []byte
+	var err error
+
+	for attempt := 0; attempt < t.retry.MaxAttempts; attempt++ {
+
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return rc, header, body, ctx.Err()
+			case <-time.After(t.retry.Backoff << uint(attempt-1)):
+			}
+		}
+
+		rc, header, body, err = t.attempt(ctx, method, path, payload)
+		if err == nil && !retryableStatus(rc) {
+			return rc, header, body, nil
+		}
+
+		if ctx.Err() != nil {
+			return rc, header, body, ctx.Err()
+		}
+
+		// a retried POST could create a second game or character
+		if !idempotent(method) && !notSent(err) {
+			break
+		}
+	}
+
+	return rc, header, body, err
+}
+
+func idempotent(method string) bool {
+
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+// notSent reports whether err happened before the request reached the
+// service, while connecting to it.
+func notSent(err error) bool {
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (t *transport) attempt(ctx context.Context, method string, path string, payload []byte) (int, http.Header, []byte, error) {
+
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(method, t.baseURL+path, bytes.NewBuffer(payload))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if t.onRequest != nil {
+		t.onRequest(req)
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	if t.onResponse != nil {
+		t.onResponse(resp)
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, resp.Header, nil, err
+	}
+
+	return resp.StatusCode, resp.Header, body, nil
+}
+
+func retryableStatus(rc int) bool {
+	return rc == 502 || rc == 503 || rc == 504
+}
@@ -1,79 +1,57 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
-	"flag"
 	"fmt"
 	"log"
 	"net/http"
-	"github.com/jaybennett89/thorium-go/client"
-	"github.com/jaybennett89/thorium-go/model"
-	"github.com/jaybennett89/thorium-go/requests"
 	"time"
+	"github.com/jaybennett89/thorium-go/gameserver"
+	"github.com/jaybennett89/thorium-go/model"
 
 	"github.com/go-martini/martini"
 )
 
-var machineKey string
-var listenPort int
-var servicePort int
-var game model.Game
+var server *gameserver.Server
 var players map[string]*model.Character
 
 func main() {
 	log.Print("running a mock game server")
 
-	flag.StringVar(&machineKey, "key", "", "machine key")
-	flag.IntVar(&game.GameId, "id", 0, "identifies this game within the cluster")
-	flag.IntVar(&listenPort, "listen", 0, "game server listen port")
-	flag.IntVar(&servicePort, "service", 0, "machine local service port")
-	flag.StringVar(&game.Map, "map", "mp_sandbox", "game map: mp_sandbox, mp_openworld")
-	flag.StringVar(&game.Mode, "mode", "tutorial", "game mode: basic, tutorial, freeforall")
-	flag.IntVar(&game.MinimumLevel, "minlvl", 0, "minimum level of player")
-	flag.IntVar(&game.MaximumPlayers, "maxplayers", 16, "maximum player count")
-
-	flag.Parse()
-
-	if game.GameId == 0 || listenPort == 0 || servicePort == 0 || game.Map == "" || game.Mode == "" {
-		log.Fatal("bad arguments")
-	}
-
-	var data request.RegisterGameServer
-	data.MachineKey = machineKey
-	data.Port = listenPort
-	data.GameId = game.GameId
-	jsonBytes, err := json.Marshal(&data)
-
-	time.Sleep(180 * time.Millisecond)
-
-	endpoint := fmt.Sprintf("http://localhost:%d/games/register_server", servicePort)
-	var req *http.Request
-	req, err = http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonBytes))
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	var err error
+	server, err = gameserver.Start()
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		log.Fatal("Die - failed to register")
+		log.Fatal("Die - failed to register: ", err)
 	}
 
 	players = make(map[string]*model.Character)
 
+	go reportStatus()
+
 	m := martini.Classic()
 	m.Get("/status", handleStatusRequest)
 	m.Post("/connect", handleConnectRequest)
 	m.Post("/move", handleMoveRequest)
 	m.Post("/disconnect", handleDisconnect)
-	m.RunOnAddr(fmt.Sprintf(":%d", listenPort))
+	m.RunOnAddr(server.ListenAddr())
+}
+
+// a real game server reports from its game loop, this one has no match
+func reportStatus() {
+
+	for {
+		status := model.GameServerStatus{
+			TickRate:    1,
+			PlayerCount: len(players),
+			Phase:       model.MatchInProgress}
+
+		err := server.ReportStatus(&status)
+		if err != nil {
+			log.Print("failed to report status: ", err)
+		}
+
+		time.Sleep(gameserver.StatusInterval)
+	}
 }
 
 func handleStatusRequest(httpReq *http.Request) (int, string) {
@@ -96,27 +74,16 @@ func handleConnectRequest(httpReq *http.Request) (int, string) {
 		return 500, "Internal Server Error"
 	}
 
-	serviceEndpoint := fmt.Sprintf("localhost:%d", servicePort)
-
-	rc, body, err := client.PlayerConnect(serviceEndpoint, game.GameId, machineKey, req.SessionKey, req.CharacterId)
+	character, err := server.Connect(req.SessionKey, req.CharacterId)
 	if err != nil {
 
 		fmt.Println(err)
 		return 500, "Internal Server Error"
 	}
 
-	if rc != 200 {
-
-		fmt.Println("status: ", rc, " body: ", body)
-		return 500, "Internal Server Error"
-	}
-
-	var resp request.PlayerConnectResponse
-	err = json.Unmarshal([]byte(body), &resp)
+	players[req.SessionKey] = character
 
-	players[req.SessionKey] = resp.Character
-
-	fmt.Println("instantiate player: ", body)
+	fmt.Println("instantiate player: ", character.CharacterId, character.Name)
 	return 200, "OK"
 }
 
@@ -137,27 +104,25 @@ func handleMoveRequest(httpReq *http.Request) (int, string) {
 		return 500, "Internal Server Error"
 	}
 
-	players[req.SessionKey].Position.X += req.MoveDir.X
-	players[req.SessionKey].Position.Y += req.MoveDir.Y
-	players[req.SessionKey].Position.Z += req.MoveDir.Z
+	player, ok := players[req.SessionKey]
+	if !ok {
 
-	// for testing purposes we will update the character in the database after every move
+		return 404, "Not Found"
+	}
 
-	serviceEndpoint := fmt.Sprintf("localhost:%d", servicePort)
+	player.Position.X += req.MoveDir.X
+	player.Position.Y += req.MoveDir.Y
+	player.Position.Z += req.MoveDir.Z
+
+	// for testing purposes we will update the character in the database after every move
 
-	rc, body, err := client.UpdateCharacter(serviceEndpoint, machineKey, players[req.SessionKey])
+	err = server.Save(player)
 	if err != nil {
 
 		fmt.Println(err)
 		return 500, "Internal Server Error"
 	}
 
-	if rc != 200 {
-
-		fmt.Println("status: ", rc, " body: ", body)
-		return 500, "Internal Server Error"
-	}
-
 	return 200, "OK"
 }
 
@@ -176,20 +141,20 @@ func handleDisconnect(httpReq *http.Request) (int, string) {
 		return 500, "Internal Server Error"
 	}
 
-	serviceEndpoint := fmt.Sprintf("localhost:%d", servicePort)
+	player, ok := players[req.SessionKey]
+	if !ok {
 
-	rc, body, err := client.PlayerDisconnect(serviceEndpoint, machineKey, game.GameId, players[req.SessionKey])
+		return 404, "Not Found"
+	}
+
+	err = server.Disconnect(player)
 	if err != nil {
 
 		fmt.Println(err)
 		return 500, "Internal Server Error"
 	}
 
-	if rc != 200 {
-
-		fmt.Println("status: ", rc, " body: ", body)
-		return 500, "Internal Server Error"
-	}
+	delete(players, req.SessionKey)
 
 	return 200, "OK"
 }
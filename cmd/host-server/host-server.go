@@ -4,16 +4,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
+	"net"
 	"strconv"
+	"sync"
 	"syscall"
 	"github.com/jaybennett89/thorium-go/client"
+	"github.com/jaybennett89/thorium-go/cmd/host-server/hostconf"
+	"github.com/jaybennett89/thorium-go/cmd/host-server/snapshot"
 	"github.com/jaybennett89/thorium-go/launch"
+	"github.com/jaybennett89/thorium-go/model"
 	"github.com/jaybennett89/thorium-go/requests"
 	"github.com/jaybennett89/thorium-go/usage"
 	"time"
@@ -24,10 +28,21 @@ import "github.com/go-martini/martini"
 
 // application data
 var registerData request.MachineRegisterResponse
+var registerMutex sync.RWMutex
 var listenPort int
+var localPort int
+var snapshots *snapshot.Buffer
 
 var masterEndpoint string = "thorium-sky.net:6960"
 
+// the game each connected character plays in, so a gameserver's token
+// only reaches its own characters
+var characterGames = make(map[int]int)
+var characterMutex sync.Mutex
+
+// re-registration backs off up to this long between attempts
+const maxRegisterBackoff = time.Minute
+
 func main() {
 	fmt.Println("hello world")
 
@@ -38,40 +53,24 @@ func main() {
 
 	fmt.Println(strconv.Itoa(listenPort), "\n")
 
-	reqData := &request.RegisterMachine{Port: listenPort}
-	jsonBytes, err := json.Marshal(reqData)
+	err := register()
 	if err != nil {
-		log.Fatal(err)
+		log.Print("Error registering with master: ", err)
+		os.Exit(1)
 	}
 
-	url := fmt.Sprintf("http://%s/machines/register", masterEndpoint)
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBytes))
+	// character snapshots are written behind to the master
+	snapshots, err = snapshot.NewBuffer(hostconf.SnapshotDirectory(), sendSnapshot, sendDisconnect)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	request.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
-	if response.StatusCode != 200 {
-		log.Print("Error registering with master")
-		os.Exit(1)
-	}
-	defer response.Body.Close()
-	body, err := ioutil.ReadAll(response.Body)
+	// the local API is only reachable from this machine
+	localListener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		log.Fatal(err)
 	}
-
-	json.Unmarshal([]byte(body), &registerData)
-	fmt.Println("Registered As Machine#", registerData.MachineId)
+	localPort = localListener.Addr().(*net.TCPAddr).Port
 
 	m := martini.Classic()
 
@@ -79,12 +78,25 @@ func main() {
 	m.Get("/", handlePingRequest)
 	m.Get("/status", handlePingRequest)
 	m.Post("/games", handlePostNewGame)
+	m.Get("/games", handleGetGames)
+	m.Delete("/games/:id", handleStopGame)
 
 	// called by local gameservers
-	m.Post("/games/register_server", handleRegisterLocalServer)
-	m.Post("/games/player_connect", handlePlayerConnect)
-	m.Post("/games/player_disconnect", handlePlayerDisconnect)
-	m.Post("/characters", handleUpdateCharacter)
+	local := martini.Classic()
+	local.Post("/games/register_server", handleRegisterLocalServer)
+	local.Post("/games/unregister_server", handleUnregisterLocalServer)
+	local.Post("/games/player_connect", handlePlayerConnect)
+	local.Post("/games/player_disconnect", handlePlayerDisconnect)
+	local.Post("/games/server_status", handleLocalServerStatus)
+	local.Post("/games/match_result", handleLocalMatchResult)
+	local.Post("/characters", handleUpdateCharacter)
+	local.Post("/characters/:id/inventory/:action", handleInventoryOperation)
+	local.Get("/characters/:id/inventory", handleGetInventory)
+	local.Get("/world/regions/:x/:y", handleGetRegion)
+
+	go func() {
+		log.Fatal(http.Serve(localListener, local))
+	}()
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGKILL, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
@@ -105,6 +117,16 @@ func main() {
 		}
 	}()
 
+	snapshotTicker := time.NewTicker(hostconf.SnapshotFlushInterval())
+	go func() {
+		for {
+			select {
+			case <-snapshotTicker.C:
+				snapshots.Flush()
+			}
+		}
+	}()
+
 	thisIp := fmt.Sprintf(":%d", listenPort)
 	m.RunOnAddr(thisIp)
 }
@@ -112,7 +134,7 @@ func main() {
 func sendHeartbeat() {
 	var err error
 	statusData := &request.MachineStatus{}
-	statusData.MachineKey = registerData.MachineKey
+	statusData.MachineKey = machineKey()
 	statusData.UsageCPU, _ = usage.GetCPU()
 	statusData.UsageNetwork, _ = usage.GetNetworkUtilization()
 	statusData.PlayerCapacity = 0.0
@@ -145,6 +167,198 @@ func sendHeartbeat() {
 	}
 
 	resp.Body.Close()
+
+	// the master forgot this host, it restarted or the key expired
+	if resp.StatusCode >= 400 {
+		log.Printf("heartbeat refused with status %d, registering with the master again", resp.StatusCode)
+		reregister()
+	}
+}
+
+// register registers this host with the master and keeps the new key.
+func register() error {
+
+	reqData := &request.RegisterMachine{Port: listenPort, Region: hostconf.Region(), Profiles: hostconf.Profiles()}
+	rc, body, err := client.RegisterMachine(masterEndpoint, reqData)
+	if err != nil {
+		return err
+	}
+
+	if rc != 200 {
+		return fmt.Errorf("master answered %d: %s", rc, body)
+	}
+
+	var resp request.MachineRegisterResponse
+	err = json.Unmarshal([]byte(body), &resp)
+	if err != nil {
+		return err
+	}
+
+	registerMutex.Lock()
+	registerData = resp
+	registerMutex.Unlock()
+
+	fmt.Println("Registered As Machine#", resp.MachineId)
+	return nil
+}
+
+// reregister registers again with backoff until the master takes the
+// host and its running games back.
+func reregister() {
+
+	backoff := time.Second
+	registered := false
+	for {
+
+		var err error
+		if !registered {
+			err = register()
+			registered = err == nil
+		}
+
+		if registered {
+			err = announceGames()
+			if err == nil {
+				return
+			}
+		}
+
+		log.Printf("registering again failed, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > maxRegisterBackoff {
+			backoff = maxRegisterBackoff
+		}
+	}
+}
+
+// announceGames tells the master which games still run here so it can
+// rebuild their hosts rows under the new registration.
+func announceGames() error {
+
+	data := request.AnnounceGames{MachineKey: machineKey(), Games: make([]request.AnnouncedGame, 0)}
+	for _, game := range gameInventory() {
+		if !game.Exited {
+			data.Games = append(data.Games, game)
+		}
+	}
+
+	rc, body, err := client.AnnounceGames(masterEndpoint, &data)
+	if err != nil {
+		return err
+	}
+
+	if rc != 200 {
+		return fmt.Errorf("master answered %d announcing games: %s", rc, body)
+	}
+
+	var resp request.AnnounceGamesResponse
+	err = json.Unmarshal([]byte(body), &resp)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("announced %d games, master adopted %v and refused %v", len(data.Games), resp.Adopted, resp.Refused)
+	return nil
+}
+
+// gameInventory lists every gameserver this host launched.
+func gameInventory() []request.AnnouncedGame {
+
+	games := make([]request.AnnouncedGame, 0)
+	for _, server := range launch.GetServerList() {
+
+		games = append(games, request.AnnouncedGame{
+			GameId:         server.Game.GameId,
+			Port:           server.ListenPort,
+			Map:            server.Game.Map,
+			Mode:           server.Game.Mode,
+			MinimumLevel:   server.Game.MinimumLevel,
+			MaximumPlayers: server.Game.MaximumPlayers,
+			WorldRegion:    server.Game.WorldRegion,
+			Registered:     server.Registered,
+			StartedOn:      server.StartedOn,
+			Exited:         server.Exited})
+	}
+
+	return games
+}
+
+func registration() request.MachineRegisterResponse {
+
+	registerMutex.RLock()
+	defer registerMutex.RUnlock()
+	return registerData
+}
+
+func machineKey() string {
+	return registration().MachineKey
+}
+
+// authorizeGame checks the game token a local gameserver sent and that
+// it belongs to gameId, and puts the machine key in the request for the
+// master. A replacement token goes back in the response header.
+func authorizeGame(w http.ResponseWriter, httpReq *http.Request, gameId int, key *string, action string) bool {
+
+	tokenGame, renewed, err := launch.Authenticate(httpReq.Header.Get(client.GameTokenHeader))
+	if err != nil {
+
+		log.Print("WARNING: Received invalid game token during ", action)
+		return false
+	}
+
+	if tokenGame != gameId {
+
+		log.Printf("WARNING: game %d sent a request for game %d during %s", tokenGame, gameId, action)
+		return false
+	}
+
+	if renewed != "" {
+		w.Header().Set(client.GameTokenHeader, renewed)
+	}
+
+	*key = machineKey()
+	return true
+}
+
+// authorizeCharacter is authorizeGame for requests about a character,
+// which must be connected to the gameserver's game.
+func authorizeCharacter(w http.ResponseWriter, httpReq *http.Request, characterId int, key *string, action string) bool {
+
+	characterMutex.Lock()
+	gameId, ok := characterGames[characterId]
+	characterMutex.Unlock()
+
+	if !ok {
+
+		log.Print("WARNING: Received request for character not connected here during ", action)
+		return false
+	}
+
+	return authorizeGame(w, httpReq, gameId, key, action)
+}
+
+func sendSnapshot(character *model.Character) (int, int, error) {
+
+	rc, body, err := client.UpdateCharacter(masterEndpoint, machineKey(), character)
+	if err != nil || rc != 200 {
+		return rc, 0, err
+	}
+
+	var resp request.UpdateCharacterResponse
+	err = json.Unmarshal([]byte(body), &resp)
+	if err != nil {
+		return rc, 0, err
+	}
+
+	return rc, resp.Revision, nil
+}
+
+func sendDisconnect(gameId int, character *model.Character) (int, error) {
+
+	rc, _, err := client.PlayerDisconnect(masterEndpoint, machineKey(), gameId, character)
+	return rc, err
 }
 
 func handlePingRequest() (int, string) {
@@ -165,14 +379,21 @@ func handlePostNewGame(httpReq *http.Request, params martini.Params) (int, strin
 		return 400, err.Error() // okay to send err back to master
 	}
 
-	err = launch.NewGameServer(registerData.MachineKey, listenPort, data.GameId, data.Map, data.Mode, data.MinimumLevel, data.MaximumPlayers)
-	if err != nil {
+	err = launch.NewGameServer(localPort, &data)
+	switch {
+
+	case err == launch.ErrNoProfile || err == launch.ErrWrongBinary:
+
+		log.Print(err)
+		return 409, "Unsupported Game"
+
+	case err != nil:
 
 		log.Print(err)
 		return 500, "Internal Server Error"
 	}
 
-	response := request.NewGameServerResponse{registerData.MachineKey}
+	response := request.NewGameServerResponse{machineKey()}
 
 	json, err := json.Marshal(&response)
 	if err != nil {
@@ -183,7 +404,60 @@ func handlePostNewGame(httpReq *http.Request, params martini.Params) (int, strin
 	return 200, string(json)
 }
 
-func handlePlayerConnect(httpReq *http.Request) (int, string) {
+// handleGetGames answers the master's reconciler with the games this host
+// launched.
+func handleGetGames(httpReq *http.Request) (int, string) {
+
+	if httpReq.Header.Get(client.MachineKeyHeader) != machineKey() {
+
+		log.Print("WARNING: Received invalid machine key reading the game inventory")
+		return 403, "Invalid Key"
+	}
+
+	jsonBytes, err := json.Marshal(&request.HostGamesResponse{Games: gameInventory()})
+	if err != nil {
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
+}
+
+// handleStopGame kills a gameserver the master's reconciler doesn't want
+// running here.
+func handleStopGame(httpReq *http.Request, params martini.Params) (int, string) {
+
+	if httpReq.Header.Get(client.MachineKeyHeader) != machineKey() {
+
+		log.Print("WARNING: Received invalid machine key stopping a game")
+		return 403, "Invalid Key"
+	}
+
+	gameId, err := strconv.Atoi(params["id"])
+	if err != nil {
+
+		return 400, "Bad Request"
+	}
+
+	err = launch.StopGameServer(gameId)
+	switch {
+
+	case err == launch.ErrNoGameServer:
+
+		return 404, "Not Found"
+
+	case err != nil:
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	log.Printf("stopped game %d at the master's request", gameId)
+	return 200, "OK"
+}
+
+func handlePlayerConnect(w http.ResponseWriter, httpReq *http.Request) (int, string) {
 
 	var data request.PlayerConnect
 	decoder := json.NewDecoder(httpReq.Body)
@@ -194,13 +468,18 @@ func handlePlayerConnect(httpReq *http.Request) (int, string) {
 		return 400, "Bad Request"
 	}
 
-	if data.MachineKey != registerData.MachineKey {
+	if !authorizeGame(w, httpReq, data.GameId, &data.MachineKey, "player connect") {
 
-		log.Print("WARNING: Received invalid machine key during player connect")
-		log.Printf("have %s recv %s", registerData.MachineKey, data.MachineKey)
 		return 403, "Invalid Key"
 	}
 
+	// a disconnect from the character's last game still queued here would
+	// otherwise reach the master after this connect
+	if !snapshots.Departed(data.CharacterId) {
+
+		return 503, "Service Unavailable"
+	}
+
 	rc, body, err := client.PlayerConnect(masterEndpoint, data.GameId, data.MachineKey, data.SessionKey, data.CharacterId)
 
 	if err != nil {
@@ -209,10 +488,28 @@ func handlePlayerConnect(httpReq *http.Request) (int, string) {
 		return 500, "Internal Server Error"
 	}
 
+	if rc == 200 {
+
+		// snapshots of the character are written against this revision
+		var resp request.PlayerConnectResponse
+		err = json.Unmarshal([]byte(body), &resp)
+		if err != nil || resp.Character == nil {
+
+			log.Print("bad player connect response from master: ", body)
+			return 500, "Internal Server Error"
+		}
+
+		snapshots.Track(resp.Character.CharacterId, resp.Character.Revision)
+
+		characterMutex.Lock()
+		characterGames[resp.Character.CharacterId] = data.GameId
+		characterMutex.Unlock()
+	}
+
 	return rc, body
 }
 
-func handlePlayerDisconnect(httpReq *http.Request) (int, string) {
+func handlePlayerDisconnect(w http.ResponseWriter, httpReq *http.Request) (int, string) {
 
 	var data request.PlayerDisconnect
 	decoder := json.NewDecoder(httpReq.Body)
@@ -223,15 +520,108 @@ func handlePlayerDisconnect(httpReq *http.Request) (int, string) {
 		return 400, "Bad Request"
 	}
 
-	if data.MachineKey != registerData.MachineKey {
+	if !authorizeGame(w, httpReq, data.GameId, &data.MachineKey, "player disconnect") {
 
-		log.Print("WARNING: Received invalid machine key during player connect")
-		log.Printf("have %s recv %s", registerData.MachineKey, data.MachineKey)
 		return 403, "Invalid Key"
 	}
 
+	if data.Snapshot == nil {
+
+		return 400, "Bad Request"
+	}
+
+	characterMutex.Lock()
+	playing, connected := characterGames[data.Snapshot.CharacterId]
+	if connected && playing == data.GameId {
+		delete(characterGames, data.Snapshot.CharacterId)
+	}
+	characterMutex.Unlock()
+
+	// the final snapshot replaces anything still buffered for the character
+	revision, tracked := snapshots.Forget(data.Snapshot.CharacterId)
+	if tracked {
+		data.Snapshot.Revision = revision
+	}
+
 	rc, body, err := client.PlayerDisconnect(masterEndpoint, data.MachineKey, data.GameId, data.Snapshot)
+	if err == nil && rc < 500 {
 
+		return rc, body
+	}
+
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	// the disconnect itself is replayed so the player's slot is freed
+	// along with storing the final snapshot
+	err = snapshots.Depart(data.GameId, data.Snapshot)
+	if err != nil {
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	log.Printf("queued disconnect of character %d from game %d, master status %d", data.Snapshot.CharacterId, data.GameId, rc)
+	return 200, "OK"
+}
+
+func handleUpdateCharacter(w http.ResponseWriter, httpReq *http.Request) (int, string) {
+
+	var data request.UpdateCharacter
+	decoder := json.NewDecoder(httpReq.Body)
+	err := decoder.Decode(&data)
+	if err != nil {
+
+		fmt.Println(err)
+		return 400, "Bad Request"
+	}
+
+	if data.Snapshot == nil {
+
+		return 400, "Bad Request"
+	}
+
+	if !authorizeCharacter(w, httpReq, data.Snapshot.CharacterId, &data.MachineKey, "update character") {
+
+		return 403, "Invalid Key"
+	}
+
+	// snapshots are coalesced per character and flushed on an interval
+	err = snapshots.Push(data.Snapshot)
+	switch {
+
+	case err == snapshot.ErrNotTracked:
+
+		log.Print("rejected snapshot of character not connected here: ", data.Snapshot.CharacterId)
+		return 409, "Conflict"
+
+	case err != nil:
+
+		fmt.Println(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, "OK"
+}
+
+func handleLocalServerStatus(w http.ResponseWriter, httpReq *http.Request) (int, string) {
+
+	var data request.GameServerStatus
+	decoder := json.NewDecoder(httpReq.Body)
+	err := decoder.Decode(&data)
+	if err != nil {
+
+		fmt.Println(err)
+		return 400, "Bad Request"
+	}
+
+	if !authorizeGame(w, httpReq, data.GameId, &data.MachineKey, "server status") {
+
+		return 403, "Invalid Key"
+	}
+
+	rc, body, err := client.ReportGameStatus(masterEndpoint, data.MachineKey, data.GameId, &data.Status)
 	if err != nil {
 
 		fmt.Println(err)
@@ -241,9 +631,33 @@ func handlePlayerDisconnect(httpReq *http.Request) (int, string) {
 	return rc, body
 }
 
-func handleUpdateCharacter(httpReq *http.Request) (int, string) {
+func handleGetRegion(params martini.Params) (int, string) {
 
-	var data request.UpdateCharacter
+	x, err := strconv.Atoi(params["x"])
+	if err != nil {
+
+		return 400, "Bad Request"
+	}
+
+	y, err := strconv.Atoi(params["y"])
+	if err != nil {
+
+		return 400, "Bad Request"
+	}
+
+	rc, body, err := client.GetRegion(masterEndpoint, x, y)
+	if err != nil {
+
+		fmt.Println(err)
+		return 500, "Internal Server Error"
+	}
+
+	return rc, body
+}
+
+func handleLocalMatchResult(w http.ResponseWriter, httpReq *http.Request) (int, string) {
+
+	var data request.MatchResult
 	decoder := json.NewDecoder(httpReq.Body)
 	err := decoder.Decode(&data)
 	if err != nil {
@@ -252,25 +666,106 @@ func handleUpdateCharacter(httpReq *http.Request) (int, string) {
 		return 400, "Bad Request"
 	}
 
-	if data.MachineKey != registerData.MachineKey {
+	if !authorizeGame(w, httpReq, data.GameId, &data.MachineKey, "match result") {
 
-		log.Print("WARNING: Received invalid machine key during update character")
-		log.Printf("have %s recv %s", registerData.MachineKey, data.MachineKey)
 		return 403, "Invalid Key"
 	}
 
-	rc, body, err := client.UpdateCharacter(masterEndpoint, data.MachineKey, data.Snapshot)
+	rc, body, err := client.ReportMatchResult(masterEndpoint, &data)
+	if err != nil {
+
+		fmt.Println(err)
+		return 500, "Internal Server Error"
+	}
+
+	return rc, body
+}
+
+func handleInventoryOperation(w http.ResponseWriter, httpReq *http.Request, params martini.Params) (int, string) {
+
+	characterId, err := strconv.Atoi(params["id"])
+	if err != nil {
+
+		return 400, "Bad Request"
+	}
 
+	var data request.InventoryOperation
+	decoder := json.NewDecoder(httpReq.Body)
+	err = decoder.Decode(&data)
+	if err != nil {
+
+		fmt.Println(err)
+		return 400, "Bad Request"
+	}
+
+	if !authorizeCharacter(w, httpReq, characterId, &data.MachineKey, "inventory operation") {
+
+		return 403, "Invalid Key"
+	}
+
+	rc, body, err := client.InventoryOperation(masterEndpoint, characterId, params["action"], &data)
+	if err != nil {
+
+		fmt.Println(err)
+		return 500, "Internal Server Error"
+	}
+
+	if rc == 200 {
+
+		// a buffered snapshot still has the old inventory
+		var resp request.InventoryResponse
+		err = json.Unmarshal([]byte(body), &resp)
+		if err != nil {
+
+			log.Print("bad inventory response from master: ", body)
+			return 500, "Internal Server Error"
+		}
+
+		snapshots.SetInventory(characterId, resp.Inventory, resp.Version)
+	}
+
+	return rc, body
+}
+
+func handleGetInventory(w http.ResponseWriter, httpReq *http.Request, params martini.Params) (int, string) {
+
+	characterId, err := strconv.Atoi(params["id"])
+	if err != nil {
+
+		return 400, "Bad Request"
+	}
+
+	var data request.GetInventory
+	if !authorizeCharacter(w, httpReq, characterId, &data.MachineKey, "inventory read") {
+
+		return 403, "Invalid Key"
+	}
+
+	rc, body, err := client.GetInventory(masterEndpoint, characterId, &data)
 	if err != nil {
 
 		fmt.Println(err)
 		return 500, "Internal Server Error"
 	}
 
+	if rc == 200 {
+
+		// the inventory changed outside the game, for example by a trade
+		var resp request.InventoryResponse
+		err = json.Unmarshal([]byte(body), &resp)
+		if err != nil {
+
+			log.Print("bad inventory response from master: ", body)
+			return 500, "Internal Server Error"
+		}
+
+		snapshots.SetInventory(characterId, resp.Inventory, resp.Version)
+	}
+
 	return rc, body
 }
 
-func handleRegisterLocalServer(httpReq *http.Request, params martini.Params) (int, string) {
+func handleRegisterLocalServer(w http.ResponseWriter, httpReq *http.Request, params martini.Params) (int, string) {
 
 	decoder := json.NewDecoder(httpReq.Body)
 	var data request.RegisterGameServer
@@ -281,10 +776,8 @@ func handleRegisterLocalServer(httpReq *http.Request, params martini.Params) (in
 		return 400, "Bad Request"
 	}
 
-	if data.MachineKey != registerData.MachineKey {
+	if !authorizeGame(w, httpReq, data.GameId, &data.MachineKey, "register local gameserver") {
 
-		log.Print("WARNING: Received invalid key trying to register local gameserver")
-		log.Printf("have %s recv %s", registerData.MachineKey, data.MachineKey)
 		return 403, "Invalid Key"
 	}
 
@@ -321,20 +814,85 @@ func handleRegisterLocalServer(httpReq *http.Request, params martini.Params) (in
 		return 400, "Bad Request"
 	}
 
+	launch.MarkRegistered(data.GameId)
+	return 200, "OK"
+}
+
+func handleUnregisterLocalServer(w http.ResponseWriter, httpReq *http.Request) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var data request.UnregisterGameServer
+	err := decoder.Decode(&data)
+	if err != nil {
+
+		log.Print(err)
+		return 400, "Bad Request"
+	}
+
+	if !authorizeGame(w, httpReq, data.GameId, &data.MachineKey, "unregister local gameserver") {
+
+		return 403, "Invalid Key"
+	}
+
+	var jsonBytes []byte
+	jsonBytes, err = json.Marshal(&data)
+	if err != nil {
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	endpoint := fmt.Sprintf("http://%s/games/unregister_server", masterEndpoint)
+	var req *http.Request
+	req, err = http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonBytes))
+	if err != nil {
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	client := &http.Client{}
+	var resp *http.Response
+	resp, err = client.Do(req)
+	if err != nil {
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+
+		log.Print("error: couldn't unregister game server with master")
+		return 400, "Bad Request"
+	}
+
+	characterMutex.Lock()
+	for characterId, gameId := range characterGames {
+		if gameId == data.GameId {
+			delete(characterGames, characterId)
+		}
+	}
+	characterMutex.Unlock()
+
 	return 200, "OK"
 }
 
 func shutdown() {
 
+	if snapshots != nil {
+		snapshots.Flush()
+	}
+
 	var reqData request.UnregisterMachine
-	reqData.MachineKey = registerData.MachineKey
+	reqData.MachineKey = machineKey()
 	jsonBytes, err := json.Marshal(&reqData)
 	if err != nil {
 		return
 	}
 
 	var req *http.Request
-	req, err = http.NewRequest("POST", fmt.Sprintf("http://%s/machines/%d/disconnect", masterEndpoint, registerData.MachineId), bytes.NewBuffer(jsonBytes))
+	req, err = http.NewRequest("POST", fmt.Sprintf("http://%s/machines/%d/disconnect", masterEndpoint, registration().MachineId), bytes.NewBuffer(jsonBytes))
 	if err != nil {
 		return
 	}
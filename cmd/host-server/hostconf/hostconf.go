@@ -4,13 +4,56 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"time"
+
+	"github.com/jaybennett89/thorium-go/model"
 )
 
+// HostConfiguration is read from host.config. Profiles are keyed by
+// "map/mode", where either can be "*" and a key without a mode matches
+// every mode of the map. GameserverBinaryPath is the old single binary,
+// used for every game when there are no profiles. CgroupParent is a
+// cgroup v2 directory delegated to the host-server, under which each game
+// gets its own group.
 type HostConfiguration struct {
 	GameserverBinaryPath string
+	Profiles             map[string]LaunchProfile
+	CgroupParent         string
+	SnapshotDirectory    string
+	SnapshotFlushSeconds int
+	Region               string
+}
+
+// LaunchProfile is how gameservers of a map and mode are started. Args
+// come after the standard launch arguments and Env is added to the
+// host-server's environment. Each game runs in its own directory inside
+// WorkingDirectory, as Uid and Gid when Uid is set.
+type LaunchProfile struct {
+	Binary           string
+	Args             []string
+	Env              []string
+	WorkingDirectory string
+	Uid              int
+	Gid              int
+	Limits           ResourceLimits
 }
 
+// ResourceLimits are set on each gameserver process of a profile. Zero
+// leaves a limit unset. Memory is capped by the game's cgroup, or by its
+// address space without one; CPUPercent and MaxProcesses need a cgroup.
+type ResourceLimits struct {
+	MemoryMB     int
+	CPUSeconds   int
+	OpenFiles    int
+	CPUPercent   int
+	MaxProcesses int
+}
+
+const defaultSnapshotDirectory = "snapshots"
+const defaultSnapshotFlushSeconds = 10
+
 var config HostConfiguration
 var lastConfigMod time.Time
 
@@ -35,10 +78,95 @@ func init() {
 	lastConfigMod = info.ModTime()
 }
 
-func GameserverBinaryPath() string {
+// Profiles lists the games this host can launch, as reported to the
+// master at registration.
+func Profiles() []model.HostProfile {
+
+	checkConfigFile()
+
+	profiles := launchProfiles()
+	keys := make([]string, 0, len(profiles))
+	for key := range profiles {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make([]model.HostProfile, 0, len(keys))
+	for _, key := range keys {
+		mapName, mode := model.ParseProfileKey(key)
+		list = append(list, model.HostProfile{Map: mapName, Mode: mode, Binary: filepath.Base(profiles[key].Binary)})
+	}
+	return list
+}
+
+// Profile returns the launch profile for a game of map and mode, picked
+// the same way the master does.
+func Profile(mapName string, mode string) (*LaunchProfile, bool) {
+
+	list := Profiles()
+	i := model.SelectProfile(list, mapName, mode)
+	if i < 0 {
+		return nil, false
+	}
+
+	profile := launchProfiles()[model.ProfileKey(list[i].Map, list[i].Mode)]
+	return &profile, true
+}
+
+func launchProfiles() map[string]LaunchProfile {
+
+	if len(config.Profiles) > 0 {
+
+		// keys are normalized so "map" and "map/*" are the same profile
+		profiles := make(map[string]LaunchProfile, len(config.Profiles))
+		for key, profile := range config.Profiles {
+			mapName, mode := model.ParseProfileKey(key)
+			profiles[model.ProfileKey(mapName, mode)] = profile
+		}
+		return profiles
+	}
+
+	if config.GameserverBinaryPath == "" {
+		return map[string]LaunchProfile{}
+	}
+
+	key := model.ProfileKey(model.AnyProfileMatch, model.AnyProfileMatch)
+	return map[string]LaunchProfile{key: {Binary: config.GameserverBinaryPath}}
+}
+
+// CgroupParent is the cgroup games are placed under, empty if none.
+func CgroupParent() string {
+
+	checkConfigFile()
+	return config.CgroupParent
+}
+
+// SnapshotDirectory is where character snapshots are kept until the
+// master has stored them.
+func SnapshotDirectory() string {
+
+	checkConfigFile()
+	if config.SnapshotDirectory == "" {
+		return defaultSnapshotDirectory
+	}
+	return config.SnapshotDirectory
+}
+
+func SnapshotFlushInterval() time.Duration {
+
+	checkConfigFile()
+	if config.SnapshotFlushSeconds <= 0 {
+		return defaultSnapshotFlushSeconds * time.Second
+	}
+	return time.Duration(config.SnapshotFlushSeconds) * time.Second
+}
+
+// Region is reported to the master at registration and shown to players
+// browsing games.
+func Region() string {
 
 	checkConfigFile()
-	return config.GameserverBinaryPath
+	return config.Region
 }
 
 func checkConfigFile() {
@@ -59,13 +187,16 @@ func checkConfigFile() {
 			log.Fatal(err)
 		}
 
+		// decoded fresh so profiles removed from the file go away
+		var reloaded HostConfiguration
 		decoder := json.NewDecoder(file)
-		err = decoder.Decode(&config)
+		err = decoder.Decode(&reloaded)
 		if err != nil {
 
 			log.Fatal(err)
 		}
 
+		config = reloaded
 		lastConfigMod = modTime
 
 		log.Print("config reloaded")
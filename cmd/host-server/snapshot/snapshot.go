@@ -0,0 +1,409 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+var ErrNotTracked = errors.New("snapshot: character is not connected to this host")
+
+// Sender delivers a character snapshot to the master. It returns the
+// response status code and, when the snapshot was stored, the new
+// revision of the character.
+type Sender func(character *model.Character) (int, int, error)
+
+// Disconnecter delivers a player disconnect with the final snapshot of the
+// character to the master and returns the response status code.
+type Disconnecter func(gameId int, character *model.Character) (int, error)
+
+// departure is a player disconnect the master couldn't be reached for.
+type departure struct {
+	GameId    int              `json:"gameId"`
+	Character *model.Character `json:"character"`
+}
+
+// departures are stored next to the snapshots with their own suffix
+const departureSuffix = ".disconnect"
+
+// Buffer coalesces character snapshots pushed by local gameservers and
+// writes them behind to the master. Only the latest snapshot of each
+// character is kept. It is also stored in dir until the master accepts
+// it, so snapshots survive a restart of the host-server.
+//
+// The buffer is the only writer of a connected character, so it keeps the
+// revision the master last acknowledged and sends every snapshot against
+// it. Characters must be tracked from player connect to disconnect.
+//
+// Pending snapshots are sent without holding the lock, so they are never
+// changed once buffered. Changes replace them with a changed copy.
+//
+// Player disconnects the master couldn't take are queued the same way and
+// replayed, so the character's slot in its game is freed eventually.
+type Buffer struct {
+	dir        string
+	send       Sender
+	disconnect Disconnecter
+
+	mu        sync.Mutex
+	pending   map[int]*model.Character
+	revisions map[int]int
+	departing map[int]*departure
+
+	// serializes flushes with Forget so an old snapshot can't be sent
+	// after a newer one went to the master through another path
+	flushMu sync.Mutex
+}
+
+// NewBuffer creates the snapshot directory if needed and loads any
+// snapshots and disconnects left in it, which are sent with the next flush.
+func NewBuffer(dir string, send Sender, disconnect Disconnecter) (*Buffer, error) {
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Buffer{
+		dir:        dir,
+		send:       send,
+		disconnect: disconnect,
+		pending:    make(map[int]*model.Character),
+		revisions:  make(map[int]int),
+		departing:  make(map[int]*departure),
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range files {
+
+		isDeparture := strings.HasSuffix(info.Name(), departureSuffix)
+		if !isDeparture && !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if isDeparture {
+
+			var d departure
+			err = json.Unmarshal(data, &d)
+			if err != nil || d.Character == nil {
+				log.Print("snapshot: skipping unreadable file ", info.Name(), ": ", err)
+				continue
+			}
+
+			b.departing[d.Character.CharacterId] = &d
+			continue
+		}
+
+		var character model.Character
+		err = json.Unmarshal(data, &character)
+		if err != nil {
+			log.Print("snapshot: skipping unreadable file ", info.Name(), ": ", err)
+			continue
+		}
+
+		b.pending[character.CharacterId] = &character
+		b.revisions[character.CharacterId] = character.Revision
+	}
+
+	if len(b.pending)+len(b.departing) > 0 {
+		log.Printf("snapshot: replaying %d stored snapshots and %d disconnects", len(b.pending), len(b.departing))
+	}
+
+	return b, nil
+}
+
+// Track starts accepting snapshots of a character read at revision.
+func (b *Buffer) Track(characterId int, revision int) {
+
+	b.mu.Lock()
+	b.revisions[characterId] = revision
+	b.mu.Unlock()
+}
+
+// Push replaces the pending snapshot of a character with a copy of
+// character. ErrNotTracked is returned for characters that aren't
+// connected through this host.
+func (b *Buffer) Push(character *model.Character) error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	revision, ok := b.revisions[character.CharacterId]
+	if !ok {
+		return ErrNotTracked
+	}
+
+	snapshot := *character
+	snapshot.Revision = revision
+	b.pending[character.CharacterId] = &snapshot
+	return b.store(&snapshot)
+}
+
+// Forget stops tracking a character and drops its pending snapshot, for
+// example when its final snapshot is sent with a player disconnect. It
+// returns the revision that snapshot has to be written against.
+func (b *Buffer) Forget(characterId int) (int, bool) {
+
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	revision, ok := b.revisions[characterId]
+	delete(b.revisions, characterId)
+	delete(b.pending, characterId)
+	b.remove(characterId)
+	return revision, ok
+}
+
+// Depart queues a player disconnect the master couldn't be reached for.
+// The character should be forgotten first, its final snapshot carries the
+// revision Forget returned.
+func (b *Buffer) Depart(gameId int, character *model.Character) error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d := &departure{GameId: gameId, Character: character}
+	b.departing[character.CharacterId] = d
+	return b.storeDeparture(d)
+}
+
+// Departed sends the queued disconnect of a character, if there is one,
+// and reports whether none is left. A character has to be disconnected
+// from its last game before it connects to the next one.
+func (b *Buffer) Departed(characterId int) bool {
+
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	d, ok := b.departing[characterId]
+	b.mu.Unlock()
+
+	return !ok || b.replay(d)
+}
+
+// SetInventory replaces the inventory of a pending snapshot after the
+// master changed the inventory, so the snapshot still matches the ledger
+// at version.
+func (b *Buffer) SetInventory(characterId int, items []model.Item, version int) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending, ok := b.pending[characterId]
+	if !ok {
+		return
+	}
+
+	// a flush may be sending the old one
+	character := *pending
+	character.Inventory = items
+	character.InventoryVersion = version
+	b.pending[characterId] = &character
+
+	err := b.store(&character)
+	if err != nil {
+		log.Print("snapshot: ", err)
+	}
+}
+
+// Departures returns the number of queued player disconnects.
+func (b *Buffer) Departures() int {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.departing)
+}
+
+// Len returns the number of characters with a pending snapshot.
+func (b *Buffer) Len() int {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// Flush sends every pending snapshot and queued disconnect. Those the
+// master couldn't be reached for stay pending, those it rejected are
+// dropped. A conflict means the character was written elsewhere, so it is
+// no longer tracked.
+func (b *Buffer) Flush() {
+
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := make([]*model.Character, 0, len(b.pending))
+	for _, character := range b.pending {
+		batch = append(batch, character)
+	}
+	departures := make([]*departure, 0, len(b.departing))
+	for _, d := range b.departing {
+		departures = append(departures, d)
+	}
+	b.mu.Unlock()
+
+	for _, d := range departures {
+		b.replay(d)
+	}
+
+	for _, character := range batch {
+
+		rc, revision, err := b.send(character)
+		switch {
+
+		case err != nil:
+
+			log.Print("snapshot: couldn't send character ", character.CharacterId, ": ", err)
+			continue
+
+		case rc >= 500:
+
+			log.Print("snapshot: master failed to store character ", character.CharacterId, ", status ", rc)
+			continue
+
+		case rc == 409:
+
+			log.Print("snapshot: character ", character.CharacterId, " changed since revision ", character.Revision, ", dropping it")
+			b.mu.Lock()
+			delete(b.revisions, character.CharacterId)
+			b.mu.Unlock()
+
+		case rc != 200:
+
+			log.Print("snapshot: master rejected character ", character.CharacterId, ", status ", rc)
+		}
+
+		b.mu.Lock()
+		if _, ok := b.revisions[character.CharacterId]; ok && rc == 200 {
+			b.revisions[character.CharacterId] = revision
+		}
+
+		newer := b.pending[character.CharacterId]
+		switch {
+		case newer == character:
+			delete(b.pending, character.CharacterId)
+			b.remove(character.CharacterId)
+		case newer != nil && rc == 409:
+			delete(b.pending, character.CharacterId)
+			b.remove(character.CharacterId)
+		case newer != nil:
+			// pushed or changed while this one was sent, it now applies to
+			// the new revision
+			rebased := *newer
+			rebased.Revision = b.revisions[character.CharacterId]
+			b.pending[character.CharacterId] = &rebased
+			err = b.store(&rebased)
+			if err != nil {
+				log.Print("snapshot: ", err)
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+// replay sends a queued disconnect and reports whether it is done with.
+func (b *Buffer) replay(d *departure) bool {
+
+	characterId := d.Character.CharacterId
+	rc, err := b.disconnect(d.GameId, d.Character)
+	switch {
+
+	case err != nil:
+
+		log.Print("snapshot: couldn't disconnect character ", characterId, ": ", err)
+		return false
+
+	case rc >= 500:
+
+		log.Print("snapshot: master failed to disconnect character ", characterId, ", status ", rc)
+		return false
+
+	case rc != 200:
+
+		log.Print("snapshot: master rejected disconnect of character ", characterId, ", status ", rc)
+	}
+
+	b.mu.Lock()
+	if b.departing[characterId] == d {
+		delete(b.departing, characterId)
+		b.removeFile(b.departurePath(characterId))
+	}
+	b.mu.Unlock()
+	return true
+}
+
+func (b *Buffer) path(characterId int) string {
+	return filepath.Join(b.dir, strconv.Itoa(characterId)+".json")
+}
+
+// store writes through a temporary file so a crash never leaves a
+// partial snapshot behind.
+func (b *Buffer) store(character *model.Character) error {
+
+	data, err := json.Marshal(character)
+	if err != nil {
+		return err
+	}
+
+	tmp := b.path(character.CharacterId) + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, b.path(character.CharacterId))
+}
+
+func (b *Buffer) departurePath(characterId int) string {
+	return filepath.Join(b.dir, strconv.Itoa(characterId)+departureSuffix)
+}
+
+func (b *Buffer) storeDeparture(d *departure) error {
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	tmp := b.departurePath(d.Character.CharacterId) + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, b.departurePath(d.Character.CharacterId))
+}
+
+func (b *Buffer) remove(characterId int) {
+
+	b.removeFile(b.path(characterId))
+}
+
+func (b *Buffer) removeFile(path string) {
+
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Print("snapshot: ", err)
+	}
+}
@@ -0,0 +1,316 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+func snapshotAt(characterId int, x float64) *model.Character {
+
+	character := model.NewCharacter()
+	character.CharacterId = characterId
+	character.Position.X = x
+	return character
+}
+
+func TestBuffer_Coalesces(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sent := make([]*model.Character, 0)
+	b, err := NewBuffer(dir, func(c *model.Character) (int, int, error) {
+		sent = append(sent, c)
+		return 200, c.Revision + 1, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Track(1, 0)
+	b.Track(2, 0)
+
+	for i := 0; i < 5; i++ {
+		b.Push(snapshotAt(1, float64(i)))
+	}
+	b.Push(snapshotAt(2, 0))
+
+	b.Flush()
+
+	if len(sent) != 2 || b.Len() != 0 {
+		t.Fatalf("sent %d snapshots, %d pending", len(sent), b.Len())
+	}
+
+	for _, c := range sent {
+		if c.CharacterId == 1 && c.Position.X != 4 {
+			t.Fatalf("sent stale snapshot at x=%v", c.Position.X)
+		}
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Fatalf("%d snapshot files left after flush", len(files))
+	}
+}
+
+func TestBuffer_ReplaysAfterFailure(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := NewBuffer(dir, func(c *model.Character) (int, int, error) {
+		return 0, 0, errors.New("master unreachable")
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Track(7, 4)
+	b.Push(snapshotAt(7, 3))
+	b.Flush()
+
+	if b.Len() != 1 {
+		t.Fatal("snapshot dropped after failed send")
+	}
+
+	// a restarted host-server picks the snapshot up from disk
+	var replayed *model.Character
+	b, err = NewBuffer(dir, func(c *model.Character) (int, int, error) {
+		replayed = c
+		return 200, c.Revision + 1, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Flush()
+
+	if replayed == nil || replayed.CharacterId != 7 || replayed.Position.X != 3 || replayed.Revision != 4 {
+		t.Fatalf("unexpected replay %+v", replayed)
+	}
+}
+
+func TestBuffer_Forget(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := NewBuffer(dir, func(c *model.Character) (int, int, error) {
+		t.Fatal("forgotten snapshot was sent")
+		return 200, 0, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Track(1, 2)
+	b.Push(snapshotAt(1, 0))
+
+	revision, tracked := b.Forget(1)
+	if !tracked || revision != 2 {
+		t.Fatalf("forget returned revision %d, tracked %v", revision, tracked)
+	}
+
+	b.Flush()
+
+	if b.Push(snapshotAt(1, 1)) != ErrNotTracked {
+		t.Fatal("accepted snapshot after forget")
+	}
+}
+
+func TestBuffer_Revisions(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stored := 5
+	b, err := NewBuffer(dir, func(c *model.Character) (int, int, error) {
+		if c.Revision != stored {
+			return 409, 0, nil
+		}
+		stored++
+		return 200, stored, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every flush is written against the revision of the previous one
+	b.Track(1, 5)
+	for i := 0; i < 3; i++ {
+		b.Push(snapshotAt(1, float64(i)))
+		b.Flush()
+	}
+
+	if stored != 8 || b.Len() != 0 {
+		t.Fatalf("stored revision %d, %d pending", stored, b.Len())
+	}
+
+	// someone else wrote the character, the buffer stops tracking it
+	stored = 20
+	b.Push(snapshotAt(1, 4))
+	b.Flush()
+
+	if b.Push(snapshotAt(1, 5)) != ErrNotTracked {
+		t.Fatal("still tracking character after conflict")
+	}
+}
+
+func TestBuffer_SetInventory(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := NewBuffer(dir, func(c *model.Character) (int, int, error) {
+		return 200, c.Revision + 1, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Track(1, 0)
+	b.Push(snapshotAt(1, 1))
+	b.SetInventory(1, []model.Item{{ItemId: 5, Stacks: 2}}, 3)
+	b.SetInventory(2, []model.Item{{ItemId: 5, Stacks: 2}}, 3)
+
+	// the stored copy is what a restarted host-server replays
+	reloaded, err := NewBuffer(dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	character := reloaded.pending[1]
+	if character == nil || len(character.Inventory) != 1 || character.Inventory[0].Stacks != 2 || character.InventoryVersion != 3 {
+		t.Fatalf("stored snapshot has inventory %v", character)
+	}
+
+	if reloaded.Len() != 1 {
+		t.Fatalf("%d snapshots pending", reloaded.Len())
+	}
+}
+
+func TestBuffer_Departures(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	send := func(c *model.Character) (int, int, error) {
+		return 200, c.Revision + 1, nil
+	}
+
+	down := func(gameId int, c *model.Character) (int, error) {
+		return 503, nil
+	}
+
+	b, err := NewBuffer(dir, send, down)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Track(4, 2)
+	revision, _ := b.Forget(4)
+	final := snapshotAt(4, 9)
+	final.Revision = revision
+	b.Depart(12, final)
+	b.Flush()
+
+	if b.Departed(4) || b.Departures() != 1 {
+		t.Fatal("disconnect dropped while the master is down")
+	}
+
+	// a restarted host-server replays it with the final snapshot
+	var gameId int
+	var replayed *model.Character
+	b, err = NewBuffer(dir, send, func(id int, c *model.Character) (int, error) {
+		gameId, replayed = id, c
+		return 200, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Flush()
+
+	if gameId != 12 || replayed == nil || replayed.Position.X != 9 || replayed.Revision != 2 {
+		t.Fatalf("unexpected replay of game %d: %+v", gameId, replayed)
+	}
+
+	if !b.Departed(4) || b.Departures() != 0 {
+		t.Fatal("disconnect still queued after the master took it")
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Fatalf("%d files left after replay", len(files))
+	}
+}
+
+// run with -race, a flush sends snapshots while their inventory is replaced
+func TestBuffer_SetInventoryDuringFlush(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := NewBuffer(dir, func(c *model.Character) (int, int, error) {
+		_, err := json.Marshal(c)
+		return 200, c.Revision + 1, err
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Track(1, 0)
+	b.Push(snapshotAt(1, 0))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			b.SetInventory(1, []model.Item{{ItemId: 5, Stacks: i}}, i)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			b.Push(snapshotAt(1, float64(i)))
+			b.Flush()
+		}
+	}()
+
+	wg.Wait()
+	b.Flush()
+
+	if b.Len() != 0 {
+		t.Fatalf("%d snapshots pending after the last flush", b.Len())
+	}
+}
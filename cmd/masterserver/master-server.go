@@ -11,7 +11,11 @@ import (
 import "github.com/go-martini/martini"
 import (
 	"github.com/jaybennett89/thorium-go/database"
+	"github.com/jaybennett89/thorium-go/generate"
+	"github.com/jaybennett89/thorium-go/inventory"
+	"github.com/jaybennett89/thorium-go/model"
 	"github.com/jaybennett89/thorium-go/requests"
+	"github.com/jaybennett89/thorium-go/trade"
 )
 
 func main() {
@@ -34,13 +38,44 @@ func main() {
 	m.Get("/characters/:id/profile", handleGetCharProfile)
 	m.Get("/characters", handleGetCharacter)
 	m.Post("/characters", handleUpdateCharacter)
+	m.Get("/characters/:id/history", handleGetCharacterHistory)
+	m.Post("/characters/:id/restore", handleRestoreCharacter)
+	m.Get("/characters/:id/matches", handleGetCharacterMatches)
+	m.Post("/characters/:id/inventory/:action", handleInventoryOperation)
+	m.Get("/characters/:id/inventory/log", handleGetInventoryLog)
+	m.Get("/characters/:id/inventory", handleGetInventory)
+	m.Get("/characters/:id/trades", handleGetCharacterTrades)
+
+	// friends
+	m.Get("/friends", handleGetFriends)
+	m.Post("/friends/:action", handleFriendAction)
+
+	// parties
+	m.Get("/party", handleGetParty)
+	m.Post("/party", handleCreateParty)
+	m.Post("/party/:action", handlePartyAction)
+
+	// trades
+	m.Post("/trades", handleProposeTrade)
+	m.Post("/trades/:id/accept", handleAcceptTrade)
+	m.Post("/trades/:id/cancel", handleCancelTrade)
+
+	// items
+	m.Get("/items", handleGetItemCatalog)
+
+	// map catalog
+	m.Get("/maps", handleGetMapCatalog)
+	m.Post("/maps", handleSetMapEntry)
+	m.Delete("/maps/:name", handleDeleteMapEntry)
 
 	// games
 	m.Post("/games/register_server", handleRegisterServer)
+	m.Post("/games/unregister_server", handleUnregisterServer)
 	m.Post("/games/player_connect", handlePlayerConnect)
 	m.Post("/games/player_disconnect", handlePlayerDisconnect)
 
 	m.Post("/games/server_status", handleGameServerStatus)
+	m.Post("/games/match_result", handleMatchResult)
 
 	m.Post("/games", handleNewGameRequest)
 
@@ -49,12 +84,22 @@ func main() {
 	m.Get("/games/:id/server_info", handleGetServerInfo)
 	m.Post("/games/join_queue", handleClientJoinQueue)
 
+	// matches
+	m.Get("/matches/:id", handleGetMatch)
+
+	// world
+	m.Get("/world/regions/:x/:y", handleGetRegion)
+	m.Get("/world/map", handleGetWorldMap)
+
 	// machines
 	m.Post("/machines/register", handleRegisterMachine)
 	m.Post("/machines/status", handleMachineHeartbeat)
+	m.Post("/machines/games", handleAnnounceGames)
 	m.Post("/machines/:id/disconnect", handleUnregisterMachine)
 	m.Delete("/machines/:id", handleUnregisterMachine)
 
+	go reconcileLoop()
+
 	m.RunOnAddr(":6960")
 }
 
@@ -189,6 +234,8 @@ func handleCreateCharacter(httpReq *http.Request) (int, string) {
 		switch err.Error() {
 		case "thordb: already in use":
 			return 400, "Bad Request"
+		case "thordb: unknown class":
+			return 400, "Bad Request"
 		case "token contains an invalid number of segments":
 			return 400, "Bad Request"
 		default:
@@ -244,7 +291,10 @@ func handleGetCharacter(httpReq *http.Request) (int, string) {
 	}
 
 	character, err := thordb.GetCharacter(req.MachineKey, req.CharacterId)
-	if err != nil {
+	switch {
+	case err == thordb.ErrCharacterNotExist:
+		return 404, "Character Not Found"
+	case err != nil:
 		fmt.Println(err)
 		return 500, "Internal Server Error"
 	}
@@ -267,250 +317,1284 @@ func handleUpdateCharacter(httpReq *http.Request) (int, string) {
 		return 400, "Bad Request"
 	}
 
-	err = thordb.UpdateCharacter(req.MachineKey, req.Snapshot)
-	if err != nil {
+	if req.Snapshot == nil {
+		return 400, "Bad Request"
+	}
+
+	revision, err := thordb.UpdateCharacter(req.MachineKey, req.Snapshot)
+	switch {
+	case err == thordb.ErrRevisionConflict:
+		log.Printf("stale snapshot for character %d at revision %d", req.Snapshot.CharacterId, req.Snapshot.Revision)
+		return 409, "Conflict"
+	case err == thordb.ErrInventoryMismatch:
+		log.Printf("snapshot of character %d diverges from the inventory ledger", req.Snapshot.CharacterId)
+		return 422, "Inventory Mismatch"
+	case err == thordb.ErrUnknownClass:
+		log.Printf("snapshot of character %d has no class to progress in", req.Snapshot.CharacterId)
+		return 422, "Unknown Class"
+	case err == thordb.ErrCharacterNotExist:
+		return 404, "Character Not Found"
+	case err != nil:
 		fmt.Println(err)
 		return 500, "Internal Server Error"
 	}
 
-	return 200, "OK"
-}
+	resp := request.UpdateCharacterResponse{Revision: revision}
+	jsonBytes, err := json.Marshal(&resp)
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
 
-func handleGetCharProfile(httpReq *http.Request) (int, string) {
-	return 500, "Not Implemented"
+	return 200, string(jsonBytes)
 }
 
-func handlePlayerConnect(httpReq *http.Request) (int, string) {
+func handleGetCharacterHistory(httpReq *http.Request, params martini.Params) (int, string) {
 
-	var req request.PlayerConnect
+	characterId, err := strconv.Atoi(params["id"])
+	if err != nil {
+		return 400, "Bad Request"
+	}
+
+	var req request.CharacterHistory
 	decoder := json.NewDecoder(httpReq.Body)
-	err := decoder.Decode(&req)
+	err = decoder.Decode(&req)
 	if err != nil {
-		log.Print("join game req json decoding error %s", httpReq.Body)
+		log.Print("character history req json decoding error ", err)
 		return 400, "Bad Request"
 	}
 
-	character, err := thordb.PlayerConnect(req.GameId, req.MachineKey, req.SessionKey, req.CharacterId)
+	if !thordb.ValidateAdminKey(req.AdminKey) {
+		return 403, "Forbidden"
+	}
+
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	list, err := thordb.GetCharacterHistory(characterId, req.Limit)
+	switch {
+	case err == thordb.ErrCharacterNotExist:
+		return 404, "Character Not Found"
+	case err != nil:
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	jsonBytes, err := json.Marshal(list)
 	if err != nil {
-		fmt.Println(err)
+		log.Print(err)
 		return 500, "Internal Server Error"
 	}
 
-	resp := request.PlayerConnectResponse{Character: character}
+	return 200, string(jsonBytes)
+}
 
-	bytes, err := json.Marshal(&resp)
+// match history is public, the number of matches is set with ?limit=
+func handleGetCharacterMatches(httpReq *http.Request, params martini.Params) (int, string) {
+
+	characterId, err := strconv.Atoi(params["id"])
 	if err != nil {
+		return 400, "Bad Request"
+	}
+
+	limit := 20
+	if value := httpReq.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return 400, "Bad Request"
+		}
+		if limit > 100 {
+			limit = 100
+		}
+	}
 
+	list, err := thordb.GetCharacterMatches(characterId, limit)
+	switch {
+	case err == thordb.ErrCharacterNotExist:
+		return 404, "Character Not Found"
+	case err != nil:
 		log.Print(err)
 		return 500, "Internal Server Error"
 	}
 
-	return 200, string(bytes)
+	jsonBytes, err := json.Marshal(list)
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
 }
 
-func handlePlayerDisconnect(httpReq *http.Request) (int, string) {
+func handleInventoryOperation(httpReq *http.Request, params martini.Params) (int, string) {
 
-	var req request.PlayerDisconnect
-	decoder := json.NewDecoder(httpReq.Body)
-	err := decoder.Decode(&req)
+	characterId, err := strconv.Atoi(params["id"])
 	if err != nil {
-		log.Print("join game req json decoding error %s", httpReq.Body)
 		return 400, "Bad Request"
 	}
 
-	err = thordb.PlayerDisconnect(req.MachineKey, req.GameId, req.Snapshot)
+	var req request.InventoryOperation
+	decoder := json.NewDecoder(httpReq.Body)
+	err = decoder.Decode(&req)
 	if err != nil {
-		fmt.Println(err)
+		log.Print("inventory req json decoding error ", err)
+		return 400, "Bad Request"
+	}
+
+	var action string
+	switch params["action"] {
+	case "grant":
+		action = thordb.InventoryGrant
+	case "consume":
+		action = thordb.InventoryConsume
+	case "move":
+		action = thordb.InventoryMove
+	case "drop":
+		action = thordb.InventoryDrop
+	default:
+		return 404, "Not Found"
+	}
+
+	op := thordb.InventoryOperation{
+		Action: action,
+		ItemId: req.ItemId,
+		Count:  req.Count,
+		Slot:   req.Slot,
+		ToSlot: req.ToSlot}
+
+	items, version, err := thordb.ChangeInventory(req.MachineKey, characterId, &op)
+	switch err {
+	case nil:
+	case thordb.ErrInvalidMachineKey, thordb.ErrCharacterNotInGame:
+		return 403, "Forbidden"
+	case thordb.ErrCharacterNotExist:
+		return 404, "Character Not Found"
+	case inventory.ErrUnknownItem, inventory.ErrClassRestricted, inventory.ErrBadSlot, inventory.ErrBadCount:
+		return 400, err.Error()
+	case inventory.ErrNotEnough, inventory.ErrFull:
+		return 409, err.Error()
+	default:
+		log.Print(err)
 		return 500, "Internal Server Error"
 	}
 
-	return 200, "OK"
-}
+	jsonBytes, err := json.Marshal(&request.InventoryResponse{Inventory: items, Version: version})
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
 
-func handleClientJoinQueue(httpReq *http.Request) (int, string) {
-	return 500, "Not Implemented"
+	return 200, string(jsonBytes)
 }
 
-func handleGameServerStatus(httpReq *http.Request) (int, string) {
-	return 500, "Not Implemented"
-}
+func handleGetInventoryLog(httpReq *http.Request, params martini.Params) (int, string) {
 
-func handleGetServerList(httpReq *http.Request) (int, string) {
+	characterId, err := strconv.Atoi(params["id"])
+	if err != nil {
+		return 400, "Bad Request"
+	}
 
-	list, err := thordb.GetGamesList()
+	var req request.InventoryLog
+	decoder := json.NewDecoder(httpReq.Body)
+	err = decoder.Decode(&req)
 	if err != nil {
+		log.Print("inventory log req json decoding error ", err)
+		return 400, "Bad Request"
+	}
+
+	if !thordb.ValidateAdminKey(req.AdminKey) {
+		return 403, "Forbidden"
+	}
+
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+
+	list, err := thordb.GetInventoryLog(characterId, req.Limit)
+	switch {
+	case err == thordb.ErrCharacterNotExist:
+		return 404, "Character Not Found"
+	case err != nil:
 		log.Print(err)
 		return 500, "Internal Server Error"
 	}
 
-	bytes, err := json.Marshal(list)
+	jsonBytes, err := json.Marshal(list)
 	if err != nil {
 		log.Print(err)
 		return 500, "Internal Server Error"
 	}
 
-	return 200, string(bytes)
-}
-
-func handleGetGameInfo(httpReq *http.Request) (int, string) {
-	return 500, "Not Implemented"
+	return 200, string(jsonBytes)
 }
 
-func handleRegisterMachine(httpReq *http.Request) (int, string) {
+func handleGetItemCatalog() (int, string) {
 
-	decoder := json.NewDecoder(httpReq.Body)
-	var req request.RegisterMachine
-	err := decoder.Decode(&req)
+	catalog, err := thordb.GetItemCatalog()
 	if err != nil {
-		logerr("Error decoding machine register request", err)
+		log.Print(err)
 		return 500, "Internal Server Error"
 	}
 
-	if req.Port == 0 {
-		fmt.Println("No Port Given")
-		return 400, "Bad Request"
-	} else {
-		fmt.Println("register port = ", req.Port)
+	jsonBytes, err := json.Marshal(catalog)
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
 	}
 
-	machineIp := strings.Split(httpReq.RemoteAddr, ":")[0]
+	return 200, string(jsonBytes)
+}
 
-	var machineId int
-	var machineKey string
-	machineId, machineKey, err = thordb.RegisterMachine(machineIp, req.Port)
+func handleGetMapCatalog() (int, string) {
+
+	catalog, err := thordb.GetMapCatalog()
 	if err != nil {
-		logerr("error registering machine", err)
+		log.Print(err)
 		return 500, "Internal Server Error"
 	}
-	var response request.MachineRegisterResponse
-	response.MachineId = machineId
-	response.MachineKey = machineKey
 
-	var jsonBytes []byte
-	jsonBytes, err = json.Marshal(&response)
+	jsonBytes, err := json.Marshal(catalog)
 	if err != nil {
-		log.Print("error encoding register machine response\n", err)
+		log.Print(err)
 		return 500, "Internal Server Error"
 	}
 
 	return 200, string(jsonBytes)
 }
 
-func handleUnregisterMachine(httpReq *http.Request, params martini.Params) (int, string) {
+func handleSetMapEntry(httpReq *http.Request) (int, string) {
 
+	var req request.SetMapEntry
 	decoder := json.NewDecoder(httpReq.Body)
-	var req request.UnregisterMachine
 	err := decoder.Decode(&req)
 	if err != nil {
-		logerr("Error decoding machine unregister request", err)
+		log.Print("map entry req json decoding error ", err)
 		return 400, "Bad Request"
 	}
 
-	success, err := thordb.UnregisterMachine(req.MachineKey)
-	if err != nil {
+	if !thordb.ValidateAdminKey(req.AdminKey) {
+		return 403, "Forbidden"
+	}
+
+	err = thordb.SetMapEntry(&req.MapEntry)
+	switch {
+	case err == model.ErrBadMapEntry:
+		return 400, "Bad Map Entry"
+	case err != nil:
 		log.Print(err)
 		return 500, "Internal Server Error"
-	} else if !success {
-		logerr("unable to remove machine registry", err)
-		return 400, "Bad Request"
 	}
 
+	log.Printf("map catalog: set %s modes %v players %d/%d level %d binary %s", req.Map, req.Modes, req.DefaultPlayers, req.MaximumPlayers, req.MinimumLevel, req.Binary)
 	return 200, "OK"
 }
 
-func handleNewGameRequest(httpReq *http.Request) (int, string) {
+func handleDeleteMapEntry(httpReq *http.Request, params martini.Params) (int, string) {
 
+	var req request.DeleteMapEntry
 	decoder := json.NewDecoder(httpReq.Body)
-	var req request.CreateNewGame
 	err := decoder.Decode(&req)
 	if err != nil {
-		logerr("unable to decode body data", err)
-		return 500, "Internal Server Error"
+		log.Print("map entry req json decoding error ", err)
+		return 400, "Bad Request"
 	}
 
-	if req.Map == "" || req.GameMode == "" {
-		return 400, "Missing Parameters"
+	if !thordb.ValidateAdminKey(req.AdminKey) {
+		return 403, "Forbidden"
 	}
 
-	if req.MaxPlayers == 0 || req.MaxPlayers > 64 {
-		req.MaxPlayers = 16
-		// use default in extreme cases
+	err = thordb.DeleteMapEntry(params["name"])
+	switch {
+	case err == thordb.ErrUnknownMap:
+		return 404, "Map Not Found"
+	case err != nil:
+		log.Print(err)
+		return 500, "Internal Server Error"
 	}
 
-	// validate token
-
-	var gameId int
-	gameId, err = thordb.CreateNewGame(req.Map, req.GameMode, req.MinimumLevel, req.MaxPlayers)
-	if err != nil {
+	log.Printf("map catalog: deleted %s", params["name"])
+	return 200, "OK"
+}
 
-		fmt.Println(err)
+func handleGetInventory(httpReq *http.Request, params martini.Params) (int, string) {
 
-		switch err.Error() {
+	characterId, err := strconv.Atoi(params["id"])
+	if err != nil {
+		return 400, "Bad Request"
+	}
 
-		case "thordb: no available servers":
-			return 503, "No Available Servers"
-		default:
-			return 500, "Internal Server Error"
-		}
+	var req request.GetInventory
+	decoder := json.NewDecoder(httpReq.Body)
+	err = decoder.Decode(&req)
+	if err != nil {
+		log.Print("inventory req json decoding error ", err)
+		return 400, "Bad Request"
+	}
 
+	items, version, err := thordb.GetInventory(req.MachineKey, characterId)
+	switch err {
+	case nil:
+	case thordb.ErrInvalidMachineKey, thordb.ErrCharacterNotInGame:
+		return 403, "Forbidden"
+	case thordb.ErrCharacterNotExist:
+		return 404, "Character Not Found"
+	default:
+		log.Print(err)
+		return 500, "Internal Server Error"
 	}
 
-	response := request.CreateNewGameResponse{GameId: gameId}
-	bytes, err := json.Marshal(&response)
+	jsonBytes, err := json.Marshal(&request.InventoryResponse{Inventory: items, Version: version})
 	if err != nil {
-
-		fmt.Println(err)
+		log.Print(err)
 		return 500, "Internal Server Error"
 	}
 
-	fmt.Println("[ThoriumNET] new game, id=", strconv.Itoa(gameId))
-	return 201, string(bytes)
+	return 200, string(jsonBytes)
 }
 
-func handleRegisterServer(httpReq *http.Request, params martini.Params) (int, string) {
+func handleProposeTrade(httpReq *http.Request) (int, string) {
 
+	var req request.ProposeTrade
 	decoder := json.NewDecoder(httpReq.Body)
-	var req request.RegisterGameServer
 	err := decoder.Decode(&req)
 	if err != nil {
+		log.Print("trade req json decoding error ", err)
+		return 400, "Bad Request"
+	}
 
-		logerr("Error decoding machine register request", err)
-		return 500, "Internal Server Error"
+	result, err := thordb.ProposeTrade(req.SessionKey, req.FromCharacterId, req.ToCharacterId, req.Offer, req.Request)
+	return tradeResponse(result, err)
+}
+
+func handleAcceptTrade(httpReq *http.Request, params martini.Params) (int, string) {
+
+	tradeId, req, ok := decodeTradeAction(httpReq, params)
+	if !ok {
+		return 400, "Bad Request"
 	}
 
-	if req.Port == 0 {
+	result, err := thordb.AcceptTrade(req.SessionKey, tradeId, req.CharacterId)
+	return tradeResponse(result, err)
+}
 
-		fmt.Println("No Port Given")
-		return 400, "Missing Parameters"
+func handleCancelTrade(httpReq *http.Request, params martini.Params) (int, string) {
+
+	tradeId, req, ok := decodeTradeAction(httpReq, params)
+	if !ok {
+		return 400, "Bad Request"
 	}
 
-	err = thordb.RegisterActiveGame(req.GameId, req.MachineKey, req.Port)
+	result, err := thordb.CancelTrade(req.SessionKey, tradeId, req.CharacterId)
+	return tradeResponse(result, err)
+}
+
+func decodeTradeAction(httpReq *http.Request, params martini.Params) (int, *request.TradeAction, bool) {
+
+	tradeId, err := strconv.Atoi(params["id"])
 	if err != nil {
+		return 0, nil, false
+	}
 
-		fmt.Println(err)
+	var req request.TradeAction
+	decoder := json.NewDecoder(httpReq.Body)
+	err = decoder.Decode(&req)
+	if err != nil {
+		log.Print("trade req json decoding error ", err)
+		return 0, nil, false
+	}
+
+	return tradeId, &req, true
+}
+
+// tradeResponse maps the errors of a trade step to status codes.
+func tradeResponse(result *model.Trade, err error) (int, string) {
+
+	switch err {
+	case nil:
+	case thordb.ErrInvalidSessionKey, thordb.ErrNotCharacterOwner, trade.ErrNotParty:
+		return 403, "Forbidden"
+	case thordb.ErrCharacterNotExist:
+		return 404, "Character Not Found"
+	case trade.ErrTradeNotExist:
+		return 404, "Trade Not Found"
+	case trade.ErrSameCharacter, trade.ErrEmpty, trade.ErrNotTradable,
+		inventory.ErrUnknownItem, inventory.ErrClassRestricted, inventory.ErrBadCount:
+		return 400, err.Error()
+	case trade.ErrNotPending, trade.ErrOffline, inventory.ErrNotEnough, inventory.ErrFull:
+		return 409, err.Error()
+	default:
+		log.Print(err)
 		return 500, "Internal Server Error"
 	}
 
-	return 200, "OK"
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
 }
 
-func handleMachineHeartbeat(httpReq *http.Request) (int, string) {
+func handleGetCharacterTrades(httpReq *http.Request, params martini.Params) (int, string) {
+
+	characterId, err := strconv.Atoi(params["id"])
+	if err != nil {
+		return 400, "Bad Request"
+	}
 
+	var req request.CharacterTrades
 	decoder := json.NewDecoder(httpReq.Body)
-	var req request.MachineStatus
-	err := decoder.Decode(&req)
-	if err != nil || req.MachineKey == "" {
-		log.Print("bad json request", httpReq.Body)
+	err = decoder.Decode(&req)
+	if err != nil {
+		log.Print("trade req json decoding error ", err)
 		return 400, "Bad Request"
 	}
 
-	err = thordb.UpdateMachineStatus(req.MachineKey, req.UsageCPU, req.UsageNetwork, req.PlayerCapacity)
+	limit := req.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	list, err := thordb.GetCharacterTrades(req.SessionKey, characterId, limit)
+	switch err {
+	case nil:
+	case thordb.ErrInvalidSessionKey, thordb.ErrNotCharacterOwner:
+		return 403, "Forbidden"
+	case thordb.ErrCharacterNotExist:
+		return 404, "Character Not Found"
+	default:
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	jsonBytes, err := json.Marshal(list)
 	if err != nil {
 		log.Print(err)
 		return 500, "Internal Server Error"
 	}
 
-	return 200, "OK"
+	return 200, string(jsonBytes)
+}
+
+func handleRestoreCharacter(httpReq *http.Request, params martini.Params) (int, string) {
+
+	characterId, err := strconv.Atoi(params["id"])
+	if err != nil {
+		return 400, "Bad Request"
+	}
+
+	var req request.RestoreCharacter
+	decoder := json.NewDecoder(httpReq.Body)
+	err = decoder.Decode(&req)
+	if err != nil {
+		log.Print("character restore req json decoding error ", err)
+		return 400, "Bad Request"
+	}
+
+	if !thordb.ValidateAdminKey(req.AdminKey) {
+		return 403, "Forbidden"
+	}
+
+	revision, err := thordb.RestoreCharacter(characterId, req.Revision)
+	switch {
+	case err == thordb.ErrCharacterNotExist:
+		return 404, "Revision Not Found"
+	case err != nil:
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	log.Printf("restored character %d to revision %d as revision %d", characterId, req.Revision, revision)
+
+	resp := request.UpdateCharacterResponse{Revision: revision}
+	jsonBytes, err := json.Marshal(&resp)
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
+}
+
+func handleGetCharProfile(httpReq *http.Request) (int, string) {
+	return 500, "Not Implemented"
+}
+
+func handlePlayerConnect(httpReq *http.Request) (int, string) {
+
+	var req request.PlayerConnect
+	decoder := json.NewDecoder(httpReq.Body)
+	err := decoder.Decode(&req)
+	if err != nil {
+		log.Print("join game req json decoding error %s", httpReq.Body)
+		return 400, "Bad Request"
+	}
+
+	character, err := thordb.PlayerConnect(req.GameId, req.MachineKey, req.SessionKey, req.CharacterId)
+	if err != nil {
+		fmt.Println(err)
+		return 500, "Internal Server Error"
+	}
+
+	resp := request.PlayerConnectResponse{Character: character}
+
+	bytes, err := json.Marshal(&resp)
+	if err != nil {
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(bytes)
+}
+
+func handlePlayerDisconnect(httpReq *http.Request) (int, string) {
+
+	var req request.PlayerDisconnect
+	decoder := json.NewDecoder(httpReq.Body)
+	err := decoder.Decode(&req)
+	if err != nil {
+		log.Print("join game req json decoding error %s", httpReq.Body)
+		return 400, "Bad Request"
+	}
+
+	if req.Snapshot == nil {
+		return 400, "Bad Request"
+	}
+
+	err = thordb.PlayerDisconnect(req.MachineKey, req.GameId, req.Snapshot)
+	switch {
+	case err == thordb.ErrRevisionConflict:
+		log.Printf("stale disconnect snapshot for character %d at revision %d", req.Snapshot.CharacterId, req.Snapshot.Revision)
+		return 409, "Conflict"
+	case err == thordb.ErrInventoryMismatch:
+		log.Printf("disconnect snapshot of character %d diverges from the inventory ledger", req.Snapshot.CharacterId)
+		return 422, "Inventory Mismatch"
+	case err == thordb.ErrUnknownClass:
+		log.Printf("disconnect snapshot of character %d has no class to progress in", req.Snapshot.CharacterId)
+		return 422, "Unknown Class"
+	case err == thordb.ErrCharacterNotExist:
+		return 404, "Character Not Found"
+	case err != nil:
+		fmt.Println(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, "OK"
+}
+
+func handleClientJoinQueue(httpReq *http.Request) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.JoinGame
+	err := decoder.Decode(&req)
+	if err != nil {
+
+		logerr("Error decoding join game request", err)
+		return 400, "Bad Request"
+	}
+
+	host, running, err := thordb.JoinGame(req.SessionKey, req.GameId, req.FriendId)
+	switch {
+
+	case err == thordb.ErrInvalidSessionKey, err == thordb.ErrNotFriends, err == thordb.ErrNotPartyLeader:
+
+		return 403, "Forbidden"
+
+	case err == thordb.ErrGameNotExist:
+
+		return 404, "Game Not Found"
+
+	case err == thordb.ErrFriendNotInGame:
+
+		return 404, "Friend Not In Game"
+
+	case err == thordb.ErrGameFull:
+
+		return 409, "Game Full"
+
+	case err != nil:
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	if !running {
+
+		return 202, "Accepted"
+	}
+
+	data := request.JoinGameResponse{
+		RemoteAddress: host.RemoteAddress,
+		ListenPort:    host.ListenPort}
+
+	jsonBytes, err := json.Marshal(&data)
+	if err != nil {
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
+}
+
+func handleGetParty(httpReq *http.Request) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.GetParty
+	err := decoder.Decode(&req)
+	if err != nil {
+
+		logerr("Error decoding party request", err)
+		return 400, "Bad Request"
+	}
+
+	party, err := thordb.GetParty(req.SessionKey)
+	return partyResponse(party, err)
+}
+
+func handleCreateParty(httpReq *http.Request) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.GetParty
+	err := decoder.Decode(&req)
+	if err != nil {
+
+		logerr("Error decoding party request", err)
+		return 400, "Bad Request"
+	}
+
+	party, err := thordb.CreateParty(req.SessionKey)
+	return partyResponse(party, err)
+}
+
+func handlePartyAction(httpReq *http.Request, params martini.Params) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.PartyAction
+	err := decoder.Decode(&req)
+	if err != nil {
+
+		logerr("Error decoding party request", err)
+		return 400, "Bad Request"
+	}
+
+	switch params["action"] {
+	case "invite":
+		err = thordb.InviteToParty(req.SessionKey, req.UserId, req.Username)
+	case "accept":
+		party, err := thordb.AcceptPartyInvite(req.SessionKey, req.PartyId)
+		return partyResponse(party, err)
+	case "leave":
+		err = thordb.LeaveParty(req.SessionKey)
+	case "kick":
+		err = thordb.KickFromParty(req.SessionKey, req.UserId)
+	default:
+		return 404, "Not Found"
+	}
+
+	if err != nil {
+		return partyResponse(nil, err)
+	}
+
+	return 200, "OK"
+}
+
+// partyResponse maps party errors to status codes and adds the server of
+// the party's game once it is running.
+func partyResponse(party *model.Party, err error) (int, string) {
+
+	switch {
+
+	case err == nil:
+
+	case err == thordb.ErrInvalidSessionKey, err == thordb.ErrNotPartyLeader, err == thordb.ErrFriendBlocked:
+
+		return 403, "Forbidden"
+
+	case err == thordb.ErrPartyNotExist, err == thordb.ErrNotInParty:
+
+		return 404, "Party Not Found"
+
+	case err == thordb.ErrAccountNotExist:
+
+		return 404, "Account Not Found"
+
+	case err == thordb.ErrNoPartyInvite:
+
+		return 404, "Party Invite Not Found"
+
+	case err == thordb.ErrSelfFriend:
+
+		return 400, "Bad Request"
+
+	case err == thordb.ErrAlreadyInParty, err == thordb.ErrPartyFull:
+
+		return 409, err.Error()
+
+	default:
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	data := request.PartyResponse{Party: *party}
+
+	if party.GameId != 0 {
+
+		host, running, err := thordb.GetServerInfo(party.GameId)
+		switch {
+		case err == thordb.GameNotExistError:
+		case err != nil:
+			log.Print(err)
+			return 500, "Internal Server Error"
+		case running:
+			data.Join = &request.JoinGameResponse{
+				RemoteAddress: host.RemoteAddress,
+				ListenPort:    host.ListenPort}
+		}
+	}
+
+	jsonBytes, err := json.Marshal(&data)
+	if err != nil {
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
+}
+
+func handleGetFriends(httpReq *http.Request) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.GetFriends
+	err := decoder.Decode(&req)
+	if err != nil {
+
+		logerr("Error decoding friends request", err)
+		return 400, "Bad Request"
+	}
+
+	list, err := thordb.GetFriends(req.SessionKey)
+	switch {
+
+	case err == thordb.ErrInvalidSessionKey:
+
+		return 403, "Forbidden"
+
+	case err != nil:
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	jsonBytes, err := json.Marshal(list)
+	if err != nil {
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
+}
+
+func handleFriendAction(httpReq *http.Request, params martini.Params) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.FriendAction
+	err := decoder.Decode(&req)
+	if err != nil {
+
+		logerr("Error decoding friend request", err)
+		return 400, "Bad Request"
+	}
+
+	switch params["action"] {
+	case "request":
+		err = thordb.RequestFriend(req.SessionKey, req.UserId, req.Username)
+	case "accept":
+		err = thordb.AcceptFriend(req.SessionKey, req.UserId)
+	case "remove":
+		err = thordb.RemoveFriend(req.SessionKey, req.UserId)
+	case "block":
+		err = thordb.BlockFriend(req.SessionKey, req.UserId, req.Username)
+	default:
+		return 404, "Not Found"
+	}
+
+	switch {
+
+	case err == nil:
+
+		return 200, "OK"
+
+	case err == thordb.ErrInvalidSessionKey, err == thordb.ErrFriendBlocked:
+
+		return 403, "Forbidden"
+
+	case err == thordb.ErrAccountNotExist:
+
+		return 404, "Account Not Found"
+
+	case err == thordb.ErrNoFriendRequest:
+
+		return 404, "Friend Request Not Found"
+
+	case err == thordb.ErrSelfFriend:
+
+		return 400, "Bad Request"
+
+	case err == thordb.ErrAlreadyFriends:
+
+		return 409, "Already Friends"
+
+	default:
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+}
+
+func handleGameServerStatus(httpReq *http.Request) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.GameServerStatus
+	err := decoder.Decode(&req)
+	if err != nil {
+
+		logerr("Error decoding game server status", err)
+		return 400, "Bad Request"
+	}
+
+	err = thordb.SetGameServerStatus(req.MachineKey, req.GameId, &req.Status)
+	switch {
+
+	case err == thordb.ErrInvalidMachineKey:
+
+		return 403, "Invalid Key"
+
+	case err == thordb.ErrGameNotExist:
+
+		return 404, "Game Not Found"
+
+	case err == thordb.ErrBadGameStatus:
+
+		return 400, "Bad Request"
+
+	case err != nil:
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, "OK"
+}
+
+func handleMatchResult(httpReq *http.Request) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.MatchResult
+	err := decoder.Decode(&req)
+	if err != nil {
+
+		logerr("Error decoding match result", err)
+		return 400, "Bad Request"
+	}
+
+	matchId, err := thordb.RecordMatch(&req)
+	switch {
+
+	case err == thordb.ErrInvalidMachineKey:
+
+		return 403, "Invalid Key"
+
+	case err == thordb.ErrGameNotExist:
+
+		return 404, "Game Not Found"
+
+	case err == thordb.ErrBadMatchResult:
+
+		return 400, "Bad Request"
+
+	case err != nil:
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	jsonBytes, err := json.Marshal(&request.MatchResultResponse{MatchId: matchId})
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
+}
+
+func handleGetMatch(params martini.Params) (int, string) {
+
+	matchId, err := strconv.Atoi(params["id"])
+	if err != nil {
+		return 400, "Bad Request"
+	}
+
+	match, err := thordb.GetMatch(matchId)
+	switch {
+	case err == thordb.ErrMatchNotExist:
+		return 404, "Match Not Found"
+	case err != nil:
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	jsonBytes, err := json.Marshal(match)
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
+}
+
+// handleGetServerList answers with a bare array of games. The cursor of
+// the next page, if any, is sent in the X-Next-Cursor header.
+func handleGetServerList(httpReq *http.Request, w http.ResponseWriter) (int, string) {
+
+	query, err := request.ParseGameListQuery(httpReq.URL.Query())
+	if err != nil {
+		return 400, "Bad Request"
+	}
+
+	list, cursor, err := thordb.GetGamesList(query)
+	switch {
+	case err == request.ErrBadQuery:
+		return 400, "Bad Request"
+	case err != nil:
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	bytes, err := json.Marshal(list)
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	if cursor != "" {
+		w.Header().Set(request.NextCursorHeader, cursor)
+	}
+
+	return 200, string(bytes)
+}
+
+func handleGetGameInfo(params martini.Params) (int, string) {
+
+	gameId, err := strconv.Atoi(params["id"])
+	if err != nil {
+		return 400, "Bad Request"
+	}
+
+	game, err := thordb.GetGameDetail(gameId)
+	switch {
+	case err == thordb.ErrGameNotExist:
+		return 404, "Game Not Found"
+	case err != nil:
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	bytes, err := json.Marshal(game)
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(bytes)
+}
+
+func handleRegisterMachine(httpReq *http.Request) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.RegisterMachine
+	err := decoder.Decode(&req)
+	if err != nil {
+		logerr("Error decoding machine register request", err)
+		return 500, "Internal Server Error"
+	}
+
+	if req.Port == 0 {
+		fmt.Println("No Port Given")
+		return 400, "Bad Request"
+	} else {
+		fmt.Println("register port = ", req.Port)
+	}
+
+	machineIp := strings.Split(httpReq.RemoteAddr, ":")[0]
+	log.Printf("machine %s:%d registers profiles %v", machineIp, req.Port, req.Profiles)
+
+	var machineId int
+	var machineKey string
+	machineId, machineKey, err = thordb.RegisterMachine(machineIp, req.Port, req.Region, req.Profiles)
+	if err != nil {
+		logerr("error registering machine", err)
+		return 500, "Internal Server Error"
+	}
+	var response request.MachineRegisterResponse
+	response.MachineId = machineId
+	response.MachineKey = machineKey
+
+	var jsonBytes []byte
+	jsonBytes, err = json.Marshal(&response)
+	if err != nil {
+		log.Print("error encoding register machine response\n", err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
+}
+
+func handleUnregisterMachine(httpReq *http.Request, params martini.Params) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.UnregisterMachine
+	err := decoder.Decode(&req)
+	if err != nil {
+		logerr("Error decoding machine unregister request", err)
+		return 400, "Bad Request"
+	}
+
+	success, err := thordb.UnregisterMachine(req.MachineKey)
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
+	} else if !success {
+		logerr("unable to remove machine registry", err)
+		return 400, "Bad Request"
+	}
+
+	return 200, "OK"
+}
+
+func handleNewGameRequest(httpReq *http.Request) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.CreateNewGame
+	err := decoder.Decode(&req)
+	if err != nil {
+		logerr("unable to decode body data", err)
+		return 500, "Internal Server Error"
+	}
+
+	if req.Map == "" || req.GameMode == "" {
+		return 400, "Missing Parameters"
+	}
+
+	// validate token
+
+	var gameId int
+	gameId, err = thordb.CreateNewGame(req.Map, req.GameMode, req.MinimumLevel, req.MaxPlayers, req.WorldRegion)
+	if err != nil {
+
+		fmt.Println(err)
+
+		switch {
+		case err == thordb.ErrUnknownMap:
+			return 400, "Unknown Map"
+		case err == model.ErrModeNotAllowed:
+			return 400, "Mode Not Allowed"
+		case err == model.ErrTooManyPlayers:
+			return 400, "Too Many Players"
+		case err == thordb.ErrWorldRegion:
+			return 400, "Bad World Region"
+		case err == thordb.ErrRegionOutOfBounds:
+			return 400, "Region Out Of Bounds"
+		case err.Error() == "thordb: no available servers":
+			return 503, "No Available Servers"
+		default:
+			return 500, "Internal Server Error"
+		}
+
+	}
+
+	response := request.CreateNewGameResponse{GameId: gameId}
+	bytes, err := json.Marshal(&response)
+	if err != nil {
+
+		fmt.Println(err)
+		return 500, "Internal Server Error"
+	}
+
+	fmt.Println("[ThoriumNET] new game, id=", strconv.Itoa(gameId))
+	return 201, string(bytes)
+}
+
+func handleRegisterServer(httpReq *http.Request, params martini.Params) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.RegisterGameServer
+	err := decoder.Decode(&req)
+	if err != nil {
+
+		logerr("Error decoding machine register request", err)
+		return 500, "Internal Server Error"
+	}
+
+	if req.Port == 0 {
+
+		fmt.Println("No Port Given")
+		return 400, "Missing Parameters"
+	}
+
+	err = thordb.RegisterActiveGame(req.GameId, req.MachineKey, req.Port)
+	if err != nil {
+
+		fmt.Println(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, "OK"
+}
+
+func handleUnregisterServer(httpReq *http.Request) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.UnregisterGameServer
+	err := decoder.Decode(&req)
+	if err != nil {
+
+		logerr("Error decoding game server unregister request", err)
+		return 400, "Bad Request"
+	}
+
+	err = thordb.UnregisterActiveGame(req.GameId, req.MachineKey)
+	switch {
+
+	case err == thordb.ErrGameNotExist:
+
+		return 404, "Game Not Found"
+
+	case err != nil:
+
+		fmt.Println(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, "OK"
+}
+
+func handleMachineHeartbeat(httpReq *http.Request) (int, string) {
+
+	decoder := json.NewDecoder(httpReq.Body)
+	var req request.MachineStatus
+	err := decoder.Decode(&req)
+	if err != nil || req.MachineKey == "" {
+		log.Print("bad json request", httpReq.Body)
+		return 400, "Bad Request"
+	}
+
+	err = thordb.UpdateMachineStatus(req.MachineKey, req.UsageCPU, req.UsageNetwork, req.PlayerCapacity)
+	switch {
+	case err == thordb.ErrInvalidMachineKey:
+		// the host registers again when it sees this
+		return 401, "Invalid Key"
+	case err != nil:
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, "OK"
+}
+
+func handleAnnounceGames(httpReq *http.Request) (int, string) {
+
+	var req request.AnnounceGames
+	decoder := json.NewDecoder(httpReq.Body)
+	err := decoder.Decode(&req)
+	if err != nil {
+		log.Print("announce games req json decoding error ", err)
+		return 400, "Bad Request"
+	}
+
+	resp, err := thordb.AnnounceGames(req.MachineKey, req.Games)
+	switch {
+	case err == thordb.ErrInvalidMachineKey:
+		return 401, "Invalid Key"
+	case err != nil:
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
+}
+
+func handleGetRegion(params martini.Params) (int, string) {
+
+	var coord generate.Coordinate2D
+	var err error
+
+	coord.X, err = strconv.Atoi(params["x"])
+	if err != nil {
+		return 400, "Bad Request"
+	}
+
+	coord.Y, err = strconv.Atoi(params["y"])
+	if err != nil {
+		return 400, "Bad Request"
+	}
+
+	region, err := thordb.GetRegion(coord)
+	switch {
+
+	case err == thordb.ErrRegionOutOfBounds:
+
+		return 404, "Region Not Found"
+
+	case err != nil:
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	jsonBytes, err := json.Marshal(region)
+	if err != nil {
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
+}
+
+// handleGetWorldMap returns region ownership for spiral indices from
+// ?from= to ?to=, both included.
+func handleGetWorldMap(httpReq *http.Request) (int, string) {
+
+	query := httpReq.URL.Query()
+
+	first, err := strconv.Atoi(query.Get("from"))
+	if err != nil || first < 0 {
+		return 400, "Bad Request"
+	}
+
+	last, err := strconv.Atoi(query.Get("to"))
+	if err != nil || last < first {
+		return 400, "Bad Request"
+	}
+
+	list, err := thordb.GetWorldMap(first, last)
+	if err != nil {
+
+		log.Print(err)
+		return 500, "Internal Server Error"
+	}
+
+	jsonBytes, err := json.Marshal(list)
+	if err != nil {
+		return 500, "Internal Server Error"
+	}
+
+	return 200, string(jsonBytes)
 }
 
 func handleGetServerInfo(params martini.Params) (int, string) {
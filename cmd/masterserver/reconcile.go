@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/client"
+	"github.com/jaybennett89/thorium-go/database"
+	"github.com/jaybennett89/thorium-go/globals"
+	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/requests"
+)
+
+// reconcileLoop brings the games database back in line with what the
+// hosts run, after the master crashed mid-request or the database was
+// restored from a backup.
+func reconcileLoop() {
+
+	for range time.Tick(time.Second * globals.RECONCILE_INTERVAL_SECONDS) {
+		reconcile()
+	}
+}
+
+func reconcile() {
+
+	machines, err := thordb.GetMachineList()
+	if err != nil {
+		logerr("reconcile: couldn't list machines", err)
+		return
+	}
+
+	for _, machine := range machines {
+		reconcileMachine(&machine)
+	}
+
+	unhealthy, err := thordb.GetUnhealthyGames()
+	if err != nil {
+		logerr("reconcile: couldn't list unhealthy games", err)
+		return
+	}
+
+	if len(unhealthy) > 0 {
+		log.Print("reconcile: games without a recent status report: ", unhealthy)
+	}
+
+	endStaleGames(machines)
+}
+
+// endStaleGames stops and ends the games that stayed unhealthy past the
+// grace period. Their gameservers hung or lost the host, so they would
+// otherwise hold their players and reservations forever.
+func endStaleGames(machines []model.Machine) {
+
+	grace := time.Second * globals.UNHEALTHY_GAME_SECONDS
+	stale, err := thordb.GetStaleGames(grace)
+	if err != nil {
+		logerr("reconcile: couldn't list stale games", err)
+		return
+	}
+
+	byId := make(map[int]*model.Machine)
+	for i := range machines {
+		byId[machines[i].MachineId] = &machines[i]
+	}
+
+	for _, game := range stale {
+
+		// a game whose gameserver keeps running after it is ended is
+		// stopped when its machine is next reconciled
+		machine, ok := byId[game.MachineId]
+		if ok {
+
+			endpoint := fmt.Sprintf("%s:%d", machine.RemoteAddress, machine.ListenPort)
+			rc, body, err := client.StopHostGame(endpoint, machine.MachineKey, game.GameId)
+			switch {
+			case err != nil:
+				log.Printf("reconcile: couldn't stop stale game %d on machine %d: %v", game.GameId, game.MachineId, err)
+			case rc != 200 && rc != 404:
+				log.Printf("reconcile: machine %d answered %d stopping stale game %d: %s", game.MachineId, rc, game.GameId, body)
+			}
+		}
+
+		ended, err := thordb.EndStaleGame(game.GameId, grace)
+		if err != nil {
+			logerr(fmt.Sprintf("reconcile: couldn't end stale game %d", game.GameId), err)
+			continue
+		}
+
+		if ended {
+			log.Printf("reconcile: ended game %d on machine %d, no status report for %v", game.GameId, game.MachineId, grace)
+		}
+	}
+}
+
+func reconcileMachine(machine *model.Machine) {
+
+	endpoint := fmt.Sprintf("%s:%d", machine.RemoteAddress, machine.ListenPort)
+	rc, body, err := client.GetHostGames(endpoint, machine.MachineKey)
+	if err != nil {
+		log.Printf("reconcile: machine %d unreachable: %v", machine.MachineId, err)
+		return
+	}
+
+	if rc != 200 {
+		log.Printf("reconcile: machine %d answered %d: %s", machine.MachineId, rc, body)
+		return
+	}
+
+	var inventory request.HostGamesResponse
+	err = json.Unmarshal([]byte(body), &inventory)
+	if err != nil {
+		logerr(fmt.Sprintf("reconcile: unreadable inventory of machine %d", machine.MachineId), err)
+		return
+	}
+
+	result, err := thordb.ReconcileMachine(machine.MachineId, inventory.Games, time.Second*globals.RECONCILE_GRACE_SECONDS)
+	if err != nil {
+		logerr(fmt.Sprintf("reconcile: machine %d", machine.MachineId), err)
+		return
+	}
+
+	for _, gameId := range result.Stop {
+
+		rc, body, err = client.StopHostGame(endpoint, machine.MachineKey, gameId)
+		switch {
+		case err != nil:
+			log.Printf("reconcile: couldn't stop game %d on machine %d: %v", gameId, machine.MachineId, err)
+		case rc != 200:
+			log.Printf("reconcile: machine %d answered %d stopping game %d: %s", machine.MachineId, rc, gameId, body)
+		default:
+			log.Printf("reconcile: stopped game %d on machine %d", gameId, machine.MachineId)
+		}
+	}
+
+	if len(result.Adopted)+len(result.Ended)+len(result.Stop) > 0 {
+		log.Printf("reconcile: machine %d adopted %v, ended %v, stopped %v", machine.MachineId, result.Adopted, result.Ended, result.Stop)
+	}
+}
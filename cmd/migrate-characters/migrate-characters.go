@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/jaybennett89/thorium-go/database"
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+// Upgrades the game data of all characters to the current schema version.
+// Characters are also upgraded when they are loaded, so this only has to
+// run before an upgrade function is removed. Run it from the project root
+// next to the master, since it uses the same keys and database settings.
+
+func main() {
+
+	batchSize := flag.Int("batch", 500, "characters read per query")
+	dryRun := flag.Bool("dry-run", false, "count characters that need an upgrade without writing them")
+	flag.Parse()
+
+	log.Printf("migrating characters to schema version %d", model.CharacterSchemaVersion)
+
+	result, err := thordb.MigrateCharacters(*batchSize, *dryRun)
+	if result != nil {
+		log.Printf("checked %d, migrated %d, conflicts %d, failed %d", result.Checked, result.Migrated, result.Conflicts, result.Failed)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if result.Conflicts > 0 || result.Failed > 0 {
+		log.Fatal("some characters were not migrated, run again to retry")
+	}
+}
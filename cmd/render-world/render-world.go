@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+
+	"github.com/jaybennett89/thorium-go/generate"
+)
+
+// Renders the regions of a world seed around a grid coordinate so the
+// layout can be previewed without a master or gameserver. The master's
+// seed is kept in the worlds table.
+//
+//	render-world -seed 42 -radius 1 -format png -out world.png
+
+var symbols = map[generate.NodeType]byte{
+	generate.NodeFortress: 'X',
+	generate.NodeTown:     't',
+	generate.NodeOutpost:  '^',
+}
+
+var colors = map[generate.NodeType]color.RGBA{
+	generate.NodeFortress: {R: 230, G: 230, B: 230, A: 255},
+	generate.NodeTown:     {R: 240, G: 200, B: 60, A: 255},
+	generate.NodeOutpost:  {R: 220, G: 110, B: 40, A: 255},
+}
+
+var background = color.RGBA{R: 40, G: 70, B: 45, A: 255}
+var border = color.RGBA{R: 20, G: 20, B: 20, A: 255}
+
+func main() {
+
+	seed := flag.Int64("seed", 1, "world seed")
+	x := flag.Int("x", 0, "grid x of the center region")
+	y := flag.Int("y", 0, "grid y of the center region")
+	radius := flag.Int("radius", 0, "regions to render on each side of the center")
+	format := flag.String("format", "ascii", "output format: ascii, json or png")
+	scale := flag.Int("scale", 8, "pixels per cell for png")
+	out := flag.String("out", "", "output file, stdout if empty")
+	flag.Parse()
+
+	if *radius < 0 || *scale < 1 {
+		log.Fatal("radius must be 0 or more and scale 1 or more")
+	}
+
+	// rows of regions, top row first since y points up
+	size := 2**radius + 1
+	grid := make([][]*generate.Region, size)
+	for row := 0; row < size; row++ {
+		grid[row] = make([]*generate.Region, size)
+		for col := 0; col < size; col++ {
+			coord := generate.Coordinate2D{X: *x - *radius + col, Y: *y + *radius - row}
+			grid[row][col] = generate.GenerateRegion(*seed, coord, &generate.DefaultConfig)
+		}
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	var err error
+	switch *format {
+	case "ascii":
+		err = renderASCII(w, grid)
+	case "json":
+		err = renderJSON(w, grid)
+	case "png":
+		err = png.Encode(w, renderImage(grid, *scale))
+	default:
+		log.Fatalf("unknown format %q", *format)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// renderASCII draws every region as a block of cells, with regions of a
+// row side by side and a blank line between rows.
+func renderASCII(w io.Writer, grid [][]*generate.Region) error {
+
+	buf := bufio.NewWriter(w)
+	width := generate.DefaultConfig.RegionWidth
+
+	for i, row := range grid {
+
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+
+		areas := make([]*generate.Area, len(row))
+		for j, region := range row {
+			areas[j] = region.Area()
+		}
+
+		for cy := width - 1; cy >= 0; cy-- {
+			for j, area := range areas {
+				if j > 0 {
+					buf.WriteByte(' ')
+				}
+				for cx := 0; cx < width; cx++ {
+					symbol := byte('.')
+					node, ok := area.At(generate.Coordinate2D{X: cx, Y: cy})
+					if ok {
+						symbol = symbols[node.Type]
+					}
+					buf.WriteByte(symbol)
+				}
+			}
+			buf.WriteByte('\n')
+		}
+	}
+
+	return buf.Flush()
+}
+
+func renderJSON(w io.Writer, grid [][]*generate.Region) error {
+
+	regions := make([]*generate.Region, 0)
+	for _, row := range grid {
+		regions = append(regions, row...)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(regions)
+}
+
+// renderImage draws every cell as a scale sized square, with a one pixel
+// border around each region.
+func renderImage(grid [][]*generate.Region, scale int) image.Image {
+
+	width := generate.DefaultConfig.RegionWidth
+	block := width*scale + 1
+	size := len(grid)*block + 1
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for py := 0; py < size; py++ {
+		for px := 0; px < size; px++ {
+			img.SetRGBA(px, py, border)
+		}
+	}
+
+	for i, row := range grid {
+		for j, region := range row {
+
+			area := region.Area()
+			left := j*block + 1
+			top := i*block + 1
+
+			for cy := 0; cy < width; cy++ {
+				for cx := 0; cx < width; cx++ {
+
+					c := background
+					node, ok := area.At(generate.Coordinate2D{X: cx, Y: cy})
+					if ok {
+						c = colors[node.Type]
+					}
+
+					// flip y so it points up like the ascii output
+					y0 := top + (width-1-cy)*scale
+					x0 := left + cx*scale
+					for py := y0; py < y0+scale; py++ {
+						for px := x0; px < x0+scale; px++ {
+							img.SetRGBA(px, py, c)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return img
+}
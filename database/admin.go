@@ -0,0 +1,31 @@
+package thordb
+
+import (
+	"crypto/subtle"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+)
+
+const adminKeyPath string = "keys/admin.key"
+
+var adminKey string
+var adminKeyOnce sync.Once
+
+// ValidateAdminKey checks the key sent with support and admin requests
+// against keys/admin.key. Admin requests are refused if the file is
+// missing or empty.
+func ValidateAdminKey(key string) bool {
+
+	adminKeyOnce.Do(func() {
+		keyBytes, err := ioutil.ReadFile(adminKeyPath)
+		if err != nil {
+			log.Print("admin requests disabled: ", err)
+			return
+		}
+		adminKey = strings.TrimSpace(string(keyBytes))
+	})
+
+	return adminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) == 1
+}
@@ -0,0 +1,101 @@
+package thordb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+var ErrUnknownMap = errors.New("thordb: map is not in the catalog")
+
+// GetMapCatalog lists every map games can be created on.
+func GetMapCatalog() ([]model.MapEntry, error) {
+
+	rows, err := db.Query("SELECT map_name, modes, default_players, maximum_players, minimum_level, gameserver_binary FROM map_catalog ORDER BY map_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	catalog := make([]model.MapEntry, 0)
+	for rows.Next() {
+		entry, err := scanMapEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		catalog = append(catalog, *entry)
+	}
+
+	return catalog, rows.Err()
+}
+
+// GetMapEntry returns the catalog entry of a map.
+func GetMapEntry(mapName string) (*model.MapEntry, error) {
+
+	row := db.QueryRow("SELECT map_name, modes, default_players, maximum_players, minimum_level, gameserver_binary FROM map_catalog WHERE map_name = $1", mapName)
+	entry, err := scanMapEntry(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrUnknownMap
+	}
+	return entry, err
+}
+
+// SetMapEntry adds a map to the catalog or replaces its entry. Games
+// already created keep the settings they were created with.
+func SetMapEntry(entry *model.MapEntry) error {
+
+	err := entry.Validate()
+	if err != nil {
+		return err
+	}
+
+	modes, err := json.Marshal(entry.Modes)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`INSERT INTO map_catalog (map_name, modes, default_players, maximum_players, minimum_level, gameserver_binary)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (map_name) DO UPDATE SET modes = $2, default_players = $3, maximum_players = $4, minimum_level = $5, gameserver_binary = $6`,
+		entry.Map, string(modes), entry.DefaultPlayers, entry.MaximumPlayers, entry.MinimumLevel, entry.Binary)
+	return err
+}
+
+// DeleteMapEntry removes a map from the catalog. No new games can be
+// created on it; running games are left alone.
+func DeleteMapEntry(mapName string) error {
+
+	result, err := db.Exec("DELETE FROM map_catalog WHERE map_name = $1", mapName)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrUnknownMap
+	}
+	return nil
+}
+
+func scanMapEntry(row rowScanner) (*model.MapEntry, error) {
+
+	var entry model.MapEntry
+	var modes string
+	err := row.Scan(&entry.Map, &modes, &entry.DefaultPlayers, &entry.MaximumPlayers, &entry.MinimumLevel, &entry.Binary)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(modes), &entry.Modes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
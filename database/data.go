@@ -57,6 +57,8 @@ type Vector3 struct {
 	Z float64 `json:"z"`
 }
 
+// CharacterData is the legacy layout of characters.game_data. Rows still in
+// this layout are converted by model.DecodeCharacterState when loaded.
 type CharacterData struct {
 	Name          string                `json:"name"`
 	Soul          int                   `json:"soul"`
@@ -0,0 +1,379 @@
+package thordb
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/model"
+	"gopkg.in/redis.v3"
+)
+
+// the session hash field holding the selected character id
+const hkeySelectedCharacter string = "selectedCharacter"
+
+// stored friend link states. Links have one row per direction: a request
+// is a pending row from the requester, accepting adds the reverse row and
+// a block replaces the blocker's row.
+const friendPending string = "pending"
+const friendAccepted string = "accepted"
+const friendBlocked string = "blocked"
+
+var ErrAccountNotExist = errors.New("thordb: account does not exist")
+var ErrSelfFriend = errors.New("thordb: can't befriend yourself")
+var ErrAlreadyFriends = errors.New("thordb: already friends")
+var ErrFriendBlocked = errors.New("thordb: account is blocked")
+var ErrNoFriendRequest = errors.New("thordb: no friend request from account")
+var ErrNotFriends = errors.New("thordb: not friends")
+var ErrFriendNotInGame = errors.New("thordb: friend is not in a game")
+
+// friendTarget validates a session and finds the other account by id, or
+// by username when friendId is 0.
+func friendTarget(sessionKey string, friendId int, username string) (int, int, error) {
+
+	uid, err := validateToken(sessionKey)
+	if err != nil {
+		return 0, 0, ErrInvalidSessionKey
+	}
+
+	if friendId == 0 {
+		err = db.QueryRow("SELECT user_id FROM account_data WHERE username = $1", username).Scan(&friendId)
+	} else {
+		err = db.QueryRow("SELECT user_id FROM account_data WHERE user_id = $1", friendId).Scan(&friendId)
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, 0, ErrAccountNotExist
+	case err != nil:
+		return 0, 0, err
+	}
+
+	if friendId == uid {
+		return 0, 0, ErrSelfFriend
+	}
+
+	return uid, friendId, nil
+}
+
+// friendLinks reads both directions of a link, "" where there is no row.
+// Both accounts are locked first, rows that don't exist yet can't be.
+func friendLinks(tx *sql.Tx, uid int, friendId int) (string, string, error) {
+
+	_, err := tx.Exec("SELECT user_id FROM account_data WHERE user_id IN ($1, $2) ORDER BY user_id FOR UPDATE", uid, friendId)
+	if err != nil {
+		return "", "", err
+	}
+
+	rows, err := tx.Query(`SELECT user_id, status FROM friends
+		WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1)
+		FOR UPDATE`, uid, friendId)
+	if err != nil {
+		return "", "", err
+	}
+	defer rows.Close()
+
+	var mine, theirs string
+	for rows.Next() {
+		var owner int
+		var status string
+		err = rows.Scan(&owner, &status)
+		if err != nil {
+			return "", "", err
+		}
+
+		if owner == uid {
+			mine = status
+		} else {
+			theirs = status
+		}
+	}
+
+	return mine, theirs, rows.Err()
+}
+
+func setFriendLink(tx *sql.Tx, uid int, friendId int, status string) error {
+
+	_, err := tx.Exec("DELETE FROM friends WHERE user_id = $1 AND friend_id = $2", uid, friendId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO friends (user_id, friend_id, status, created_on) VALUES ($1, $2, $3, $4)", uid, friendId, status, time.Now())
+	return err
+}
+
+// RequestFriend sends a friend request. A request to an account that
+// already asked accepts theirs.
+func RequestFriend(sessionKey string, friendId int, username string) error {
+
+	uid, friendId, err := friendTarget(sessionKey, friendId, username)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	mine, theirs, err := friendLinks(tx, uid, friendId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	switch {
+	case mine == friendBlocked || theirs == friendBlocked:
+		tx.Rollback()
+		return ErrFriendBlocked
+	case mine == friendAccepted:
+		tx.Rollback()
+		return ErrAlreadyFriends
+	case mine == friendPending:
+		tx.Rollback()
+		return nil
+	case theirs == friendPending:
+		err = acceptFriendLink(tx, uid, friendId)
+	default:
+		err = setFriendLink(tx, uid, friendId, friendPending)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func acceptFriendLink(tx *sql.Tx, uid int, friendId int) error {
+
+	_, err := tx.Exec("UPDATE friends SET status = $1 WHERE user_id = $2 AND friend_id = $3", friendAccepted, friendId, uid)
+	if err != nil {
+		return err
+	}
+
+	return setFriendLink(tx, uid, friendId, friendAccepted)
+}
+
+// AcceptFriend accepts a pending request from friendId.
+func AcceptFriend(sessionKey string, friendId int) error {
+
+	uid, friendId, err := friendTarget(sessionKey, friendId, "")
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, theirs, err := friendLinks(tx, uid, friendId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if theirs != friendPending {
+		tx.Rollback()
+		return ErrNoFriendRequest
+	}
+
+	err = acceptFriendLink(tx, uid, friendId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveFriend removes a friend, declines or withdraws a request, or lifts
+// a block. A block by the other account stays.
+func RemoveFriend(sessionKey string, friendId int) error {
+
+	uid, friendId, err := friendTarget(sessionKey, friendId, "")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`DELETE FROM friends
+		WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1 AND status <> $3)`,
+		uid, friendId, friendBlocked)
+	return err
+}
+
+// BlockFriend ends any link with the account and stops it from sending
+// requests or seeing presence.
+func BlockFriend(sessionKey string, friendId int, username string) error {
+
+	uid, friendId, err := friendTarget(sessionKey, friendId, username)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM friends WHERE user_id = $1 AND friend_id = $2 AND status <> $3", friendId, uid, friendBlocked)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = setFriendLink(tx, uid, friendId, friendBlocked)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetFriends lists the friends, requests and blocks of the session's
+// account, with the presence of accepted friends.
+func GetFriends(sessionKey string) ([]model.Friend, error) {
+
+	uid, err := validateToken(sessionKey)
+	if err != nil {
+		return nil, ErrInvalidSessionKey
+	}
+
+	rows, err := db.Query(`SELECT f.friend_id, a.username, f.status
+		FROM friends f JOIN account_data a ON a.user_id = f.friend_id
+		WHERE f.user_id = $1
+		UNION ALL
+		SELECT f.user_id, a.username, 'incoming'
+		FROM friends f JOIN account_data a ON a.user_id = f.user_id
+		WHERE f.friend_id = $1 AND f.status = $2
+		ORDER BY 2`, uid, friendPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.Friend, 0)
+	for rows.Next() {
+		var friend model.Friend
+		var status string
+		err = rows.Scan(&friend.UserId, &friend.Username, &status)
+		if err != nil {
+			return nil, err
+		}
+
+		switch status {
+		case friendAccepted:
+			friend.Status = model.FriendAccepted
+		case friendPending:
+			friend.Status = model.FriendOutgoing
+		case friendBlocked:
+			friend.Status = model.FriendBlocked
+		default:
+			friend.Status = model.FriendIncoming
+		}
+
+		list = append(list, friend)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		if list[i].Status == model.FriendAccepted {
+			err = setPresence(&list[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return list, nil
+}
+
+// setPresence reads a friend's presence from their session. An account is
+// in a game while its selected character plays in its last game.
+func setPresence(friend *model.Friend) error {
+
+	key := userSessionKey(friend.UserId)
+
+	_, err := kvstore.HGet(key, hkeyUserToken).Result()
+	switch {
+	case err == redis.Nil:
+		friend.Presence = model.PresenceOffline
+		return nil
+	case err != nil:
+		return err
+	}
+
+	friend.Presence = model.PresenceOnline
+
+	selected, err := kvstore.HGet(key, hkeySelectedCharacter).Result()
+	switch {
+	case err == redis.Nil:
+		return nil
+	case err != nil:
+		return err
+	}
+
+	characterId, err := strconv.Atoi(selected)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	var lastGameId int
+	var playing bool
+	err = db.QueryRow(`SELECT c.name, c.last_game_id,
+			EXISTS (SELECT 1 FROM game_players p WHERE p.character_id = c.id AND p.game_id = c.last_game_id)
+		FROM characters c WHERE c.id = $1 AND c.uid = $2`, characterId, friend.UserId).Scan(&name, &lastGameId, &playing)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		return err
+	}
+
+	friend.CharacterId = characterId
+	friend.CharacterName = name
+
+	if playing {
+		friend.Presence = model.PresenceInGame
+		friend.GameId = lastGameId
+	}
+
+	return nil
+}
+
+// friendGame returns the game an accepted friend is playing in.
+func friendGame(uid int, friendId int) (int, error) {
+
+	var status string
+	err := db.QueryRow("SELECT status FROM friends WHERE user_id = $1 AND friend_id = $2", uid, friendId).Scan(&status)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, ErrNotFriends
+	case err != nil:
+		return 0, err
+	}
+
+	if status != friendAccepted {
+		return 0, ErrNotFriends
+	}
+
+	friend := model.Friend{UserId: friendId}
+	err = setPresence(&friend)
+	if err != nil {
+		return 0, err
+	}
+
+	if friend.Presence != model.PresenceInGame {
+		return 0, ErrFriendNotInGame
+	}
+
+	return friend.GameId, nil
+}
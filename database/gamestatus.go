@@ -0,0 +1,224 @@
+package thordb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/globals"
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+// gameservers report their status every few seconds, the latest report is
+// kept until it expires
+const gameStatusKey string = "games/%d/status"
+
+var ErrBadGameStatus = errors.New("thordb: bad game server status")
+
+func SetGameServerStatus(machineKey string, gameId int, status *model.GameServerStatus) error {
+
+	machineId, valid, err := validateMachineKey(machineKey)
+	if err != nil {
+
+		return err
+	}
+
+	if !valid {
+
+		return ErrInvalidMachineKey
+	}
+
+	switch status.Phase {
+	case model.MatchWarmup, model.MatchInProgress, model.MatchEnded:
+	default:
+		return ErrBadGameStatus
+	}
+
+	if status.PlayerCount < 0 || status.TickRate < 0 {
+
+		return ErrBadGameStatus
+	}
+
+	// the last report outlives the one kept in redis, a game that stops
+	// reporting is ended by the reconciler
+	status.ReportedOn = time.Now()
+	res, err := db.Exec("UPDATE hosts SET reported_on = $1 WHERE game_id = $2 AND machine_id = $3", status.ReportedOn, gameId, machineId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrGameNotExist
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+
+		return err
+	}
+
+	return kvstore.Set(fmt.Sprintf(gameStatusKey, gameId), string(data), time.Second*globals.GAME_STATUS_EXPIRE_SECONDS).Err()
+}
+
+// attachServerStatus fills in the latest status report of running games.
+func attachServerStatus(games []*model.Game) error {
+
+	keys := make([]string, 0, len(games))
+	running := make([]*model.Game, 0, len(games))
+	for _, game := range games {
+		if game.HostStatus == model.GameRunning {
+			keys = append(keys, fmt.Sprintf(gameStatusKey, game.GameId))
+			running = append(running, game)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	values, err := kvstore.MGet(keys...).Result()
+	if err != nil {
+		return err
+	}
+
+	for i, value := range values {
+
+		data, ok := value.(string)
+		if !ok {
+			// no report within the ttl
+			continue
+		}
+
+		var status model.GameServerStatus
+		err = json.Unmarshal([]byte(data), &status)
+		if err != nil {
+			log.Print("thordb: unreadable status of game ", running[i].GameId, ": ", err)
+			continue
+		}
+
+		running[i].ServerStatus = &status
+		running[i].Healthy = true
+	}
+
+	return nil
+}
+
+// GetUnhealthyGames returns the running games without a fresh status
+// report. Games registered within the last report ttl are skipped, their
+// server may not have reported yet.
+func GetUnhealthyGames() ([]int, error) {
+
+	grace := time.Now().Add(-time.Second * globals.GAME_STATUS_EXPIRE_SECONDS)
+
+	rows, err := db.Query("SELECT game_id FROM hosts WHERE registered_on IS NULL OR registered_on < $1", grace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	games := make([]*model.Game, 0)
+	for rows.Next() {
+		game := model.Game{HostStatus: model.GameRunning}
+		err = rows.Scan(&game.GameId)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, &game)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	err = attachServerStatus(games)
+	if err != nil {
+		return nil, err
+	}
+
+	unhealthy := make([]int, 0)
+	for _, game := range games {
+		if !game.Healthy {
+			unhealthy = append(unhealthy, game.GameId)
+		}
+	}
+
+	return unhealthy, nil
+}
+
+// StaleGame is a running game whose server stopped reporting its status.
+type StaleGame struct {
+	GameId    int
+	MachineId int
+}
+
+// staleSince is the condition on hosts of games that haven't reported
+// since $1, counting from registration for games that never did
+const staleSince string = "(COALESCE(reported_on, registered_on) IS NULL OR COALESCE(reported_on, registered_on) < $1)"
+
+// GetStaleGames returns the running games that went without a status
+// report for longer than grace.
+func GetStaleGames(grace time.Duration) ([]StaleGame, error) {
+
+	rows, err := db.Query("SELECT game_id, machine_id FROM hosts WHERE "+staleSince, time.Now().Add(-grace))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]StaleGame, 0)
+	for rows.Next() {
+		var game StaleGame
+		err = rows.Scan(&game.GameId, &game.MachineId)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, game)
+	}
+
+	return list, rows.Err()
+}
+
+// EndStaleGame ends a game found by GetStaleGames, with its players and
+// reservations, unless it reported in the meantime. It returns whether the
+// game was ended.
+func EndStaleGame(gameId int, grace time.Duration) (bool, error) {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	var hosted int
+	err = tx.QueryRow("SELECT game_id FROM hosts WHERE game_id = $2 AND "+staleSince+" FOR UPDATE", time.Now().Add(-grace), gameId).Scan(&hosted)
+	switch {
+	case err == sql.ErrNoRows:
+		tx.Rollback()
+		return false, nil
+	case err != nil:
+		tx.Rollback()
+		return false, err
+	}
+
+	err = endGame(tx, gameId)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	kvstore.Del(fmt.Sprintf(gameStatusKey, gameId))
+	return true, nil
+}
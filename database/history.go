@@ -0,0 +1,195 @@
+package thordb
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+// sources of character history entries
+const historySourceCreate string = "create"
+const historySourceUpdate string = "update"
+const historySourceDisconnect string = "disconnect"
+const historySourceRestore string = "restore"
+const historySourceMigrate string = "migrate"
+
+// saveCharacter writes a character's state if it is still at
+// character.Revision and records the result in the history. Snapshots
+// from gameservers are corrected by the progression rules first.
+func saveCharacter(tx *sql.Tx, character *model.Character, source string) (int, error) {
+
+	if source == historySourceUpdate || source == historySourceDisconnect {
+		err := checkSnapshot(tx, character)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	jsonBytes, err := model.EncodeCharacterState(&character.CharacterState)
+	if err != nil {
+		return 0, err
+	}
+
+	var revision int
+	err = tx.QueryRow("UPDATE characters SET last_game_id = $1, game_data = $2, revision = revision + 1 WHERE id = $3 AND revision = $4 RETURNING revision",
+		character.LastGameId, string(jsonBytes), character.CharacterId, character.Revision).Scan(&revision)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, characterWriteError(tx, character.CharacterId)
+	case err != nil:
+		return 0, err
+	}
+
+	err = recordCharacterHistory(tx, character.CharacterId, revision, character.LastGameId, string(jsonBytes), source)
+	if err != nil {
+		return 0, err
+	}
+
+	return revision, nil
+}
+
+// characterWriteError tells a missing character from a stale revision
+// after a conditional update matched no rows.
+func characterWriteError(tx *sql.Tx, characterId int) error {
+
+	var id int
+	err := tx.QueryRow("SELECT id FROM characters WHERE id = $1", characterId).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrCharacterNotExist
+	case err != nil:
+		return err
+	}
+
+	return ErrRevisionConflict
+}
+
+func recordCharacterHistory(tx *sql.Tx, characterId int, revision int, lastGameId int, gameData string, source string) error {
+
+	_, err := tx.Exec("INSERT INTO character_history (character_id, revision, last_game_id, game_data, source, recorded_on) VALUES ($1, $2, $3, $4, $5, $6)",
+		characterId, revision, lastGameId, gameData, source, time.Now())
+	return err
+}
+
+// GetCharacterHistory returns the most recent stored states of a
+// character, newest first.
+func GetCharacterHistory(characterId int, limit int) ([]model.CharacterRevision, error) {
+
+	rows, err := db.Query("SELECT revision, last_game_id, source, recorded_on, game_data FROM character_history WHERE character_id = $1 ORDER BY history_id DESC LIMIT $2", characterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.CharacterRevision, 0)
+
+	for rows.Next() {
+		var entry model.CharacterRevision
+		var gameData string
+		err = rows.Scan(&entry.Revision, &entry.LastGameId, &entry.Source, &entry.RecordedOn, &gameData)
+		if err != nil {
+			return nil, err
+		}
+
+		state, err := model.DecodeCharacterState([]byte(gameData))
+		if err != nil {
+			return nil, err
+		}
+
+		entry.State = *state
+
+		list = append(list, entry)
+	}
+
+	if len(list) == 0 {
+		var id int
+		err = db.QueryRow("SELECT id FROM characters WHERE id = $1", characterId).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, ErrCharacterNotExist
+		}
+	}
+
+	return list, rows.Err()
+}
+
+// RestoreCharacter makes an earlier revision the character's current
+// state. The restore is written as a new revision, so the history stays
+// append-only and running games holding the old revision get a conflict.
+// The revision's inventory is written to the ledger, which loads replace
+// the inventory of the game data with.
+func RestoreCharacter(characterId int, revision int) (int, error) {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var lastGameId int
+	var gameData string
+	err = tx.QueryRow("SELECT last_game_id, game_data FROM character_history WHERE character_id = $1 AND revision = $2 ORDER BY history_id DESC LIMIT 1", characterId, revision).Scan(&lastGameId, &gameData)
+	switch {
+	case err == sql.ErrNoRows:
+		tx.Rollback()
+		return 0, ErrCharacterNotExist
+	case err != nil:
+		tx.Rollback()
+		return 0, err
+	}
+
+	restored, err := model.DecodeCharacterState([]byte(gameData))
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if restored.Inventory == nil {
+		restored.Inventory = make([]model.Item, 0)
+	}
+
+	var currentData string
+	var ledger *string
+	err = tx.QueryRow("SELECT game_data, inventory FROM characters WHERE id = $1 FOR UPDATE", characterId).Scan(&currentData, &ledger)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	current, err := model.DecodeCharacterState([]byte(currentData))
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = overlayInventory(current, ledger)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var newRevision int
+	err = tx.QueryRow("UPDATE characters SET last_game_id = $1, game_data = $2, revision = revision + 1 WHERE id = $3 RETURNING revision", lastGameId, gameData, characterId).Scan(&newRevision)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = writeInventory(tx, characterId, current.Inventory, restored.Inventory, &InventoryOperation{Action: InventoryRestore}, 0, 0)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = recordCharacterHistory(tx, characterId, newRevision, lastGameId, gameData, historySourceRestore)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return newRevision, nil
+}
@@ -0,0 +1,297 @@
+package thordb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/inventory"
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+const itemCatalogPath string = "data/items.json"
+
+// inventory log actions
+const InventoryGrant string = "grant"
+const InventoryConsume string = "consume"
+const InventoryMove string = "move"
+const InventoryDrop string = "drop"
+const InventoryRestore string = "restore"
+
+var ErrInventoryMismatch = errors.New("thordb: inventory differs from the ledger")
+var ErrCharacterNotInGame = errors.New("thordb: character is not in a game on this machine")
+var errNoItemCatalog = errors.New("thordb: item catalog not loaded")
+
+var itemCatalog *inventory.Catalog
+var itemCatalogOnce sync.Once
+
+// GetItemCatalog reads data/items.json once.
+func GetItemCatalog() (*inventory.Catalog, error) {
+
+	itemCatalogOnce.Do(func() {
+		catalog, err := inventory.LoadFile(itemCatalogPath)
+		if err != nil {
+			log.Print("thordb: ", err)
+			return
+		}
+		itemCatalog = catalog
+	})
+
+	if itemCatalog == nil {
+		return nil, errNoItemCatalog
+	}
+
+	return itemCatalog, nil
+}
+
+// overlayInventory replaces the inventory of decoded game data with the
+// ledger. Characters whose inventory never changed through the ledger
+// have none and keep the inventory from their game data.
+func overlayInventory(state *model.CharacterState, ledger *string) error {
+
+	if ledger == nil {
+		return nil
+	}
+
+	items := make([]model.Item, 0)
+	err := json.Unmarshal([]byte(*ledger), &items)
+	if err != nil {
+		return err
+	}
+
+	state.Inventory = items
+	return nil
+}
+
+// InventoryOperation is one change to an inventory, see the inventory
+// package for what each action uses.
+type InventoryOperation struct {
+	Action  string
+	ItemId  int
+	Count   int
+	Slot    int
+	ToSlot  int
+	TradeId int
+}
+
+// ChangeInventory applies an operation from the gameserver hosting the
+// character and returns the new inventory and the ledger's new version.
+// Every change is written to the inventory log.
+func ChangeInventory(machineKey string, characterId int, op *InventoryOperation) ([]model.Item, int, error) {
+
+	catalog, err := GetItemCatalog()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	machineId, valid, err := validateMachineKey(machineKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !valid {
+		return nil, 0, ErrInvalidMachineKey
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var gameId int
+	var gameData string
+	var ledger *string
+	err = tx.QueryRow(`SELECT p.game_id, c.game_data, c.inventory
+		FROM characters c
+			JOIN game_players p ON p.character_id = c.id
+			JOIN hosts h ON h.game_id = p.game_id
+		WHERE c.id = $1 AND h.machine_id = $2
+		FOR UPDATE OF c`, characterId, machineId).Scan(&gameId, &gameData, &ledger)
+	switch {
+	case err == sql.ErrNoRows:
+		tx.Rollback()
+		return nil, 0, characterNotInGameError(characterId)
+	case err != nil:
+		tx.Rollback()
+		return nil, 0, err
+	}
+
+	state, err := model.DecodeCharacterState([]byte(gameData))
+	if err != nil {
+		tx.Rollback()
+		return nil, 0, err
+	}
+
+	err = overlayInventory(state, ledger)
+	if err != nil {
+		tx.Rollback()
+		return nil, 0, err
+	}
+
+	var items []model.Item
+	switch op.Action {
+	case InventoryGrant:
+		items, err = catalog.Grant(state.Inventory, state.ClassId, op.ItemId, op.Count)
+	case InventoryConsume:
+		items, err = catalog.Consume(state.Inventory, op.ItemId, op.Count)
+	case InventoryMove:
+		items, err = catalog.Move(state.Inventory, op.Slot, op.ToSlot)
+	case InventoryDrop:
+		items, err = catalog.Drop(state.Inventory, op.Slot, op.Count)
+	default:
+		err = errors.New("thordb: unknown inventory action " + op.Action)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, 0, err
+	}
+
+	version, err := writeInventory(tx, characterId, state.Inventory, items, op, machineId, gameId)
+	if err != nil {
+		tx.Rollback()
+		return nil, 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return items, version, nil
+}
+
+// GetInventory returns the ledger inventory of a character playing on the
+// machine and its version. Gameservers read it after the inventory changed outside the
+// game, for example by a trade.
+func GetInventory(machineKey string, characterId int) ([]model.Item, int, error) {
+
+	machineId, valid, err := validateMachineKey(machineKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !valid {
+		return nil, 0, ErrInvalidMachineKey
+	}
+
+	var gameData string
+	var ledger *string
+	var version int
+	err = db.QueryRow(`SELECT c.game_data, c.inventory, c.inventory_version
+		FROM characters c
+			JOIN game_players p ON p.character_id = c.id
+			JOIN hosts h ON h.game_id = p.game_id
+		WHERE c.id = $1 AND h.machine_id = $2`, characterId, machineId).Scan(&gameData, &ledger, &version)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, 0, characterNotInGameError(characterId)
+	case err != nil:
+		return nil, 0, err
+	}
+
+	state, err := model.DecodeCharacterState([]byte(gameData))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = overlayInventory(state, ledger)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return state.Inventory, version, nil
+}
+
+// characterNotInGameError tells a missing character from one that isn't
+// playing on the machine.
+func characterNotInGameError(characterId int) error {
+
+	var id int
+	err := db.QueryRow("SELECT id FROM characters WHERE id = $1", characterId).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrCharacterNotExist
+	case err != nil:
+		return err
+	}
+
+	return ErrCharacterNotInGame
+}
+
+// writeInventory stores a character's new inventory, logs the change and
+// returns the new version of the ledger. Zero machine, game and trade ids
+// are logged as NULL.
+func writeInventory(tx *sql.Tx, characterId int, before []model.Item, after []model.Item, op *InventoryOperation, machineId int, gameId int) (int, error) {
+
+	beforeBytes, err := json.Marshal(before)
+	if err != nil {
+		return 0, err
+	}
+
+	afterBytes, err := json.Marshal(after)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = tx.QueryRow("UPDATE characters SET inventory = $1, inventory_version = inventory_version + 1 WHERE id = $2 RETURNING inventory_version",
+		string(afterBytes), characterId).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO inventory_log (character_id, action, item_id, count, slot, to_slot, machine_id, game_id, trade_id, before, after, recorded_on)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, 0), NULLIF($9, 0), $10, $11, $12)`,
+		characterId, op.Action, op.ItemId, op.Count, op.Slot, op.ToSlot, machineId, gameId, op.TradeId, string(beforeBytes), string(afterBytes), time.Now())
+	return version, err
+}
+
+// GetInventoryLog returns the most recent inventory changes of a
+// character, newest first.
+func GetInventoryLog(characterId int, limit int) ([]model.InventoryChange, error) {
+
+	var exists int
+	err := db.QueryRow("SELECT id FROM characters WHERE id = $1", characterId).Scan(&exists)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrCharacterNotExist
+	case err != nil:
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT change_id, action, item_id, count, slot, to_slot,
+			COALESCE(machine_id, 0), COALESCE(game_id, 0), COALESCE(trade_id, 0), before, after, recorded_on
+		FROM inventory_log WHERE character_id = $1 ORDER BY change_id DESC LIMIT $2`, characterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.InventoryChange, 0)
+	for rows.Next() {
+		change := model.InventoryChange{CharacterId: characterId}
+		var before, after string
+		err = rows.Scan(&change.ChangeId, &change.Action, &change.ItemId, &change.Count, &change.Slot, &change.ToSlot,
+			&change.MachineId, &change.GameId, &change.TradeId, &before, &after, &change.RecordedOn)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(before), &change.Before)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(after), &change.After)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, change)
+	}
+
+	return list, rows.Err()
+}
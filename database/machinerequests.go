@@ -1,21 +1,37 @@
 package thordb
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/requests"
 )
 
 const machineSessionKey string = "machines/%d"
 const hkeyMachineToken string = "machineToken"
 
-func RegisterMachine(remoteAddress string, servicePort int) (int, string, error) {
+// RegisterMachine stores a host and the profiles it can launch. Hosts
+// that send no profiles are stored without any and get every game.
+func RegisterMachine(remoteAddress string, servicePort int, region string, profiles []model.HostProfile) (int, string, error) {
+
+	var profileData *string
+	if profiles != nil {
+		data, err := json.Marshal(profiles)
+		if err != nil {
+			return 0, "", err
+		}
+		str := string(data)
+		profileData = &str
+	}
 
 	var machineId int
-	err := db.QueryRow("INSERT INTO machines (remote_address, service_listen_port) VALUES ($1, $2) RETURNING machine_id", remoteAddress, servicePort).Scan(&machineId)
+	err := db.QueryRow("INSERT INTO machines (remote_address, service_listen_port, region, profiles) VALUES ($1, $2, $3, $4) RETURNING machine_id", remoteAddress, servicePort, region, profileData).Scan(&machineId)
 	if err != nil {
 		return 0, "", err
 	}
@@ -84,7 +100,8 @@ func UpdateMachineStatus(machineToken string, usageCpu float64, usageNetwork flo
 
 	machineId, err := validateMachineToken(machineToken)
 	if err != nil {
-		return err
+		log.Print(err)
+		return ErrInvalidMachineKey
 	}
 
 	// ToDo: use this later to check that 1 row was updated
@@ -100,6 +117,169 @@ func UpdateMachineStatus(machineToken string, usageCpu float64, usageNetwork flo
 	return nil
 }
 
+// AnnounceGames takes over the games a host still runs after registering
+// again, from its earlier registrations at the same address and port.
+// Those are removed afterwards with the hosts rows of games it no longer
+// runs. Games missing from the database, after a restore, are recreated.
+func AnnounceGames(machineKey string, games []request.AnnouncedGame) (*request.AnnounceGamesResponse, error) {
+
+	machineId, err := validateMachineToken(machineKey)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrInvalidMachineKey
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	stale, err := staleMachines(tx, machineId)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	resp := &request.AnnounceGamesResponse{Adopted: make([]int, 0), Refused: make([]int, 0)}
+	recreated := false
+	for _, game := range games {
+
+		adopted, created, err := adoptGame(tx, machineId, stale, &game)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if adopted {
+			resp.Adopted = append(resp.Adopted, game.GameId)
+		} else {
+			resp.Refused = append(resp.Refused, game.GameId)
+		}
+		recreated = recreated || created
+	}
+
+	if recreated {
+
+		// games inserted with their own ids must not be handed out again
+		_, err = tx.Exec("SELECT setval('games_game_id_seq', (SELECT MAX(game_id) FROM games))")
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	for id := range stale {
+		_, err = tx.Exec("DELETE FROM machines WHERE machine_id = $1", id)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range stale {
+		kvstore.Del(fmt.Sprintf(machineSessionKey, id))
+		log.Printf("machine %d replaces its earlier registration as machine %d", machineId, id)
+	}
+
+	return resp, nil
+}
+
+// staleMachines are the other registrations of the machine's address and
+// port.
+func staleMachines(tx *sql.Tx, machineId int) (map[int]bool, error) {
+
+	rows, err := tx.Query(`SELECT m.machine_id FROM machines m, machines self
+		WHERE self.machine_id = $1 AND m.machine_id <> self.machine_id
+		AND m.remote_address = self.remote_address AND m.service_listen_port = self.service_listen_port`, machineId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stale := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		stale[id] = true
+	}
+
+	return stale, rows.Err()
+}
+
+// adoptGame points an announced game at the machine. The game is refused
+// if it ended or is held by a machine other than the stale ones.
+func adoptGame(tx *sql.Tx, machineId int, stale map[int]bool, game *request.AnnouncedGame) (bool, bool, error) {
+
+	created := false
+	var endedOn *time.Time
+	err := tx.QueryRow("SELECT ended_on FROM games WHERE game_id = $1 FOR UPDATE", game.GameId).Scan(&endedOn)
+	switch {
+
+	case err == sql.ErrNoRows:
+
+		worldX, worldY := worldColumns(game.WorldRegion)
+		_, err = tx.Exec("INSERT INTO games (game_id, map_name, game_mode, minimum_level, maximum_players, world_x, world_y) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			game.GameId, game.Map, game.Mode, game.MinimumLevel, game.MaximumPlayers, worldX, worldY)
+		if err != nil {
+			return false, false, err
+		}
+		created = true
+		log.Printf("machine %d announced game %d, which was missing and is recreated", machineId, game.GameId)
+
+	case err != nil:
+
+		return false, false, err
+
+	case endedOn != nil:
+
+		log.Printf("machine %d announced game %d, which already ended", machineId, game.GameId)
+		return false, false, nil
+	}
+
+	var owner int
+	err = tx.QueryRow("SELECT machine_id FROM hosts WHERE game_id = $1 UNION ALL SELECT machine_id FROM loading_hosts WHERE game_id = $1 LIMIT 1", game.GameId).Scan(&owner)
+	if err != nil && err != sql.ErrNoRows {
+		return false, false, err
+	}
+
+	if owner != 0 && owner != machineId && !stale[owner] {
+		log.Printf("machine %d announced game %d, which machine %d runs", machineId, game.GameId, owner)
+		return false, created, nil
+	}
+
+	if game.Registered {
+
+		_, err = tx.Exec("DELETE FROM loading_hosts WHERE game_id = $1", game.GameId)
+		if err != nil {
+			return false, false, err
+		}
+
+		_, err = tx.Exec(`INSERT INTO hosts (game_id, machine_id, port, registered_on) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (game_id) DO UPDATE SET machine_id = EXCLUDED.machine_id, port = EXCLUDED.port`,
+			game.GameId, machineId, game.Port, time.Now())
+	} else {
+
+		_, err = tx.Exec(`INSERT INTO loading_hosts (game_id, machine_id, kickoff_time) VALUES ($1, $2, $3)
+			ON CONFLICT (game_id) DO UPDATE SET machine_id = EXCLUDED.machine_id`,
+			game.GameId, machineId, time.Now())
+	}
+
+	if err != nil {
+		return false, false, err
+	}
+
+	log.Printf("machine %d adopted game %d", machineId, game.GameId)
+	return true, created, nil
+}
+
 func TestMachineRequest() {
 	_, err := kvstore.Ping().Result()
 	if err != nil {
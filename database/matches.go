@@ -0,0 +1,215 @@
+package thordb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/generate"
+	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/requests"
+	"github.com/jaybennett89/thorium-go/world"
+)
+
+var ErrMatchNotExist = errors.New("thordb: match does not exist")
+var ErrBadMatchResult = errors.New("thordb: bad match result")
+
+// RecordMatch archives the result of a match played on a game hosted by
+// the machine and returns its match id.
+func RecordMatch(result *request.MatchResult) (int, error) {
+
+	machineId, valid, err := validateMachineKey(result.MachineKey)
+	if err != nil {
+
+		return 0, err
+	}
+
+	if !valid {
+
+		return 0, ErrInvalidMachineKey
+	}
+
+	if result.EndedOn.IsZero() {
+		result.EndedOn = time.Now()
+	}
+
+	if result.StartedOn.IsZero() || result.EndedOn.Before(result.StartedOn) || len(result.Participants) == 0 {
+
+		return 0, ErrBadMatchResult
+	}
+
+	var mapName, gameMode string
+	var worldX, worldY *int
+	err = db.QueryRow("SELECT map_name, game_mode, world_x, world_y FROM games JOIN hosts USING (game_id) WHERE game_id = $1 AND machine_id = $2", result.GameId, machineId).Scan(&mapName, &gameMode, &worldX, &worldY)
+	switch {
+	case err == sql.ErrNoRows:
+		return 0, ErrGameNotExist
+	case err != nil:
+		return 0, err
+	}
+
+	// only open world games fight over sites, and only over the sites of
+	// the region they host. The region is generated before it is locked.
+	if result.Site != nil {
+
+		if mapName != world.OpenWorldMap || worldX == nil || worldY == nil || result.Site.X != *worldX || result.Site.Y != *worldY {
+			return 0, ErrBadMatchResult
+		}
+
+		_, err = GetRegion(generate.Coordinate2D{X: result.Site.X, Y: result.Site.Y})
+		if err == ErrRegionOutOfBounds {
+			return 0, ErrBadMatchResult
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+
+		return 0, err
+	}
+
+	var matchId int
+	err = tx.QueryRow("INSERT INTO matches (game_id, map_name, game_mode, started_on, ended_on, winning_team) VALUES ($1, $2, $3, $4, $5, $6) RETURNING match_id",
+		result.GameId, mapName, gameMode, result.StartedOn, result.EndedOn, result.WinningTeam).Scan(&matchId)
+	if err != nil {
+
+		tx.Rollback()
+		return 0, err
+	}
+
+	seen := make(map[int]bool)
+	for _, participant := range result.Participants {
+
+		// only characters that played in the game take part in its matches
+		var exists int
+		err = tx.QueryRow("SELECT character_id FROM game_characters WHERE game_id = $1 AND character_id = $2", result.GameId, participant.CharacterId).Scan(&exists)
+		if err != nil || seen[participant.CharacterId] {
+
+			tx.Rollback()
+			if err != nil && err != sql.ErrNoRows {
+				return 0, err
+			}
+			return 0, ErrBadMatchResult
+		}
+		seen[participant.CharacterId] = true
+
+		var stats []byte
+		stats, err = json.Marshal(participant.Stats)
+		if err != nil {
+
+			tx.Rollback()
+			return 0, err
+		}
+
+		outcome := model.MatchOutcome(participant.Team, result.WinningTeam)
+		_, err = tx.Exec("INSERT INTO match_participants (match_id, character_id, team, outcome, stats) VALUES ($1, $2, $3, $4, $5)",
+			matchId, participant.CharacterId, participant.Team, outcome, string(stats))
+		if err != nil {
+
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if result.Site != nil && result.WinningTeam != nil {
+
+		err = scoreWorldSite(tx, matchId, result.Site, *result.WinningTeam)
+		if err != nil {
+
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+
+		return 0, err
+	}
+
+	return matchId, nil
+}
+
+func GetMatch(matchId int) (*model.Match, error) {
+
+	var match model.Match
+	err := db.QueryRow("SELECT match_id, game_id, map_name, game_mode, started_on, ended_on, winning_team FROM matches WHERE match_id = $1", matchId).Scan(
+		&match.MatchId, &match.GameId, &match.Map, &match.Mode, &match.StartedOn, &match.EndedOn, &match.WinningTeam)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrMatchNotExist
+	case err != nil:
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT p.character_id, c.name, p.team, p.outcome, p.stats FROM match_participants p JOIN characters c ON c.id = p.character_id WHERE p.match_id = $1 ORDER BY p.team, p.character_id", matchId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	match.Participants = make([]model.MatchParticipant, 0)
+	for rows.Next() {
+		var participant model.MatchParticipant
+		var stats string
+		err = rows.Scan(&participant.CharacterId, &participant.Name, &participant.Team, &participant.Outcome, &stats)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(stats), &participant.Stats)
+		if err != nil {
+			return nil, err
+		}
+
+		match.Participants = append(match.Participants, participant)
+	}
+
+	return &match, rows.Err()
+}
+
+// GetCharacterMatches returns the most recent matches of a character,
+// newest first.
+func GetCharacterMatches(characterId int, limit int) ([]model.CharacterMatch, error) {
+
+	var exists int
+	err := db.QueryRow("SELECT id FROM characters WHERE id = $1", characterId).Scan(&exists)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrCharacterNotExist
+	case err != nil:
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT m.match_id, m.game_id, m.map_name, m.game_mode, m.started_on, m.ended_on, m.winning_team, p.team, p.outcome, p.stats
+		FROM match_participants p JOIN matches m USING (match_id)
+		WHERE p.character_id = $1
+		ORDER BY m.ended_on DESC, m.match_id DESC
+		LIMIT $2`, characterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.CharacterMatch, 0)
+	for rows.Next() {
+		var match model.CharacterMatch
+		var stats string
+		err = rows.Scan(&match.MatchId, &match.GameId, &match.Map, &match.Mode, &match.StartedOn, &match.EndedOn, &match.WinningTeam, &match.Team, &match.Outcome, &stats)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(stats), &match.Stats)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, match)
+	}
+
+	return list, rows.Err()
+}
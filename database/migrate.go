@@ -0,0 +1,123 @@
+package thordb
+
+import (
+	"log"
+
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+type MigrationResult struct {
+	Checked   int
+	Migrated  int
+	Conflicts int
+	Failed    int
+}
+
+// MigrateCharacters rewrites the game data of every character stored with
+// an older schema version. An upgrade only changes how the state is
+// stored, so it keeps the character's revision and snapshots of running
+// games written against it still apply. Rows are written against the
+// revision they were read at, so a character saved by a running game in
+// the meantime is counted as a conflict; that save already stored the new
+// schema.
+func MigrateCharacters(batchSize int, dryRun bool) (*MigrationResult, error) {
+
+	var result MigrationResult
+	lastId := 0
+
+	for {
+		rows, err := db.Query("SELECT id, last_game_id, revision, game_data FROM characters WHERE id > $1 ORDER BY id LIMIT $2", lastId, batchSize)
+		if err != nil {
+			return &result, err
+		}
+
+		type row struct {
+			id         int
+			lastGameId int
+			revision   int
+			gameData   string
+		}
+
+		batch := make([]row, 0, batchSize)
+		for rows.Next() {
+			var r row
+			err = rows.Scan(&r.id, &r.lastGameId, &r.revision, &r.gameData)
+			if err != nil {
+				rows.Close()
+				return &result, err
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+
+		if len(batch) == 0 {
+			return &result, nil
+		}
+
+		for _, r := range batch {
+
+			lastId = r.id
+			result.Checked++
+
+			upgraded, changed, err := model.UpgradeCharacterState([]byte(r.gameData))
+			if err != nil {
+				log.Printf("migrate: character %d: %v", r.id, err)
+				result.Failed++
+				continue
+			}
+
+			if !changed {
+				continue
+			}
+
+			if dryRun {
+				result.Migrated++
+				continue
+			}
+
+			err = migrateCharacter(r.id, r.lastGameId, r.revision, string(upgraded))
+			switch {
+			case err == ErrRevisionConflict:
+				result.Conflicts++
+			case err != nil:
+				log.Printf("migrate: character %d: %v", r.id, err)
+				result.Failed++
+			default:
+				result.Migrated++
+			}
+		}
+	}
+}
+
+func migrateCharacter(characterId int, lastGameId int, revision int, gameData string) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("UPDATE characters SET game_data = $1 WHERE id = $2 AND revision = $3", gameData, characterId, revision)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if rows == 0 {
+		tx.Rollback()
+		return ErrRevisionConflict
+	}
+
+	err = recordCharacterHistory(tx, characterId, revision, lastGameId, gameData, historySourceMigrate)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
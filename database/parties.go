@@ -0,0 +1,581 @@
+package thordb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/globals"
+	"github.com/jaybennett89/thorium-go/model"
+	"gopkg.in/redis.v3"
+)
+
+// redis keys of parties. An account's party expires with its session,
+// the party's own keys with the sessions of its members.
+const partyKey string = "parties/%d"
+const partyMembersKey string = "parties/%d/members"
+const partyInvitesKey string = "parties/%d/invites"
+const partyGameKey string = "parties/%d/game"
+const userPartyKey string = "parties/user/%d"
+const partyCounterKey string = "parties/next"
+const hkeyPartyLeader string = "leader"
+
+var ErrPartyNotExist = errors.New("thordb: party does not exist")
+var ErrNotInParty = errors.New("thordb: not in a party")
+var ErrAlreadyInParty = errors.New("thordb: already in a party")
+var ErrNotPartyLeader = errors.New("thordb: only the party leader can do this")
+var ErrPartyFull = errors.New("thordb: party is full")
+var ErrNoPartyInvite = errors.New("thordb: no invite to the party")
+
+func userParty(uid int) (int, error) {
+
+	value, err := kvstore.Get(fmt.Sprintf(userPartyKey, uid)).Result()
+	switch {
+	case err == redis.Nil:
+		return 0, ErrNotInParty
+	case err != nil:
+		return 0, err
+	}
+
+	return strconv.Atoi(value)
+}
+
+func partyLeader(partyId int) (int, error) {
+
+	value, err := kvstore.HGet(fmt.Sprintf(partyKey, partyId), hkeyPartyLeader).Result()
+	switch {
+	case err == redis.Nil:
+		return 0, ErrPartyNotExist
+	case err != nil:
+		return 0, err
+	}
+
+	return strconv.Atoi(value)
+}
+
+// sessionTTL is how long the session of an account has left.
+func sessionTTL(uid int) (time.Duration, error) {
+
+	ttl, err := kvstore.TTL(userSessionKey(uid)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	if ttl <= 0 {
+		return 0, ErrInvalidSessionKey
+	}
+
+	return ttl, nil
+}
+
+// expireParty keeps the party's keys at least as long as ttl, the session
+// of a member.
+func expireParty(partyId int, ttl time.Duration) error {
+
+	for _, key := range []string{partyKey, partyMembersKey, partyInvitesKey} {
+
+		key = fmt.Sprintf(key, partyId)
+		current, err := kvstore.TTL(key).Result()
+		if err != nil {
+			return err
+		}
+
+		if current >= ttl {
+			continue
+		}
+
+		err = kvstore.Expire(key, ttl).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// partyMembers returns the leader and members of a party. Members whose
+// session expired lost their party with it and are dropped, a new leader
+// is picked if the leader was one of them.
+func partyMembers(partyId int) (int, []int, error) {
+
+	leader, err := partyLeader(partyId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	membersKey := fmt.Sprintf(partyMembersKey, partyId)
+	members, err := partySet(membersKey)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	live := make([]int, 0, len(members))
+	for _, uid := range members {
+
+		current, err := userParty(uid)
+		switch {
+		case err == ErrNotInParty || (err == nil && current != partyId):
+			kvstore.SRem(membersKey, strconv.Itoa(uid))
+		case err != nil:
+			return 0, nil, err
+		default:
+			live = append(live, uid)
+		}
+	}
+
+	if len(live) == 0 {
+
+		err = deleteParty(partyId)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		return 0, nil, ErrPartyNotExist
+	}
+
+	i := sort.SearchInts(live, leader)
+	if i == len(live) || live[i] != leader {
+
+		leader = live[0]
+		err = kvstore.HSet(fmt.Sprintf(partyKey, partyId), hkeyPartyLeader, strconv.Itoa(leader)).Err()
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return leader, live, nil
+}
+
+func deleteParty(partyId int) error {
+
+	return kvstore.Del(fmt.Sprintf(partyKey, partyId), fmt.Sprintf(partyMembersKey, partyId),
+		fmt.Sprintf(partyInvitesKey, partyId), fmt.Sprintf(partyGameKey, partyId)).Err()
+}
+
+func partySet(key string) ([]int, error) {
+
+	values, err := kvstore.SMembers(key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(values))
+	for _, value := range values {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// leaderParty returns the party the session's account leads.
+func leaderParty(sessionKey string) (int, int, error) {
+
+	uid, err := validateToken(sessionKey)
+	if err != nil {
+		return 0, 0, ErrInvalidSessionKey
+	}
+
+	partyId, err := userParty(uid)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	leader, _, err := partyMembers(partyId)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if leader != uid {
+		return 0, 0, ErrNotPartyLeader
+	}
+
+	return uid, partyId, nil
+}
+
+// CreateParty starts a party led by the session's account.
+func CreateParty(sessionKey string) (*model.Party, error) {
+
+	uid, err := validateToken(sessionKey)
+	if err != nil {
+		return nil, ErrInvalidSessionKey
+	}
+
+	ttl, err := sessionTTL(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	partyId, err := kvstore.Incr(partyCounterKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := kvstore.SetNX(fmt.Sprintf(userPartyKey, uid), partyId, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrAlreadyInParty
+	}
+
+	err = kvstore.HSet(fmt.Sprintf(partyKey, partyId), hkeyPartyLeader, strconv.Itoa(uid)).Err()
+	if err != nil {
+		return nil, err
+	}
+
+	err = kvstore.SAdd(fmt.Sprintf(partyMembersKey, partyId), strconv.Itoa(uid)).Err()
+	if err != nil {
+		return nil, err
+	}
+
+	err = expireParty(int(partyId), ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return getParty(int(partyId))
+}
+
+// InviteToParty lets an account join the leader's party. Accounts that
+// blocked the leader can't be invited.
+func InviteToParty(sessionKey string, userId int, username string) error {
+
+	leader, partyId, err := leaderParty(sessionKey)
+	if err != nil {
+		return err
+	}
+
+	ttl, err := sessionTTL(leader)
+	if err != nil {
+		return err
+	}
+
+	uid, userId, err := friendTarget(sessionKey, userId, username)
+	if err != nil {
+		return err
+	}
+
+	var status string
+	err = db.QueryRow("SELECT status FROM friends WHERE user_id = $1 AND friend_id = $2", userId, uid).Scan(&status)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case status == friendBlocked:
+		return ErrFriendBlocked
+	}
+
+	err = kvstore.SAdd(fmt.Sprintf(partyInvitesKey, partyId), strconv.Itoa(userId)).Err()
+	if err != nil {
+		return err
+	}
+
+	return expireParty(partyId, ttl)
+}
+
+// AcceptPartyInvite joins a party the session's account was invited to.
+func AcceptPartyInvite(sessionKey string, partyId int) (*model.Party, error) {
+
+	uid, err := validateToken(sessionKey)
+	if err != nil {
+		return nil, ErrInvalidSessionKey
+	}
+
+	member := strconv.Itoa(uid)
+
+	invited, err := kvstore.SIsMember(fmt.Sprintf(partyInvitesKey, partyId), member).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if !invited {
+		return nil, ErrNoPartyInvite
+	}
+
+	ttl, err := sessionTTL(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	// members whose session expired don't take up places
+	_, _, err = partyMembers(partyId)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := kvstore.SetNX(fmt.Sprintf(userPartyKey, uid), partyId, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrAlreadyInParty
+	}
+
+	kvstore.SRem(fmt.Sprintf(partyInvitesKey, partyId), member)
+
+	membersKey := fmt.Sprintf(partyMembersKey, partyId)
+	err = kvstore.SAdd(membersKey, member).Err()
+	if err != nil {
+		return nil, err
+	}
+
+	// members are added before the size check so concurrent accepts can't
+	// both fit into the last place
+	size, err := kvstore.SCard(membersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if size > globals.MAX_PARTY_SIZE {
+		kvstore.SRem(membersKey, member)
+		kvstore.Del(fmt.Sprintf(userPartyKey, uid))
+		return nil, ErrPartyFull
+	}
+
+	err = expireParty(partyId, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return getParty(partyId)
+}
+
+// LeaveParty removes the session's account from its party. A leaving
+// leader hands over to the member with the lowest id, the last member
+// leaving ends the party.
+func LeaveParty(sessionKey string) error {
+
+	uid, err := validateToken(sessionKey)
+	if err != nil {
+		return ErrInvalidSessionKey
+	}
+
+	partyId, err := userParty(uid)
+	if err != nil {
+		return err
+	}
+
+	return removePartyMember(partyId, uid)
+}
+
+// KickFromParty removes a member from the leader's party.
+func KickFromParty(sessionKey string, userId int) error {
+
+	_, partyId, err := leaderParty(sessionKey)
+	if err != nil {
+		return err
+	}
+
+	member, err := kvstore.SIsMember(fmt.Sprintf(partyMembersKey, partyId), strconv.Itoa(userId)).Result()
+	if err != nil {
+		return err
+	}
+
+	if !member {
+		return ErrNotInParty
+	}
+
+	return removePartyMember(partyId, userId)
+}
+
+func removePartyMember(partyId int, uid int) error {
+
+	err := kvstore.SRem(fmt.Sprintf(partyMembersKey, partyId), strconv.Itoa(uid)).Err()
+	if err != nil {
+		return err
+	}
+
+	err = kvstore.Del(fmt.Sprintf(userPartyKey, uid)).Err()
+	if err != nil {
+		return err
+	}
+
+	// hands the party over or ends it when the leader left
+	_, _, err = partyMembers(partyId)
+	if err == ErrPartyNotExist {
+		return nil
+	}
+
+	return err
+}
+
+// leaveUserParty takes an account out of its party, if it is in one.
+func leaveUserParty(uid int) error {
+
+	partyId, err := userParty(uid)
+	switch {
+	case err == ErrNotInParty:
+		return nil
+	case err != nil:
+		return err
+	}
+
+	return removePartyMember(partyId, uid)
+}
+
+// GetParty returns the party of the session's account.
+func GetParty(sessionKey string) (*model.Party, error) {
+
+	uid, err := validateToken(sessionKey)
+	if err != nil {
+		return nil, ErrInvalidSessionKey
+	}
+
+	partyId, err := userParty(uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return getParty(partyId)
+}
+
+func getParty(partyId int) (*model.Party, error) {
+
+	leader, members, err := partyMembers(partyId)
+	if err != nil {
+		return nil, err
+	}
+
+	party := model.Party{PartyId: partyId, LeaderId: leader}
+
+	party.Members = make([]model.PartyMember, 0, len(members))
+	for _, id := range members {
+		member := model.PartyMember{UserId: id}
+		err = db.QueryRow("SELECT username FROM account_data WHERE user_id = $1", id).Scan(&member.Username)
+		if err != nil {
+			return nil, err
+		}
+		party.Members = append(party.Members, member)
+	}
+
+	party.Invited, err = partySet(fmt.Sprintf(partyInvitesKey, partyId))
+	if err != nil {
+		return nil, err
+	}
+
+	// the game is shown while the members' slots in it are held
+	gameId, err := kvstore.Get(fmt.Sprintf(partyGameKey, partyId)).Result()
+	switch {
+	case err == redis.Nil:
+	case err != nil:
+		return nil, err
+	default:
+		party.GameId, err = strconv.Atoi(gameId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &party, nil
+}
+
+// joiningAccounts returns who joins a game with the account: its party
+// when it leads one, itself otherwise. Party members can't join alone.
+func joiningAccounts(uid int) (int, []int, error) {
+
+	partyId, err := userParty(uid)
+	switch {
+	case err == ErrNotInParty:
+		return 0, []int{uid}, nil
+	case err != nil:
+		return 0, nil, err
+	}
+
+	leader, members, err := partyMembers(partyId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if leader != uid {
+		return 0, nil, ErrNotPartyLeader
+	}
+
+	return partyId, members, nil
+}
+
+// reserveSlots holds a slot of a game for each account until it connects
+// or the reservation expires, failing when the game can't fit them all.
+func reserveSlots(gameId int, accounts []int) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var playerCount, maxPlayers int
+	var endedOn *time.Time
+	err = tx.QueryRow("SELECT player_count, maximum_players, ended_on FROM games WHERE game_id = $1 FOR UPDATE", gameId).Scan(&playerCount, &maxPlayers, &endedOn)
+	switch {
+	case err == sql.ErrNoRows:
+		tx.Rollback()
+		return ErrGameNotExist
+	case err != nil:
+		tx.Rollback()
+		return err
+	}
+
+	if endedOn != nil {
+		tx.Rollback()
+		return ErrGameNotExist
+	}
+
+	now := time.Now()
+	expired := now.Add(-globals.GAME_RESERVATION_SECONDS * time.Second)
+
+	_, err = tx.Exec("DELETE FROM game_reservations WHERE game_id = $1 AND reserved_on <= $2", gameId, expired)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, uid := range accounts {
+		_, err = tx.Exec("DELETE FROM game_reservations WHERE user_id = $1", uid)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	var reserved int
+	err = tx.QueryRow("SELECT COUNT(*) FROM game_reservations WHERE game_id = $1", gameId).Scan(&reserved)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if playerCount+reserved+len(accounts) > maxPlayers {
+		tx.Rollback()
+		return ErrGameFull
+	}
+
+	for _, uid := range accounts {
+		_, err = tx.Exec("INSERT INTO game_reservations (user_id, game_id, reserved_on) VALUES ($1, $2, $3)", uid, gameId, now)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// reservedSlots counts the live reservations of a game held for other
+// accounts than uid.
+func reservedSlots(gameId int, uid int) (int, error) {
+
+	expired := time.Now().Add(-globals.GAME_RESERVATION_SECONDS * time.Second)
+
+	var reserved int
+	err := db.QueryRow("SELECT COUNT(*) FROM game_reservations WHERE game_id = $1 AND user_id <> $2 AND reserved_on > $3", gameId, uid, expired).Scan(&reserved)
+	return reserved, err
+}
@@ -0,0 +1,119 @@
+package thordb
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/jaybennett89/thorium-go/inventory"
+	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/progression"
+)
+
+const classTablePath string = "data/classes.json"
+
+var ErrUnknownClass = errors.New("thordb: unknown class")
+var errNoClassTable = errors.New("thordb: class table not loaded")
+
+var classTable *progression.Table
+var classTableOnce sync.Once
+
+// getClassTable reads data/classes.json once. Characters can't be created
+// or saved from snapshots without it.
+func getClassTable() (*progression.Table, error) {
+
+	classTableOnce.Do(func() {
+		table, err := progression.LoadFile(classTablePath)
+		if err != nil {
+			log.Print("thordb: ", err)
+			return
+		}
+		classTable = table
+	})
+
+	if classTable == nil {
+		return nil, errNoClassTable
+	}
+
+	return classTable, nil
+}
+
+// checkSnapshot checks a snapshot sent by a gameserver against the stored
+// state it replaces. Its inventory has to match the ledger version it was
+// read at, and its XP is counted against the cap of the game the character
+// is in. The stored row is locked
+// until the transaction ends.
+func checkSnapshot(tx *sql.Tx, character *model.Character) error {
+
+	table, err := getClassTable()
+	if err != nil {
+		return err
+	}
+
+	var gameData string
+	var ledger *string
+	var version int
+	err = tx.QueryRow("SELECT game_data, inventory, inventory_version FROM characters WHERE id = $1 AND revision = $2 FOR UPDATE", character.CharacterId, character.Revision).Scan(&gameData, &ledger, &version)
+	switch {
+	case err == sql.ErrNoRows:
+		return characterWriteError(tx, character.CharacterId)
+	case err != nil:
+		return err
+	}
+
+	stored, err := model.DecodeCharacterState([]byte(gameData))
+	if err != nil {
+		return err
+	}
+
+	err = overlayInventory(stored, ledger)
+	if err != nil {
+		return err
+	}
+
+	// the ledger changed since the gameserver read it, for example by a
+	// trade, so it replaces the snapshot's inventory
+	if character.InventoryVersion < version {
+		character.Inventory = stored.Inventory
+		character.InventoryVersion = version
+	}
+
+	if character.InventoryVersion != version || !inventory.Equal(stored.Inventory, character.Inventory) {
+		return ErrInventoryMismatch
+	}
+
+	// xp is counted against the game the character is in, not the one the
+	// snapshot names; characters outside of a game can't gain xp
+	gameId := 0
+	gained := table.MaxXPPerMatch
+	err = tx.QueryRow(`SELECT gc.game_id, gc.xp_gained FROM game_players p JOIN game_characters gc USING (game_id, character_id)
+		WHERE p.character_id = $1 FOR UPDATE OF gc`, character.CharacterId).Scan(&gameId, &gained)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	result, err := table.Progress(stored, &character.CharacterState, gained)
+	if err == progression.ErrUnknownClass {
+		return ErrUnknownClass
+	} else if err != nil {
+		return err
+	}
+
+	if result.Defaulted {
+		log.Printf("thordb: character %d had an unknown class, moved to class %d", character.CharacterId, stored.ClassId)
+	}
+
+	if result.Capped {
+		log.Printf("thordb: capped xp of character %d in game %d", character.CharacterId, gameId)
+	}
+
+	if result.Gained > 0 {
+		_, err = tx.Exec("UPDATE game_characters SET xp_gained = xp_gained + $1 WHERE game_id = $2 AND character_id = $3", result.Gained, gameId, character.CharacterId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package thordb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/requests"
+)
+
+// Reconciliation is what reconciling a machine with its game inventory
+// did. Stop lists the games the machine runs that it shouldn't, its
+// gameservers are for the caller to kill.
+type Reconciliation struct {
+	Adopted []int
+	Ended   []int
+	Stop    []int
+}
+
+// ReconcileMachine compares the games a machine launched with the games
+// the database says it hosts. Running games the database lost are
+// adopted, games it ended or gave to another machine are to be stopped,
+// and hosted games the machine no longer runs are ended. Anything that
+// changed within grace is left alone, a game may still be being created.
+func ReconcileMachine(machineId int, games []request.AnnouncedGame, grace time.Duration) (*Reconciliation, error) {
+
+	cutoff := time.Now().Add(-grace)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	hosted, err := hostedGames(tx, machineId)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	result := &Reconciliation{Adopted: make([]int, 0), Ended: make([]int, 0), Stop: make([]int, 0)}
+	running := make(map[int]bool)
+	recreated := false
+	for _, game := range games {
+
+		if game.Exited {
+			continue
+		}
+		running[game.GameId] = true
+
+		_, known := hosted[game.GameId]
+		if known || game.StartedOn.After(cutoff) {
+			continue
+		}
+
+		adopted, created, err := adoptGame(tx, machineId, nil, &game)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if adopted {
+			result.Adopted = append(result.Adopted, game.GameId)
+		} else {
+			result.Stop = append(result.Stop, game.GameId)
+		}
+		recreated = recreated || created
+	}
+
+	if recreated {
+
+		_, err = tx.Exec("SELECT setval('games_game_id_seq', (SELECT MAX(game_id) FROM games))")
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	for gameId, since := range hosted {
+
+		if running[gameId] || since.After(cutoff) {
+			continue
+		}
+
+		err = endGame(tx, gameId)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		log.Printf("machine %d no longer runs game %d, it is ended", machineId, gameId)
+		result.Ended = append(result.Ended, gameId)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, gameId := range result.Ended {
+		kvstore.Del(fmt.Sprintf(gameStatusKey, gameId))
+	}
+
+	return result, nil
+}
+
+// hostedGames maps the games the database has on a machine, loading or
+// running, to when they were kicked off or registered.
+func hostedGames(tx *sql.Tx, machineId int) (map[int]time.Time, error) {
+
+	rows, err := tx.Query(`SELECT game_id, registered_on FROM hosts WHERE machine_id = $1
+		UNION ALL SELECT game_id, kickoff_time FROM loading_hosts WHERE machine_id = $1`, machineId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hosted := make(map[int]time.Time)
+	for rows.Next() {
+
+		var gameId int
+		var since *time.Time
+		err = rows.Scan(&gameId, &since)
+		if err != nil {
+			return nil, err
+		}
+
+		// rows without a time predate them and are old enough
+		hosted[gameId] = time.Time{}
+		if since != nil {
+			hosted[gameId] = *since
+		}
+	}
+
+	return hosted, rows.Err()
+}
+
+// endGame removes a game from its host and marks it ended.
+func endGame(tx *sql.Tx, gameId int) error {
+
+	for _, query := range []string{
+		"DELETE FROM loading_hosts WHERE game_id = $1",
+		"DELETE FROM hosts WHERE game_id = $1",
+		"DELETE FROM game_players WHERE game_id = $1",
+		"DELETE FROM game_reservations WHERE game_id = $1",
+	} {
+
+		_, err := tx.Exec(query, gameId)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec("UPDATE games SET player_count = 0, ended_on = $1 WHERE game_id = $2", time.Now(), gameId)
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/rsa"
 	"crypto/sha1"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,8 +14,12 @@ import (
 	"io/ioutil"
 	"log"
 	"github.com/jaybennett89/thorium-go/client"
+	"github.com/jaybennett89/thorium-go/generate"
 	"github.com/jaybennett89/thorium-go/globals"
 	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/requests"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -37,6 +42,8 @@ var ErrInvalidSessionKey = errors.New("thordb: invalid session key")
 var ErrInvalidMachineKey = errors.New("thordb: invalid machine key")
 var ErrGameNotExist = errors.New("thordb: game does not exist")
 var ErrGameFull = errors.New("thordb: game is full")
+var ErrCharacterNotExist = errors.New("thordb: character does not exist")
+var ErrRevisionConflict = errors.New("thordb: revision conflict")
 
 var db *sql.DB
 var kvstore *redis.Client
@@ -94,7 +101,27 @@ func init() {
 	log.Print("thordb initialization complete")
 }
 
-func CreateNewGame(mapName string, gameMode string, minimumLevel int, maxPlayers int) (int, error) {
+// CreateNewGame checks the game against the map catalog, takes the
+// catalog's defaults for what isn't set, and starts it on a machine. Open
+// world games host worldRegion, other games pass nil.
+func CreateNewGame(mapName string, gameMode string, minimumLevel int, maxPlayers int, worldRegion *generate.Coordinate2D) (int, error) {
+
+	entry, err := GetMapEntry(mapName)
+	if err != nil {
+		return 0, err
+	}
+
+	minimumLevel, maxPlayers, err = entry.GameSettings(gameMode, minimumLevel, maxPlayers)
+	if err != nil {
+		return 0, err
+	}
+
+	err = checkWorldRegion(mapName, worldRegion)
+	if err != nil {
+		return 0, err
+	}
+
+	worldX, worldY := worldColumns(worldRegion)
 
 	tx, err := db.Begin()
 	if err != nil {
@@ -102,12 +129,12 @@ func CreateNewGame(mapName string, gameMode string, minimumLevel int, maxPlayers
 	}
 
 	var gameId int
-	err = tx.QueryRow("INSERT INTO games (map_name, game_mode, minimum_level, maximum_players) VALUES ( $1, $2, $3, $4 ) RETURNING game_id", mapName, gameMode, minimumLevel, maxPlayers).Scan(&gameId)
+	err = tx.QueryRow("INSERT INTO games (map_name, game_mode, minimum_level, maximum_players, world_x, world_y) VALUES ( $1, $2, $3, $4, $5, $6 ) RETURNING game_id", mapName, gameMode, minimumLevel, maxPlayers, worldX, worldY).Scan(&gameId)
 	if err != nil {
 		return 0, err
 	}
 
-	machineList, err := GetMachineList()
+	machineList, err := GetMachinesFor(mapName, gameMode, entry.Binary)
 	if err != nil {
 
 		err = tx.Rollback()
@@ -139,7 +166,14 @@ func CreateNewGame(mapName string, gameMode string, minimumLevel int, maxPlayers
 	fmt.Println("selected ", machine.RemoteAddress, ":", machine.ListenPort)
 
 	endpoint := fmt.Sprintf("%s:%d", machine.RemoteAddress, machine.ListenPort)
-	rc, body, err := client.NewGameServer(endpoint, gameId, mapName, gameMode, minimumLevel, maxPlayers)
+	rc, body, err := client.NewGameServer(endpoint, &request.NewGameServer{
+		GameId:         gameId,
+		Map:            mapName,
+		Mode:           gameMode,
+		MinimumLevel:   minimumLevel,
+		MaximumPlayers: maxPlayers,
+		Binary:         entry.Binary,
+		WorldRegion:    worldRegion})
 	if err != nil {
 
 		err = tx.Rollback()
@@ -201,13 +235,16 @@ func RegisterActiveGame(gameId int, machineKey string, listenPort int) error {
 		return err
 	}
 
-	_, err = tx.Exec("DELETE FROM loading_hosts WHERE game_id = $1 AND machine_id = $2", gameId, machineId)
-	if err != nil {
+	// the kickoff time is kept for the game detail
+	var kickoff *time.Time
+	err = tx.QueryRow("DELETE FROM loading_hosts WHERE game_id = $1 AND machine_id = $2 RETURNING kickoff_time", gameId, machineId).Scan(&kickoff)
+	if err != nil && err != sql.ErrNoRows {
 
+		tx.Rollback()
 		return err
 	}
 
-	_, err = tx.Exec("INSERT INTO hosts (game_id, machine_id, port) VALUES ( $1, $2, $3 )", gameId, machineId, listenPort)
+	_, err = tx.Exec("INSERT INTO hosts (game_id, machine_id, port, kickoff_time, registered_on) VALUES ( $1, $2, $3, $4, $5 )", gameId, machineId, listenPort, kickoff, time.Now())
 	if err != nil {
 
 		err = tx.Rollback()
@@ -228,6 +265,72 @@ func RegisterActiveGame(gameId int, machineKey string, listenPort int) error {
 	return nil
 }
 
+// UnregisterActiveGame removes a game from the hosts of its machine when
+// the gameserver shuts down. The games row is kept.
+func UnregisterActiveGame(gameId int, machineKey string) error {
+
+	machineId, valid, err := validateMachineKey(machineKey)
+	if err != nil {
+
+		return err
+	}
+
+	if !valid {
+
+		return ErrInvalidMachineKey
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM loading_hosts WHERE game_id = $1 AND machine_id = $2", gameId, machineId)
+	if err != nil {
+
+		tx.Rollback()
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM hosts WHERE game_id = $1 AND machine_id = $2", gameId, machineId)
+	if err != nil {
+
+		tx.Rollback()
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+
+		tx.Rollback()
+		return err
+	}
+
+	if rows == 0 {
+
+		tx.Rollback()
+		return ErrGameNotExist
+	}
+
+	err = endGame(tx, gameId)
+	if err != nil {
+
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// countPlayers sets a game's player count from its players, so it can't
+// drift from them.
+func countPlayers(tx *sql.Tx, gameId int) error {
+
+	_, err := tx.Exec("UPDATE games SET player_count = (SELECT COUNT(*) FROM game_players WHERE game_id = $1) WHERE game_id = $1", gameId)
+	return err
+}
+
 func RegisterAccount(username string, password string) (string, []int, error) {
 
 	var foundname string
@@ -487,6 +590,12 @@ func Disconnect(userToken string) error {
 
 	}
 
+	// the party would otherwise keep the account until its session expires
+	err = leaveUserParty(uid)
+	if err != nil {
+		return err
+	}
+
 	var count int64
 	count, err = kvstore.Del(fmt.Sprintf(sessionKey, uid)).Result()
 	if err != nil {
@@ -503,6 +612,12 @@ func Disconnect(userToken string) error {
 }
 
 // helper funcs
+// userSessionKey is the redis hash of an account's session. Functions
+// taking the session token as sessionKey shadow the format, use this.
+func userSessionKey(uid int) string {
+	return fmt.Sprintf(sessionKey, uid)
+}
+
 func storeAccount(session *AccountSession) {
 	// use this to store an account update in postgres
 }
@@ -582,18 +697,43 @@ func CreateCharacter(sessionKey string, name string, classId int) (int, error) {
 		return 0, errors.New("thordb: already in use")
 	}
 
+	table, err := getClassTable()
+	if err != nil {
+		return 0, err
+	}
+
 	character := model.NewCharacter()
 	character.Name = name
-	character.SetClassAttributes(classId)
+	err = table.NewCharacter(&character.CharacterState, classId)
+	if err != nil {
+		return 0, ErrUnknownClass
+	}
 
 	var jsonBytes []byte
-	jsonBytes, err = json.Marshal(character.CharacterState)
+	jsonBytes, err = model.EncodeCharacterState(&character.CharacterState)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		return 0, err
 	}
 
 	var id int
-	err = db.QueryRow("INSERT INTO characters (uid, name, game_data) VALUES ($1, $2, $3) RETURNING id", uid, character.Name, string(jsonBytes)).Scan(&id)
+	err = tx.QueryRow("INSERT INTO characters (uid, name, game_data) VALUES ($1, $2, $3) RETURNING id", uid, character.Name, string(jsonBytes)).Scan(&id)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = recordCharacterHistory(tx, id, 0, 0, string(jsonBytes), historySourceCreate)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return 0, err
 	}
@@ -645,9 +785,53 @@ func GetServerInfo(gameId int) (*model.HostServer, bool, error) {
 	return &host, true, nil
 }
 
-func SelectCharacter(sessionKey string, characterId int) (*model.Character, error) {
+// JoinGame finds the server of a game and holds a slot for the account
+// until it connects. With a friendId the game is the one that friend is
+// playing in. A party leader joins with the whole party, which is told
+// about the game through GetParty. The bool is false while the game is
+// still loading.
+func JoinGame(sessionKey string, gameId int, friendId int) (*model.HostServer, bool, error) {
 
 	uid, err := validateToken(sessionKey)
+	if err != nil {
+		return nil, false, ErrInvalidSessionKey
+	}
+
+	if friendId != 0 {
+		gameId, err = friendGame(uid, friendId)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	partyId, accounts, err := joiningAccounts(uid)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = reserveSlots(gameId, accounts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if partyId != 0 {
+		err = kvstore.Set(fmt.Sprintf(partyGameKey, partyId), strconv.Itoa(gameId), time.Second*globals.GAME_RESERVATION_SECONDS).Err()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	host, running, err := GetServerInfo(gameId)
+	if err == GameNotExistError {
+		return nil, false, ErrGameNotExist
+	}
+
+	return host, running, err
+}
+
+func SelectCharacter(userToken string, characterId int) (*model.Character, error) {
+
+	uid, err := validateToken(userToken)
 	if err != nil {
 		return nil, err
 	}
@@ -656,19 +840,29 @@ func SelectCharacter(sessionKey string, characterId int) (*model.Character, erro
 	character.CharacterId = characterId
 
 	var gameData string
+	var ledger *string
 
-	err = db.QueryRow("SELECT name, last_game_id, game_data FROM characters WHERE id = $1 AND uid = $2", characterId, uid).Scan(&character.Name, &character.LastGameId, &gameData)
+	err = db.QueryRow("SELECT name, last_game_id, revision, game_data, inventory, inventory_version FROM characters WHERE id = $1 AND uid = $2", characterId, uid).Scan(&character.Name, &character.LastGameId, &character.Revision, &gameData, &ledger, &character.InventoryVersion)
 	if err != nil {
 		return nil, err
 	}
 
-	var state model.CharacterState
-	err = json.Unmarshal([]byte(gameData), &state)
+	// friends see the selected character in their presence
+	kvstore.HSet(userSessionKey(uid), hkeySelectedCharacter, strconv.Itoa(characterId))
+
+	// older game data is upgraded to the current schema on load
+	state, err := model.DecodeCharacterState([]byte(gameData))
 	if err != nil {
 		return nil, err
 	}
 
-	character.CharacterState = state
+	character.CharacterState = *state
+
+	// the inventory ledger overrides the inventory in game data
+	err = overlayInventory(&character.CharacterState, ledger)
+	if err != nil {
+		return nil, err
+	}
 
 	return &character, nil
 }
@@ -692,42 +886,156 @@ func PlayerConnect(gameId int, machineKey string, sessionKey string, characterId
 		return nil, ErrInvalidSessionKey
 	}
 
-	var playerCount int
-	var maxPlayers int
+	var character model.Character
+	character.CharacterId = characterId
+
+	var gameData string
+	var ledger *string
 
-	err = db.QueryRow("SELECT player_count, maximum_players FROM games JOIN hosts USING (game_id) JOIN machines USING (machine_id) WHERE game_id = $1 AND machine_id = $2", gameId, machineId).Scan(&playerCount, &maxPlayers)
+	err = db.QueryRow("SELECT name, last_game_id, revision, game_data, inventory, inventory_version FROM characters WHERE id = $1 AND uid = $2", characterId, userId).Scan(&character.Name, &character.LastGameId, &character.Revision, &gameData, &ledger, &character.InventoryVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// older game data is upgraded to the current schema on load
+	state, err := model.DecodeCharacterState([]byte(gameData))
+	if err != nil {
+		return nil, err
+	}
+
+	character.CharacterState = *state
+
+	// the inventory ledger overrides the inventory in game data
+	err = overlayInventory(&character.CharacterState, ledger)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+
+		return nil, err
+	}
+
+	// the game row is locked so concurrent connects see each other's players
+	var maxPlayers int
+	err = tx.QueryRow("SELECT g.maximum_players FROM games g JOIN hosts h USING (game_id) WHERE g.game_id = $1 AND h.machine_id = $2 FOR UPDATE OF g", gameId, machineId).Scan(&maxPlayers)
 	switch {
 	case err == sql.ErrNoRows:
+		tx.Rollback()
 		return nil, ErrGameNotExist
 	case err != nil:
 		log.Print(err)
+		tx.Rollback()
+		return nil, err
+	}
+
+	// a character reconnecting to its game doesn't take a second slot
+	var playerCount int
+	err = tx.QueryRow("SELECT COUNT(*) FROM game_players WHERE game_id = $1 AND character_id <> $2", gameId, characterId).Scan(&playerCount)
+	if err != nil {
+
+		tx.Rollback()
 		return nil, err
 	}
 
-	if playerCount >= maxPlayers {
+	// slots held for other joining accounts are taken too
+	reserved, err := reservedSlots(gameId, userId)
+	if err != nil {
+
+		tx.Rollback()
+		return nil, err
+	}
+
+	if playerCount+reserved >= maxPlayers {
+
+		tx.Rollback()
 		return nil, ErrGameFull
 	}
 
-	var character model.Character
-	character.CharacterId = characterId
+	// a character is only in one game, drop it from any game it didn't leave
+	rows, err := tx.Query("DELETE FROM game_players WHERE character_id = $1 AND game_id <> $2 RETURNING game_id", characterId, gameId)
+	if err != nil {
 
-	var gameData string
+		tx.Rollback()
+		return nil, err
+	}
+
+	left := make([]int, 0)
+	for rows.Next() {
+		var previous int
+		err = rows.Scan(&previous)
+		if err != nil {
+			break
+		}
+		left = append(left, previous)
+	}
+	rows.Close()
 
-	err = db.QueryRow("SELECT name, last_game_id, game_data FROM characters WHERE id = $1 AND uid = $2", characterId, userId).Scan(&character.Name, &character.LastGameId, &gameData)
+	if err == nil {
+		err = rows.Err()
+	}
+
+	if err != nil {
+
+		tx.Rollback()
+		return nil, err
+	}
+
+	for _, previous := range left {
+
+		err = countPlayers(tx, previous)
+		if err != nil {
+
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM game_players WHERE character_id = $1", characterId)
 	if err != nil {
+
+		tx.Rollback()
 		return nil, err
 	}
 
-	var state model.CharacterState
-	err = json.Unmarshal([]byte(gameData), &state)
+	_, err = tx.Exec("INSERT INTO game_players (character_id, game_id, joined_on) VALUES ($1, $2, $3)", characterId, gameId, time.Now())
 	if err != nil {
+
+		tx.Rollback()
 		return nil, err
 	}
 
-	character.CharacterState = state
+	// kept after the character leaves, so reconnecting doesn't reset its xp cap
+	_, err = tx.Exec("INSERT INTO game_characters (game_id, character_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", gameId, characterId)
+	if err != nil {
 
-	// increment playercount
-	_, err = db.Exec("UPDATE games SET player_count = $1 WHERE game_id = $2", playerCount+1, gameId)
+		tx.Rollback()
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM game_reservations WHERE user_id = $1", userId)
+	if err != nil {
+
+		tx.Rollback()
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE characters SET last_game_id = $1 WHERE id = $2", gameId, characterId)
+	if err != nil {
+
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = countPlayers(tx, gameId)
+	if err != nil {
+
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
 	if err != nil {
 
 		return nil, err
@@ -749,30 +1057,41 @@ func PlayerDisconnect(machineKey string, gameId int, character *model.Character)
 		return ErrInvalidMachineKey
 	}
 
-	// todo: use gameId and machineId to validate that player exists in game
-	// this will require a new "players" table that links to hosts table
-	// and reworking the player_count into a count(*) of players table
+	tx, err := db.Begin()
+	if err != nil {
+
+		return err
+	}
+
+	// a stale or invalid snapshot is not stored, but the player still leaves the game
+	_, saveErr := saveCharacter(tx, character, historySourceDisconnect)
+	if saveErr != nil && saveErr != ErrRevisionConflict && saveErr != ErrInventoryMismatch && saveErr != ErrUnknownClass {
 
-	json, err := json.Marshal(&character.CharacterState)
+		tx.Rollback()
+		return saveErr
+	}
+
+	_, err = tx.Exec("DELETE FROM game_players WHERE character_id = $1 AND game_id = $2", character.CharacterId, gameId)
 	if err != nil {
 
+		tx.Rollback()
 		return err
 	}
 
-	_, err = db.Exec("UPDATE characters SET last_game_id = $1, game_data = $2 WHERE id = $3", character.LastGameId, string(json), character.CharacterId)
+	err = countPlayers(tx, gameId)
 	if err != nil {
 
+		tx.Rollback()
 		return err
 	}
 
-	// increment playercount
-	_, err = db.Exec("UPDATE games SET player_count = player_count - 1 WHERE game_id = $1", gameId)
+	err = tx.Commit()
 	if err != nil {
 
 		return err
 	}
 
-	return nil
+	return saveErr
 }
 
 func GetCharacter(machineKey string, characterId int) (*model.Character, error) {
@@ -798,76 +1117,316 @@ func GetCharacter(machineKey string, characterId int) (*model.Character, error)
 	character.CharacterId = characterId
 
 	var gameData string
+	var ledger *string
 
-	err = db.QueryRow("SELECT name, last_game_id, game_data FROM characters WHERE id = $1", characterId).Scan(&character.Name, &character.LastGameId, &gameData)
-	if err != nil {
+	err = db.QueryRow("SELECT name, last_game_id, revision, game_data, inventory, inventory_version FROM characters WHERE id = $1", characterId).Scan(&character.Name, &character.LastGameId, &character.Revision, &gameData, &ledger, &character.InventoryVersion)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrCharacterNotExist
+	case err != nil:
 		return nil, err
 	}
 
-	var state model.CharacterState
-	err = json.Unmarshal([]byte(gameData), &state)
+	// older game data is upgraded to the current schema on load
+	state, err := model.DecodeCharacterState([]byte(gameData))
 	if err != nil {
 		return nil, err
 	}
 
-	character.CharacterState = state
+	character.CharacterState = *state
+
+	// the inventory ledger overrides the inventory in game data
+	err = overlayInventory(&character.CharacterState, ledger)
+	if err != nil {
+		return nil, err
+	}
 
 	return &character, nil
 }
 
-func UpdateCharacter(machineKey string, character *model.Character) error {
+// UpdateCharacter stores a snapshot taken from character.Revision and
+// returns the new revision. ErrRevisionConflict is returned when the
+// character has been written since that revision was read.
+func UpdateCharacter(machineKey string, character *model.Character) (int, error) {
 
 	_, valid, err := validateMachineKey(machineKey)
 	if err != nil {
 
-		return err
+		return 0, err
 	}
 
 	if !valid {
 
-		return ErrInvalidMachineKey
+		return 0, ErrInvalidMachineKey
 	}
 
-	json, err := json.Marshal(&character.CharacterState)
+	tx, err := db.Begin()
 	if err != nil {
 
-		return err
+		return 0, err
 	}
 
-	_, err = db.Exec("UPDATE characters SET last_game_id = $1, game_data = $2 WHERE id = $3", character.LastGameId, string(json), character.CharacterId)
+	revision, err := saveCharacter(tx, character, historySourceUpdate)
 	if err != nil {
 
-		return err
+		tx.Rollback()
+		return 0, err
 	}
 
-	return nil
+	err = tx.Commit()
+	if err != nil {
+
+		return 0, err
+	}
+
+	return revision, nil
 }
 
-func GetGamesList() ([]model.Game, error) {
+// sort keys of the game list, paged by (key, game_id)
+var gameListSortColumns = map[string]string{
+	"id":         "g.game_id",
+	"players":    "g.player_count",
+	"free_slots": "(g.maximum_players - g.player_count)",
+	"min_level":  "g.minimum_level",
+}
+
+// GetGamesList returns one page of hosted games matching the query and
+// the cursor of the next page, which is empty on the last page. Games
+// without a loading or running server are never listed.
+func GetGamesList(query *request.GameListQuery) ([]model.Game, string, error) {
+
+	sort := strings.TrimPrefix(query.Sort, "-")
+	descending := strings.HasPrefix(query.Sort, "-")
 
-	rows, err := db.Query("SELECT * FROM games")
+	sortColumn, ok := gameListSortColumns[sort]
+	if !ok {
+		return nil, "", request.ErrBadQuery
+	}
+
+	conditions := []string{"(h.game_id IS NOT NULL OR lh.game_id IS NOT NULL)"}
+	args := []interface{}{}
+
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), -1))
+	}
+
+	if query.Map != "" {
+		where("g.map_name = ?", query.Map)
+	}
+	if query.Mode != "" {
+		where("g.game_mode = ?", query.Mode)
+	}
+	if query.Region != "" {
+		where("m.region = ?", query.Region)
+	}
+	if query.MinLevel > 0 {
+		where("g.minimum_level >= ?", query.MinLevel)
+	}
+	if query.MaxLevel > 0 {
+		where("g.minimum_level <= ?", query.MaxLevel)
+	}
+	if query.FreeSlots {
+		conditions = append(conditions, "g.player_count < g.maximum_players")
+	}
+	if query.Running {
+		conditions = append(conditions, "h.game_id IS NOT NULL")
+	}
+
+	order := "ASC"
+	compare := ">"
+	if descending {
+		order = "DESC"
+		compare = "<"
+	}
+
+	if query.Cursor != "" {
+		key, gameId, err := decodeGameCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, key, gameId)
+		conditions = append(conditions, fmt.Sprintf("(%s, g.game_id) %s ($%d, $%d)", sortColumn, compare, len(args)-1, len(args)))
+	}
+
+	args = append(args, query.Limit+1)
+
+	statement := fmt.Sprintf(`SELECT g.game_id, g.map_name, g.game_mode, g.minimum_level, g.player_count, g.maximum_players,
+			CASE WHEN h.game_id IS NOT NULL THEN '%s' ELSE '%s' END, COALESCE(m.region, ''), %s
+		FROM games g
+			LEFT JOIN hosts h ON h.game_id = g.game_id
+			LEFT JOIN loading_hosts lh ON lh.game_id = g.game_id
+			LEFT JOIN machines m ON m.machine_id = COALESCE(h.machine_id, lh.machine_id)
+		WHERE %s
+		ORDER BY %s %s, g.game_id %s
+		LIMIT $%d`,
+		model.GameRunning, model.GameLoading, sortColumn,
+		strings.Join(conditions, " AND "),
+		sortColumn, order, order, len(args))
+
+	rows, err := db.Query(statement, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	defer rows.Close()
 
-	list := make([]model.Game, 0)
+	list := make([]model.Game, 0, query.Limit)
+	cursor := ""
+	var lastKey int
 
 	for rows.Next() {
 		var game model.Game
-		err = rows.Scan(&game.GameId, &game.Map, &game.Mode, &game.MinimumLevel, &game.PlayerCount, &game.MaximumPlayers)
+		var key int
+		err = rows.Scan(&game.GameId, &game.Map, &game.Mode, &game.MinimumLevel, &game.PlayerCount, &game.MaximumPlayers, &game.HostStatus, &game.Region, &key)
 		if err != nil {
-			log.Print("game read error:", err)
-		} else {
-			list = append(list, game)
+			return nil, "", err
 		}
+
+		if len(list) == query.Limit {
+			// there is at least one more page
+			cursor = encodeGameCursor(query.Sort, lastKey, list[len(list)-1].GameId)
+			break
+		}
+
+		list = append(list, game)
+		lastKey = key
 	}
 
-	return list, nil
+	err = rows.Err()
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = attachServerStatus(gamePointers(list))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return list, cursor, nil
+}
+
+func gamePointers(list []model.Game) []*model.Game {
+
+	pointers := make([]*model.Game, len(list))
+	for i := range list {
+		pointers[i] = &list[i]
+	}
+	return pointers
+}
+
+// GetGameDetail returns a game in any lifecycle state with its host and
+// current players.
+func GetGameDetail(gameId int) (*model.GameDetail, error) {
+
+	var game model.GameDetail
+	var hostMachine, loadingMachine *int
+	var hostKickoff, loadingKickoff *time.Time
+	var worldX, worldY *int
+
+	err := db.QueryRow(`SELECT g.game_id, g.map_name, g.game_mode, g.minimum_level, g.player_count, g.maximum_players, g.ended_on,
+			h.machine_id, h.kickoff_time, h.registered_on, lh.machine_id, lh.kickoff_time, COALESCE(m.region, ''), g.world_x, g.world_y
+		FROM games g
+			LEFT JOIN hosts h ON h.game_id = g.game_id
+			LEFT JOIN loading_hosts lh ON lh.game_id = g.game_id
+			LEFT JOIN machines m ON m.machine_id = COALESCE(h.machine_id, lh.machine_id)
+		WHERE g.game_id = $1`, gameId).Scan(&game.GameId, &game.Map, &game.Mode, &game.MinimumLevel, &game.PlayerCount, &game.MaximumPlayers, &game.EndedOn,
+		&hostMachine, &hostKickoff, &game.RegisteredOn, &loadingMachine, &loadingKickoff, &game.Region, &worldX, &worldY)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrGameNotExist
+	case err != nil:
+		return nil, err
+	}
+
+	if worldX != nil && worldY != nil {
+		game.WorldRegion = &generate.Coordinate2D{X: *worldX, Y: *worldY}
+	}
+
+	switch {
+	case hostMachine != nil:
+		game.HostStatus = model.GameRunning
+		game.MachineId = *hostMachine
+		game.KickoffTime = hostKickoff
+		game.EndedOn = nil
+		if game.RegisteredOn != nil {
+			game.UptimeSeconds = int64(time.Since(*game.RegisteredOn) / time.Second)
+		}
+	case loadingMachine != nil:
+		game.HostStatus = model.GameLoading
+		game.MachineId = *loadingMachine
+		game.KickoffTime = loadingKickoff
+		game.EndedOn = nil
+	default:
+		game.HostStatus = model.GameEnded
+	}
+
+	err = attachServerStatus([]*model.Game{&game.Game})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT c.id, c.name, c.game_data, p.joined_on FROM game_players p JOIN characters c ON c.id = p.character_id WHERE p.game_id = $1 ORDER BY p.joined_on", gameId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	game.Players = make([]model.GamePlayer, 0)
+	for rows.Next() {
+		var player model.GamePlayer
+		var gameData string
+		err = rows.Scan(&player.CharacterId, &player.Name, &gameData, &player.JoinedOn)
+		if err != nil {
+			return nil, err
+		}
+
+		state, err := model.DecodeCharacterState([]byte(gameData))
+		if err != nil {
+			return nil, err
+		}
+
+		player.Level = state.Level
+		game.Players = append(game.Players, player)
+	}
+
+	return &game, rows.Err()
+}
+
+// game list cursors are opaque to clients and only valid for the sort
+// order they were made with
+func encodeGameCursor(sort string, key int, gameId int) string {
+
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d|%d", sort, key, gameId)))
+}
+
+func decodeGameCursor(cursor string, sort string) (int, int, error) {
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, request.ErrBadQuery
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || parts[0] != sort {
+		return 0, 0, request.ErrBadQuery
+	}
+
+	key, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, request.ErrBadQuery
+	}
+
+	gameId, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, 0, request.ErrBadQuery
+	}
+
+	return key, gameId, nil
 }
 
 func GetMachineList() ([]model.Machine, error) {
 
-	rows, err := db.Query("SELECT machine_id, remote_address, service_listen_port, most_recent_key FROM machines JOIN machines_metadata USING (machine_id)")
+	rows, err := db.Query("SELECT machine_id, remote_address, service_listen_port, most_recent_key, profiles FROM machines JOIN machines_metadata USING (machine_id)")
 	if err != nil {
 		return nil, err
 	}
@@ -876,7 +1435,11 @@ func GetMachineList() ([]model.Machine, error) {
 
 	for rows.Next() {
 		var m model.Machine
-		err = rows.Scan(&m.MachineId, &m.RemoteAddress, &m.ListenPort, &m.MachineKey)
+		var profiles sql.NullString
+		err = rows.Scan(&m.MachineId, &m.RemoteAddress, &m.ListenPort, &m.MachineKey, &profiles)
+		if err == nil && profiles.Valid {
+			err = json.Unmarshal([]byte(profiles.String), &m.Profiles)
+		}
 		if err != nil {
 			log.Print("machine read error:", err)
 		} else {
@@ -888,6 +1451,25 @@ func GetMachineList() ([]model.Machine, error) {
 
 }
 
+// GetMachinesFor lists the machines whose launch profiles can run a game
+// of map and mode with the given binary.
+func GetMachinesFor(mapName string, mode string, binary string) ([]model.Machine, error) {
+
+	machines, err := GetMachineList()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]model.Machine, 0, len(machines))
+	for _, m := range machines {
+		if model.SupportsGame(m.Profiles, mapName, mode, binary) {
+			list = append(list, m)
+		}
+	}
+
+	return list, nil
+}
+
 // ToDo: remove this func from public, only exposed for testing
 // this should be used internally to thordb only!
 func StoreCharacterSnapshot(charSession *CharacterSession) (bool, error) {
@@ -0,0 +1,256 @@
+package thordb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/trade"
+)
+
+var ErrNotCharacterOwner = errors.New("thordb: character belongs to another account")
+
+// tradeStore runs trade steps in Postgres transactions. Rows are locked
+// with SELECT ... FOR UPDATE and held until the step commits.
+type tradeStore struct{}
+
+func (tradeStore) Begin() (trade.Tx, error) {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tradeTx{tx: tx}, nil
+}
+
+type tradeTx struct {
+	tx *sql.Tx
+}
+
+func (t *tradeTx) Holders(characterIds ...int) (map[int]*trade.Holder, error) {
+
+	holders := make(map[int]*trade.Holder)
+	for _, id := range trade.SortedIds(characterIds...) {
+
+		var gameData string
+		var ledger *string
+		var online bool
+		err := t.tx.QueryRow(`SELECT game_data, inventory, EXISTS (SELECT 1 FROM game_players p WHERE p.character_id = c.id)
+			FROM characters c WHERE c.id = $1 FOR UPDATE`, id).Scan(&gameData, &ledger, &online)
+		switch {
+		case err == sql.ErrNoRows:
+			return nil, ErrCharacterNotExist
+		case err != nil:
+			return nil, err
+		}
+
+		state, err := model.DecodeCharacterState([]byte(gameData))
+		if err != nil {
+			return nil, err
+		}
+
+		err = overlayInventory(state, ledger)
+		if err != nil {
+			return nil, err
+		}
+
+		holders[id] = &trade.Holder{
+			CharacterId: id,
+			ClassId:     state.ClassId,
+			Online:      online,
+			Inventory:   state.Inventory}
+	}
+
+	return holders, nil
+}
+
+func (t *tradeTx) Trade(tradeId int) (*model.Trade, error) {
+
+	row := t.tx.QueryRow(`SELECT trade_id, from_character_id, to_character_id, offer, request, status, created_on, closed_on
+		FROM trades WHERE trade_id = $1 FOR UPDATE`, tradeId)
+
+	result, err := scanTrade(row)
+	if err == sql.ErrNoRows {
+		return nil, trade.ErrTradeNotExist
+	}
+
+	return result, err
+}
+
+func (t *tradeTx) CreateTrade(tr *model.Trade) (int, error) {
+
+	offer, err := json.Marshal(tr.Offer)
+	if err != nil {
+		return 0, err
+	}
+
+	request, err := json.Marshal(tr.Request)
+	if err != nil {
+		return 0, err
+	}
+
+	var tradeId int
+	err = t.tx.QueryRow(`INSERT INTO trades (from_character_id, to_character_id, offer, request, status, created_on)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING trade_id`,
+		tr.FromCharacterId, tr.ToCharacterId, string(offer), string(request), tr.Status, tr.CreatedOn).Scan(&tradeId)
+	return tradeId, err
+}
+
+func (t *tradeTx) UpdateTrade(tr *model.Trade) error {
+
+	_, err := t.tx.Exec("UPDATE trades SET status = $1, closed_on = $2 WHERE trade_id = $3", tr.Status, tr.ClosedOn, tr.TradeId)
+	return err
+}
+
+func (t *tradeTx) SetInventory(holder *trade.Holder, before []model.Item, action string, tradeId int) error {
+
+	op := InventoryOperation{Action: action, TradeId: tradeId}
+	_, err := writeInventory(t.tx, holder.CharacterId, before, holder.Inventory, &op, 0, 0)
+	return err
+}
+
+func (t *tradeTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *tradeTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTrade(row rowScanner) (*model.Trade, error) {
+
+	var tr model.Trade
+	var offer, request string
+	err := row.Scan(&tr.TradeId, &tr.FromCharacterId, &tr.ToCharacterId, &offer, &request, &tr.Status, &tr.CreatedOn, &tr.ClosedOn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(offer), &tr.Offer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(request), &tr.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tr, nil
+}
+
+func tradeService() (*trade.Service, error) {
+
+	catalog, err := GetItemCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	return &trade.Service{Catalog: catalog, Store: tradeStore{}}, nil
+}
+
+// checkCharacterOwner validates a session and that it owns the character.
+func checkCharacterOwner(sessionKey string, characterId int) error {
+
+	uid, err := validateToken(sessionKey)
+	if err != nil {
+		return ErrInvalidSessionKey
+	}
+
+	var owner int
+	err = db.QueryRow("SELECT uid FROM characters WHERE id = $1", characterId).Scan(&owner)
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrCharacterNotExist
+	case err != nil:
+		return err
+	}
+
+	if owner != uid {
+		return ErrNotCharacterOwner
+	}
+
+	return nil
+}
+
+// ProposeTrade offers items of one of the session's characters to another
+// character, see trade.Service.Propose.
+func ProposeTrade(sessionKey string, fromId int, toId int, offer []model.Item, request []model.Item) (*model.Trade, error) {
+
+	err := checkCharacterOwner(sessionKey, fromId)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := tradeService()
+	if err != nil {
+		return nil, err
+	}
+
+	return service.Propose(fromId, toId, offer, request)
+}
+
+func AcceptTrade(sessionKey string, tradeId int, characterId int) (*model.Trade, error) {
+
+	err := checkCharacterOwner(sessionKey, characterId)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := tradeService()
+	if err != nil {
+		return nil, err
+	}
+
+	return service.Accept(tradeId, characterId)
+}
+
+func CancelTrade(sessionKey string, tradeId int, characterId int) (*model.Trade, error) {
+
+	err := checkCharacterOwner(sessionKey, characterId)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := tradeService()
+	if err != nil {
+		return nil, err
+	}
+
+	return service.Cancel(tradeId, characterId)
+}
+
+// GetCharacterTrades returns the most recent trades a character proposed
+// or received, newest first.
+func GetCharacterTrades(sessionKey string, characterId int, limit int) ([]model.Trade, error) {
+
+	err := checkCharacterOwner(sessionKey, characterId)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT trade_id, from_character_id, to_character_id, offer, request, status, created_on, closed_on
+		FROM trades WHERE from_character_id = $1 OR to_character_id = $1
+		ORDER BY trade_id DESC LIMIT $2`, characterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.Trade, 0)
+	for rows.Next() {
+		tr, err := scanTrade(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *tr)
+	}
+
+	return list, rows.Err()
+}
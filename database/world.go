@@ -0,0 +1,216 @@
+package thordb
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/generate"
+	"github.com/jaybennett89/thorium-go/world"
+)
+
+// regions are generated up to this distance from the origin
+const maxRegionCoordinate int = 1000
+
+var ErrRegionOutOfBounds = errors.New("thordb: region is outside the world")
+var ErrWorldRegion = errors.New("thordb: open world games need a world region, other games can't have one")
+
+// checkWorldRegion makes sure a game hosts a region if and only if it is
+// played on the open world map. The region is generated if it is new.
+func checkWorldRegion(mapName string, region *generate.Coordinate2D) error {
+
+	if (mapName == world.OpenWorldMap) != (region != nil) {
+		return ErrWorldRegion
+	}
+
+	if region == nil {
+		return nil
+	}
+
+	_, err := GetRegion(*region)
+	return err
+}
+
+// worldColumns splits a game's region into its nullable columns.
+func worldColumns(region *generate.Coordinate2D) (*int, *int) {
+
+	if region == nil {
+		return nil, nil
+	}
+
+	return &region.X, &region.Y
+}
+
+var worldSeed int64
+var worldSeedMutex sync.Mutex
+
+// getWorldSeed reads the seed of the world, creating it on first use. It
+// never changes after that, every region is generated from it.
+func getWorldSeed() (int64, error) {
+
+	worldSeedMutex.Lock()
+	defer worldSeedMutex.Unlock()
+
+	if worldSeed != 0 {
+		return worldSeed, nil
+	}
+
+	var buf [8]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		return 0, err
+	}
+
+	seed := int64(binary.BigEndian.Uint64(buf[:]) >> 1)
+	_, err = db.Exec("INSERT INTO worlds (world_id, seed, created_on) VALUES (1, $1, $2) ON CONFLICT DO NOTHING", seed, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	err = db.QueryRow("SELECT seed FROM worlds WHERE world_id = 1").Scan(&worldSeed)
+	return worldSeed, err
+}
+
+// GetRegion returns the region at coord, generating and storing it the
+// first time it is asked for.
+func GetRegion(coord generate.Coordinate2D) (*generate.Region, error) {
+
+	if coord.X < -maxRegionCoordinate || coord.X > maxRegionCoordinate || coord.Y < -maxRegionCoordinate || coord.Y > maxRegionCoordinate {
+		return nil, ErrRegionOutOfBounds
+	}
+
+	var data string
+	err := db.QueryRow("SELECT region FROM world_regions WHERE x = $1 AND y = $2", coord.X, coord.Y).Scan(&data)
+	switch {
+	case err == sql.ErrNoRows:
+		return generateRegion(coord)
+	case err != nil:
+		return nil, err
+	}
+
+	return generate.DecodeRegion([]byte(data))
+}
+
+func generateRegion(coord generate.Coordinate2D) (*generate.Region, error) {
+
+	seed, err := getWorldSeed()
+	if err != nil {
+		return nil, err
+	}
+
+	region := generate.GenerateRegion(seed, coord, &generate.DefaultConfig)
+
+	data, err := json.Marshal(region)
+	if err != nil {
+		return nil, err
+	}
+
+	// concurrent requests generate the same region, the first one is kept
+	_, err = db.Exec(`INSERT INTO world_regions (x, y, spiral_index, region, created_on)
+		VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING`,
+		coord.X, coord.Y, region.Index, string(data), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var stored string
+	err = db.QueryRow("SELECT region FROM world_regions WHERE x = $1 AND y = $2", coord.X, coord.Y).Scan(&stored)
+	if err != nil {
+		return nil, err
+	}
+
+	return generate.DecodeRegion([]byte(stored))
+}
+
+// regions returned by one world map request at most
+const maxWorldMapRegions int = 500
+
+// scoreWorldSite applies a won match to a site of the open world inside
+// the transaction recording the match. The region row stays locked until
+// the match is stored.
+func scoreWorldSite(tx *sql.Tx, matchId int, site *world.Site, winningTeam int) error {
+
+	faction := world.FactionForTeam(winningTeam)
+	if faction == 0 {
+		return ErrBadMatchResult
+	}
+
+	var data string
+	err := tx.QueryRow("SELECT region FROM world_regions WHERE x = $1 AND y = $2 FOR UPDATE", site.X, site.Y).Scan(&data)
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrBadMatchResult
+	case err != nil:
+		return err
+	}
+
+	region, err := generate.DecodeRegion([]byte(data))
+	if err != nil {
+		return err
+	}
+
+	state, err := world.DefaultRules.Apply(region, *site, faction)
+	if err == world.ErrNoSite {
+		return ErrBadMatchResult
+	} else if err != nil {
+		return err
+	}
+
+	jsonBytes, err := json.Marshal(region)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE world_regions SET region = $1 WHERE x = $2 AND y = $3", string(jsonBytes), site.X, site.Y)
+	if err != nil {
+		return err
+	}
+
+	if state.Flipped {
+		log.Printf("world: region (%d,%d) town %d outpost %d taken by faction %d", site.X, site.Y, site.Town, site.Outpost, faction)
+	}
+
+	_, err = tx.Exec(`INSERT INTO world_site_log (match_id, x, y, town, outpost, faction, owner, score, flipped, recorded_on)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		matchId, site.X, site.Y, site.Town, site.Outpost, faction, state.Owner, state.Score, state.Flipped, time.Now())
+	return err
+}
+
+// GetWorldMap returns the ownership of the generated regions with spiral
+// indices from first to last. Regions nobody visited yet are neutral and
+// left out.
+func GetWorldMap(first int, last int) ([]world.RegionOwnership, error) {
+
+	if last-first >= maxWorldMapRegions {
+		last = first + maxWorldMapRegions - 1
+	}
+
+	rows, err := db.Query("SELECT region FROM world_regions WHERE spiral_index BETWEEN $1 AND $2 ORDER BY spiral_index", first, last)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]world.RegionOwnership, 0)
+	for rows.Next() {
+		var data string
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+
+		region, err := generate.DecodeRegion([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, world.Ownership(region))
+	}
+
+	return list, rows.Err()
+}
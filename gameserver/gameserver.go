@@ -0,0 +1,263 @@
+// Package gameserver implements the host-server protocol for gameservers
+// launched by a thorium host, so they only have to run the game itself.
+//
+// A gameserver calls Start once at startup. Start reads the arguments
+// and game token given by the launcher and registers the game with the
+// host-server.
+//
+//	server, err := gameserver.Start()
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer server.Shutdown()
+//
+// Players are then passed through Connect, Save and Disconnect.
+package gameserver
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/client"
+	"github.com/jaybennett89/thorium-go/generate"
+	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/requests"
+)
+
+var ErrBadArguments = errors.New("gameserver: missing launch arguments")
+var ErrNoCharacter = errors.New("gameserver: no character")
+
+// RequestTimeout bounds a single request to the host-server.
+var RequestTimeout = 5 * time.Second
+
+// Retry is used for every request to the host-server. Requests are retried
+// while the host-server can't be reached; reads also while it is waiting
+// on the master.
+var Retry = client.RetryPolicy{MaxAttempts: 5, Backoff: 100 * time.Millisecond}
+
+// StatusInterval is how often a gameserver should call ReportStatus. The
+// master keeps a report for three intervals.
+var StatusInterval = 10 * time.Second
+
+// Server is a gameserver process as seen by its host-server.
+type Server struct {
+	Game        model.Game
+	Token       string
+	ListenPort  int
+	ServicePort int
+
+	host *client.Host
+}
+
+// Start parses the command line and registers the game with the
+// host-server. Gameservers that take their own flags should define them
+// before calling Start.
+func Start() (*Server, error) {
+
+	server, err := ParseFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.Register()
+	if err != nil {
+		return nil, err
+	}
+
+	return server, nil
+}
+
+// ParseFlags reads the launch arguments from the command line.
+func ParseFlags() (*Server, error) {
+
+	return ParseArgs(flag.CommandLine, os.Args[1:])
+}
+
+// ParseArgs defines the launch arguments on fs and parses args with it.
+// These are the arguments passed by launch.NewGameServer. The game token
+// is read from the environment.
+func ParseArgs(fs *flag.FlagSet, args []string) (*Server, error) {
+
+	server := Server{Token: os.Getenv(client.GameTokenEnv)}
+
+	fs.IntVar(&server.Game.GameId, "id", 0, "identifies this game within the cluster")
+	fs.IntVar(&server.ListenPort, "listen", 0, "game server listen port")
+	fs.IntVar(&server.ServicePort, "service", 0, "machine local service port")
+	fs.StringVar(&server.Game.Map, "map", "mp_sandbox", "game map, from the master's map catalog")
+	fs.StringVar(&server.Game.Mode, "mode", "tutorial", "game mode, one the map allows in the catalog")
+	fs.IntVar(&server.Game.MinimumLevel, "minlvl", 0, "minimum level of player")
+	fs.IntVar(&server.Game.MaximumPlayers, "maxplayers", 16, "maximum player count")
+	region := fs.String("region", "", "world region an mp_openworld game hosts, as x,y")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if *region != "" {
+
+		var coord generate.Coordinate2D
+		_, err = fmt.Sscanf(*region, "%d,%d", &coord.X, &coord.Y)
+		if err != nil {
+			return nil, ErrBadArguments
+		}
+		server.Game.WorldRegion = &coord
+	}
+
+	if server.Token == "" || server.Game.GameId == 0 || server.ListenPort == 0 || server.ServicePort == 0 || server.Game.Map == "" || server.Game.Mode == "" {
+		return nil, ErrBadArguments
+	}
+
+	server.host = client.NewHost(server.ServiceEndpoint(), server.Token, server.Game.GameId, nil, RequestTimeout, Retry)
+
+	return &server, nil
+}
+
+// ServiceEndpoint is the address of the host-server's local API, which
+// only listens on the loopback interface.
+func (s *Server) ServiceEndpoint() string {
+	return fmt.Sprintf("127.0.0.1:%d", s.ServicePort)
+}
+
+// ListenAddr is the address players connect to, for example with
+// martini's RunOnAddr.
+func (s *Server) ListenAddr() string {
+	return fmt.Sprintf(":%d", s.ListenPort)
+}
+
+// Register tells the host-server, and through it the master, that the
+// game is ready for players on ListenPort.
+func (s *Server) Register() error {
+
+	return s.host.RegisterServer(context.Background(), s.ListenPort)
+}
+
+// Connect validates a player's session and returns the character they
+// selected. The player counts against the game's maximum until Disconnect.
+func (s *Server) Connect(sessionKey string, characterId int) (*model.Character, error) {
+
+	return s.host.PlayerConnect(context.Background(), sessionKey, characterId)
+}
+
+// Save stores a snapshot of a connected character.
+func (s *Server) Save(character *model.Character) error {
+
+	if character == nil {
+		return ErrNoCharacter
+	}
+
+	character.LastGameId = s.Game.GameId
+	return s.host.UpdateCharacter(context.Background(), character)
+}
+
+// Disconnect stores the final snapshot of a character and frees its slot.
+func (s *Server) Disconnect(character *model.Character) error {
+
+	if character == nil {
+		return ErrNoCharacter
+	}
+
+	character.LastGameId = s.Game.GameId
+	return s.host.PlayerDisconnect(context.Background(), character)
+}
+
+// ReportStatus sends the state of the match to the master. It should be
+// called at least every StatusInterval, a game without a recent report is
+// considered unhealthy.
+func (s *Server) ReportStatus(status *model.GameServerStatus) error {
+
+	return s.host.ReportStatus(context.Background(), status)
+}
+
+// ReportMatch archives the result of a finished match. Participants are
+// added with AddParticipant.
+func (s *Server) ReportMatch(result *request.MatchResult) (int, error) {
+
+	return s.host.ReportMatchResult(context.Background(), result)
+}
+
+// AddParticipant adds a character to a match result on its current team.
+func AddParticipant(result *request.MatchResult, character *model.Character, stats map[string]float64) {
+
+	result.Participants = append(result.Participants, request.MatchResultParticipant{
+		CharacterId: character.CharacterId,
+		Team:        character.Team,
+		Stats:       stats})
+}
+
+// LoadRegion returns the world region at coord, for mp_openworld games.
+// Their matches can only be fought over the sites of Game.WorldRegion.
+func (s *Server) LoadRegion(coord generate.Coordinate2D) (*generate.Region, error) {
+
+	return s.host.GetRegion(context.Background(), coord)
+}
+
+// The inventory of a character is kept by the master. These change it and
+// update character.Inventory to the master's result, which later snapshots
+// have to carry.
+
+func (s *Server) GrantItem(character *model.Character, itemId int, count int) error {
+
+	return s.changeInventory(character, "grant", &request.InventoryOperation{ItemId: itemId, Count: count})
+}
+
+func (s *Server) ConsumeItem(character *model.Character, itemId int, count int) error {
+
+	return s.changeInventory(character, "consume", &request.InventoryOperation{ItemId: itemId, Count: count})
+}
+
+func (s *Server) MoveItem(character *model.Character, slot int, toSlot int) error {
+
+	return s.changeInventory(character, "move", &request.InventoryOperation{Slot: slot, ToSlot: toSlot})
+}
+
+func (s *Server) DropItem(character *model.Character, slot int, count int) error {
+
+	return s.changeInventory(character, "drop", &request.InventoryOperation{Slot: slot, Count: count})
+}
+
+// RefreshInventory reloads character.Inventory from the master. Trades
+// change the inventory of a character while it plays. Snapshots read
+// before a trade get the traded inventory from the master, but the
+// gameserver only sees it after a refresh.
+func (s *Server) RefreshInventory(character *model.Character) error {
+
+	if character == nil {
+		return ErrNoCharacter
+	}
+
+	items, version, err := s.host.GetInventory(context.Background(), character.CharacterId)
+	if err != nil {
+		return err
+	}
+
+	character.Inventory = items
+	character.InventoryVersion = version
+	return nil
+}
+
+func (s *Server) changeInventory(character *model.Character, action string, op *request.InventoryOperation) error {
+
+	if character == nil {
+		return ErrNoCharacter
+	}
+
+	items, version, err := s.host.ChangeInventory(context.Background(), character.CharacterId, action, op)
+	if err != nil {
+		return err
+	}
+
+	character.Inventory = items
+	character.InventoryVersion = version
+	return nil
+}
+
+// Shutdown unregisters the game. Players should be disconnected first.
+func (s *Server) Shutdown() error {
+
+	return s.host.UnregisterServer(context.Background())
+}
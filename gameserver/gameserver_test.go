@@ -0,0 +1,138 @@
+package gameserver
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/jaybennett89/thorium-go/client"
+	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/requests"
+)
+
+func TestParseArgs_Missing(t *testing.T) {
+
+	os.Setenv(client.GameTokenEnv, "abc")
+	defer os.Unsetenv(client.GameTokenEnv)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err := ParseArgs(fs, []string{"-listen", "12690"})
+	if err != ErrBadArguments {
+		t.Fatalf("expected ErrBadArguments, got %v", err)
+	}
+}
+
+func TestParseArgs_NoToken(t *testing.T) {
+
+	os.Unsetenv(client.GameTokenEnv)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err := ParseArgs(fs, []string{"-id", "42", "-listen", "12690", "-service", "12000"})
+	if err != ErrBadArguments {
+		t.Fatalf("expected ErrBadArguments, got %v", err)
+	}
+}
+
+func TestParseArgs_Region(t *testing.T) {
+
+	os.Setenv(client.GameTokenEnv, "abc")
+	defer os.Unsetenv(client.GameTokenEnv)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	server, err := ParseArgs(fs, []string{"-id", "42", "-listen", "12690", "-service", "12000", "-map", "mp_openworld", "-region", "3,-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Game.WorldRegion == nil || server.Game.WorldRegion.X != 3 || server.Game.WorldRegion.Y != -2 {
+		t.Fatalf("expected region 3,-2, got %v", server.Game.WorldRegion)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err = ParseArgs(fs, []string{"-id", "42", "-listen", "12690", "-service", "12000", "-region", "north"})
+	if err != ErrBadArguments {
+		t.Fatalf("expected ErrBadArguments, got %v", err)
+	}
+}
+
+func TestServer_Lifecycle(t *testing.T) {
+
+	attempts := 0
+	var token string
+	var registered request.RegisterGameServer
+	var saved request.UpdateCharacter
+
+	host := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/games/register_server":
+			attempts++
+			if attempts == 1 {
+				w.WriteHeader(503)
+				return
+			}
+			token = r.Header.Get(client.GameTokenHeader)
+			json.NewDecoder(r.Body).Decode(&registered)
+		case "/games/player_connect":
+			character := model.NewCharacter()
+			character.CharacterId = 3
+			json.NewEncoder(w).Encode(&request.PlayerConnectResponse{Character: character})
+		case "/characters":
+			json.NewDecoder(r.Body).Decode(&saved)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer host.Close()
+
+	u, _ := url.Parse(host.URL)
+
+	os.Setenv(client.GameTokenEnv, "abc")
+	defer os.Unsetenv(client.GameTokenEnv)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	server, err := ParseArgs(fs, []string{"-id", "42", "-listen", "12690", "-service", u.Port()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a refused registration isn't retried, it may have reached the master
+	err = server.Register()
+	if err == nil || attempts != 1 {
+		t.Fatalf("unavailable host: attempts %d err %v", attempts, err)
+	}
+
+	err = server.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 2 || registered.GameId != 42 || registered.Port != 12690 || token != "abc" {
+		t.Fatalf("registered %+v after %d attempts", registered, attempts)
+	}
+
+	character, err := server.Connect("session", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = server.Save(character)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved.Snapshot == nil || saved.Snapshot.CharacterId != 3 || saved.Snapshot.LastGameId != 42 {
+		t.Fatalf("unexpected snapshot %+v", saved.Snapshot)
+	}
+}
+
+func TestServer_NoCharacter(t *testing.T) {
+
+	var server Server
+	if server.Save(nil) != ErrNoCharacter || server.Disconnect(nil) != ErrNoCharacter || server.GrantItem(nil, 1, 1) != ErrNoCharacter {
+		t.Fatal("nil character not refused")
+	}
+}
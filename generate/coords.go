@@ -1,15 +1,26 @@
-//package main
-
 package generate
 
 import (
 	"fmt"
-	"log"
-	"time"
-
-	"github.com/jaybennett89/intmath/intgr"
+	"math"
+	"sort"
 )
 
+// The world is laid out as a square spiral around the origin. Index 0 is
+// the origin and ring r holds the indices (2r-1)^2 through (2r+1)^2-1,
+// every coordinate whose larger axis distance from the origin is r. With
+// y pointing up, each ring starts just above its bottom left corner and
+// runs up the left side, along the top, down the right side and back
+// along the bottom:
+//
+//	12 13 14 15 16
+//	11  2  3  4 17
+//	10  1  0  5 18
+//	 9  8  7  6 19
+//	24 23 22 21 20
+//
+// GetIndex and IndexToCoordinate convert between the two exactly.
+
 type Position2D struct {
 	X float32
 	Y float32
@@ -24,6 +35,7 @@ func (c *Coordinate2D) String() string {
 	return fmt.Sprintf("(%d,%d)", c.X, c.Y)
 }
 
+// GetIndex returns the spiral index of the coordinate.
 func (c *Coordinate2D) GetIndex() int {
 
 	x := c.Y
@@ -52,24 +64,130 @@ func (c *Coordinate2D) GetIndex() int {
 	return res
 }
 
+// GetFirst returns the first coordinate of the ring the coordinate is on.
 func (c *Coordinate2D) GetFirst() Coordinate2D {
-	var first Coordinate2D
-	return first
+
+	r := c.Ring()
+	if r == 0 {
+		return Coordinate2D{}
+	}
+	return IndexToCoordinate(first(r))
+}
+
+// Ring returns the ring of the spiral the coordinate is on.
+func (c *Coordinate2D) Ring() int {
+	return max(abs(c.X), abs(c.Y))
 }
 
+// Neighbors returns the eight coordinates around c, in spiral order
+// around it.
+func (c *Coordinate2D) Neighbors() []Coordinate2D {
+
+	neighbors := make([]Coordinate2D, 0, 8)
+	for i := 1; i < 9; i++ {
+		offset := IndexToCoordinate(i)
+		neighbors = append(neighbors, Coordinate2D{X: c.X + offset.X, Y: c.Y + offset.Y})
+	}
+	return neighbors
+}
+
+// Distance is the number of steps between two coordinates when diagonal
+// steps are allowed. The distance of a coordinate to the origin is its
+// ring.
+func Distance(a, b Coordinate2D) int {
+	return max(abs(a.X-b.X), abs(a.Y-b.Y))
+}
+
+// IndexToCoordinate returns the coordinate at a spiral index, which must
+// not be negative.
 func IndexToCoordinate(index int) Coordinate2D {
+
+	if index < 0 {
+		panic("generate: negative spiral index")
+	}
+
 	var coord Coordinate2D
-	coord.X, coord.Y = position(index)
+	if index > 0 {
+		coord.X, coord.Y = position(index)
+	}
 	return coord
 }
 
+// RingIndices returns the first and last spiral index of ring r.
+func RingIndices(r int) (int, int) {
+
+	if r == 0 {
+		return 0, 0
+	}
+	return first(r), first(r+1) - 1
+}
+
+// RingCoordinates returns the coordinates of ring r in spiral order.
+func RingCoordinates(r int) []Coordinate2D {
+
+	start, end := RingIndices(r)
+	return CoordinatesInRange(start, end)
+}
+
+// CoordinatesInRange returns the coordinates with spiral indices from
+// start to end, both included.
+func CoordinatesInRange(start, end int) []Coordinate2D {
+
+	if end < start {
+		return nil
+	}
+
+	coords := make([]Coordinate2D, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		coords = append(coords, IndexToCoordinate(i))
+	}
+	return coords
+}
+
+// Interval is a range of spiral indices, both ends included.
+type Interval struct {
+	First int
+	Last  int
+}
+
+// IndexIntervals returns the fewest sorted intervals of spiral indices
+// that cover exactly the rectangle from low to high, both corners
+// included. A range query over the rectangle becomes one query per
+// interval.
+func IndexIntervals(low, high Coordinate2D) []Interval {
+
+	if high.X < low.X || high.Y < low.Y {
+		return nil
+	}
+
+	indices := make([]int, 0, (high.X-low.X+1)*(high.Y-low.Y+1))
+	for x := low.X; x <= high.X; x++ {
+		for y := low.Y; y <= high.Y; y++ {
+			c := Coordinate2D{X: x, Y: y}
+			indices = append(indices, c.GetIndex())
+		}
+	}
+	sort.Ints(indices)
+
+	intervals := []Interval{{First: indices[0], Last: indices[0]}}
+	for _, index := range indices[1:] {
+		last := &intervals[len(intervals)-1]
+		if index == last.Last+1 {
+			last.Last = index
+		} else {
+			intervals = append(intervals, Interval{First: index, Last: index})
+		}
+	}
+	return intervals
+}
+
 func first(cycle int) int {
 	x := 2*cycle - 1
 	return x * x
 }
 
 func cycle(index int) int {
-	return (intgr.Sqrt(index) + 1) / 2
+	return (isqrt(index) + 1) / 2
 }
 
 func length(cycle int) int {
@@ -100,35 +218,32 @@ func position(index int) (int, int) {
 	}
 }
 
-func test() {
-
-	loop_size := 500000
-	step_size := 1
-	step_start := 1
-
-	start_t := time.Now()
+// isqrt is the integer square root, exact where a float64 square root
+// rounds up.
+func isqrt(n int) int {
 
-	var coord Coordinate2D
-
-	var msg string
-	var rev int
-	for i := step_start; i < loop_size; i = i + step_size {
-		coord = IndexToCoordinate(i)
-		msg = coord.String()
-		rev = coord.GetIndex()
-		fmt.Printf("start=%d, calc=%s, reverse=%d\n", i, msg, rev)
+	r := int(math.Sqrt(float64(n)))
+	for r*r > n {
+		r--
 	}
+	for (r+1)*(r+1) <= n {
+		r++
+	}
+	return r
+}
 
-	loop_t := time.Now()
-
-	coord = IndexToCoordinate(2147483647)
-	fmt.Printf("max int 32 calc=%s rev=%d\n", coord.String(), coord.GetIndex())
-
-	coord = IndexToCoordinate(9223372036854775000)
-	fmt.Printf("max int 64 calc=%s rev=%d\n", coord.String(), coord.GetIndex())
+func abs(v int) int {
 
-	max_t := time.Now()
+	if v < 0 {
+		return -v
+	}
+	return v
+}
 
-	log.Println("testing 10K loop: ", loop_t.Sub(start_t), " int64 max:", max_t.Sub(loop_t))
+func max(a, b int) int {
 
+	if a > b {
+		return a
+	}
+	return b
 }
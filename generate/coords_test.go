@@ -0,0 +1,186 @@
+package generate
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+// coordinates within this distance keep every index well inside an int
+const testBound = 1 << 20
+
+type testCoord Coordinate2D
+
+func (testCoord) Generate(rng *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(testCoord{X: rng.Intn(2*testBound+1) - testBound, Y: rng.Intn(2*testBound+1) - testBound})
+}
+
+var quickConfig = &quick.Config{MaxCount: 5000}
+
+func TestSpiral_Layout(t *testing.T) {
+
+	want := [][]int{
+		{12, 13, 14, 15, 16},
+		{11, 2, 3, 4, 17},
+		{10, 1, 0, 5, 18},
+		{9, 8, 7, 6, 19},
+		{24, 23, 22, 21, 20},
+	}
+
+	for row, indices := range want {
+		for col, index := range indices {
+			c := Coordinate2D{X: col - 2, Y: 2 - row}
+			if c.GetIndex() != index || IndexToCoordinate(index) != c {
+				t.Errorf("%s: index %d, want %d", c.String(), c.GetIndex(), index)
+			}
+		}
+	}
+}
+
+func TestSpiral_Bijection(t *testing.T) {
+
+	// every index of the first 50 rings is hit exactly once
+	const rings = 50
+	seen := make(map[int]bool)
+	for x := -rings; x <= rings; x++ {
+		for y := -rings; y <= rings; y++ {
+			c := Coordinate2D{X: x, Y: y}
+			index := c.GetIndex()
+			if seen[index] {
+				t.Fatalf("index %d appears twice", index)
+			}
+			seen[index] = true
+		}
+	}
+
+	for i := 0; i < (2*rings+1)*(2*rings+1); i++ {
+		if !seen[i] {
+			t.Fatalf("index %d is missing", i)
+		}
+	}
+}
+
+func TestSpiral_RoundTrip(t *testing.T) {
+
+	coordToIndex := func(tc testCoord) bool {
+		c := Coordinate2D(tc)
+		return IndexToCoordinate(c.GetIndex()) == c
+	}
+
+	if err := quick.Check(coordToIndex, quickConfig); err != nil {
+		t.Error(err)
+	}
+
+	indexToCoord := func(raw uint32) bool {
+		index := int(raw >> 1)
+		c := IndexToCoordinate(index)
+		return c.GetIndex() == index
+	}
+
+	if err := quick.Check(indexToCoord, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSpiral_Rings(t *testing.T) {
+
+	ringHoldsIndex := func(tc testCoord) bool {
+		c := Coordinate2D(tc)
+		start, end := RingIndices(c.Ring())
+		index := c.GetIndex()
+		return start <= index && index <= end && c.Ring() == Distance(c, Coordinate2D{})
+	}
+
+	if err := quick.Check(ringHoldsIndex, quickConfig); err != nil {
+		t.Error(err)
+	}
+
+	for r := 0; r < 20; r++ {
+		coords := RingCoordinates(r)
+		if r > 0 && len(coords) != 8*r {
+			t.Fatalf("ring %d has %d coordinates", r, len(coords))
+		}
+
+		for i, c := range coords {
+			if c.Ring() != r {
+				t.Fatalf("%s is not on ring %d", c.String(), r)
+			}
+			if c.GetFirst() != coords[0] {
+				t.Fatalf("first of %s is %v, want %v", c.String(), c.GetFirst(), coords[0])
+			}
+			// consecutive indices are always adjacent
+			if i > 0 && Distance(coords[i-1], c) != 1 {
+				t.Fatalf("%v and %v are not adjacent", coords[i-1], c)
+			}
+		}
+	}
+}
+
+func TestSpiral_Neighbors(t *testing.T) {
+
+	neighbors := func(tc testCoord) bool {
+		c := Coordinate2D(tc)
+		seen := make(map[Coordinate2D]bool)
+		for _, n := range c.Neighbors() {
+			if Distance(c, n) != 1 || seen[n] {
+				return false
+			}
+			seen[n] = true
+		}
+		return len(seen) == 8
+	}
+
+	if err := quick.Check(neighbors, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSpiral_IndexIntervals(t *testing.T) {
+
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 200; n++ {
+
+		low := Coordinate2D{X: rng.Intn(41) - 20, Y: rng.Intn(41) - 20}
+		high := Coordinate2D{X: low.X + rng.Intn(8), Y: low.Y + rng.Intn(8)}
+
+		covered := 0
+		previous := -2
+		for _, interval := range IndexIntervals(low, high) {
+
+			if interval.First <= previous+1 || interval.Last < interval.First {
+				t.Fatalf("intervals overlap, touch or are unsorted: %v", IndexIntervals(low, high))
+			}
+			previous = interval.Last
+
+			for _, c := range CoordinatesInRange(interval.First, interval.Last) {
+				if c.X < low.X || c.X > high.X || c.Y < low.Y || c.Y > high.Y {
+					t.Fatalf("%s is outside %v-%v", c.String(), low, high)
+				}
+				covered++
+			}
+		}
+
+		if covered != (high.X-low.X+1)*(high.Y-low.Y+1) {
+			t.Fatalf("%d coordinates covered of %v-%v", covered, low, high)
+		}
+	}
+
+	square := IndexIntervals(Coordinate2D{X: -3, Y: -3}, Coordinate2D{X: 3, Y: 3})
+	if len(square) != 1 || square[0] != (Interval{First: 0, Last: 48}) {
+		t.Fatalf("square around the origin is not one interval: %v", square)
+	}
+}
+
+func TestIsqrt(t *testing.T) {
+
+	exact := func(raw uint64) bool {
+		n := int(raw >> 2)
+		r := isqrt(n)
+		return r*r <= n && (r+1)*(r+1) > n
+	}
+
+	if err := quick.Check(exact, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
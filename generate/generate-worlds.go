@@ -1,142 +1,218 @@
 package generate
 
 import (
-	"fmt"
-	"log"
+	"encoding/json"
 	"math/rand"
 )
 
-// Factions to be removed later into different file
+// Factions to be removed later into different file. Sites are owned by
+// one of them, or by none while neutral.
 const (
 	Red = 1 << iota
 	Blue
 )
 
+// Region is one square of the world map, at Location on the region grid.
+// Every location inside a region is relative to its corner and lies in
+// [0, Width).
 type Region struct {
-	Location Coordinate2D
-	Fortress *Fortress
+	Location Coordinate2D `json:"location"`
+	Index    int          `json:"index"`
+	Width    int          `json:"width"`
+	Fortress *Fortress    `json:"fortress"`
 }
 
 type Fortress struct {
-	Location Coordinate2D
-	Parent   *Region
-	Towns    []Town
+	Location Coordinate2D `json:"location"`
+	Parent   *Region      `json:"-"`
+	Towns    []Town       `json:"towns"`
 
-	FactionScore int
+	Owner        int `json:"owner"`
+	FactionScore int `json:"factionScore"`
 }
 
 type Town struct {
-	Location Coordinate2D
-	Parent   *Fortress
-	Outposts []Outpost
+	Location Coordinate2D `json:"location"`
+	Parent   *Fortress    `json:"-"`
+	Outposts []Outpost    `json:"outposts"`
 
-	FactionScore int
+	Owner        int `json:"owner"`
+	FactionScore int `json:"factionScore"`
 }
 
 type Outpost struct {
-	Location Coordinate2D
-	Parent   *Town
+	Location Coordinate2D `json:"location"`
+	Parent   *Town        `json:"-"`
 
-	FactionScore int // score 1-200: basic quests // 200-1000: intermediate quests // 1000+ advanced quests
+	Owner        int `json:"owner"`
+	FactionScore int `json:"factionScore"` // score 1-200: basic quests // 200-1000: intermediate quests // 1000+ advanced quests
 }
 
-var loop_size int
-var region_width int
-var min_towns int
-var max_towns int
+// Config sets the size of regions, how many towns and outposts they get,
+// and how far apart their sites are kept. Towns and outposts that can't be
+// placed under the distances are left out, so crowded configs may give
+// fewer than the minimum.
+type Config struct {
+	RegionWidth int
 
-// outposts per town
-var min_outposts int
-var max_outposts int
+	// fortress distance from the region's center, in each axis
+	MaxDisplacement int
 
-func __init() {
-	fmt.Println("Init")
+	MinTowns int
+	MaxTowns int
 
-	loop_size = 8
-	region_width = 20
-	min_towns = 2
-	max_towns = 4
-	min_outposts = 2
-	max_outposts = 4
+	// outposts per town, placed within OutpostRange of it
+	MinOutposts  int
+	MaxOutposts  int
+	OutpostRange int
 
-	// can't divide by zero!
-	var zero Coordinate2D
-	region_zero := GenerateRegion(zero, region_width)
-	printRegion(region_zero)
+	// minimum distances between sites
+	TownFortressDistance    float64
+	TownDistance            float64
+	OutpostFortressDistance float64
+	OutpostTownDistance     float64
 
-	// building loop
-	var coord Coordinate2D
-	for i := 1; i < loop_size; i++ {
-		coord = IndexToCoordinate(i)
+	// cells towns keep clear of the region's edge
+	TownMargin int
 
-		var megacoord Coordinate2D
-		megacoord.X = coord.X * region_width
-		megacoord.Y = coord.Y * region_width
+	// random tries for a site before scanning for a free cell
+	Attempts int
+}
 
-		//GenerateRegion(megacoord, region_width)
-	}
+var DefaultConfig = Config{
+	RegionWidth:             20,
+	MaxDisplacement:         2,
+	MinTowns:                2,
+	MaxTowns:                4,
+	MinOutposts:             2,
+	MaxOutposts:             4,
+	OutpostRange:            4,
+	TownFortressDistance:    5,
+	TownDistance:            6,
+	OutpostFortressDistance: 6,
+	OutpostTownDistance:     3,
+	TownMargin:              2,
+	Attempts:                20,
 }
 
-func GenerateRegion(coord Coordinate2D, region_width int) *Region {
-	log.Print("Generating Region @ ", coord)
+// GenerateRegion builds the region at coord of the world with the given
+// seed. The same seed, coordinate and config always give the same region,
+// since every stage draws from its own StageRand stream.
+func GenerateRegion(seed int64, coord Coordinate2D, config *Config) *Region {
+
+	index := coord.GetIndex()
+	region := &Region{
+		Location: coord,
+		Index:    index,
+		Width:    config.RegionWidth}
+
+	area := &Area{Location: coord, Width: config.RegionWidth}
+	GenerateFortress(StageRand(seed, index, StageFortress, 0), region, config, area)
+
+	towns := StageRand(seed, index, StageTowns, 0)
+	count := between(towns, config.MinTowns, config.MaxTowns)
+	for i := 0; i < count; i++ {
+
+		town := GenerateTown(towns, region.Fortress, config, area)
+		if town == nil {
+			break
+		}
+
+		outposts := StageRand(seed, index, StageOutposts, i)
+		count := between(outposts, config.MinOutposts, config.MaxOutposts)
+		for j := 0; j < count; j++ {
+			GenerateOutpost(outposts, town, region.Width, config, area)
+		}
+	}
 
-	region_data := new(Region)
-	// Generate A Fortress
-	GenerateFortress(region_data)
+	// appending towns moves them, parents are set once they are in place
+	region.Link()
+	return region
+}
 
-	// Generate Towns + Update Fortress Struct
-	// Generate Outposts + Update Fortress Struct
+// GenerateFortress places the region's fortress near its center.
+func GenerateFortress(rng *rand.Rand, region *Region, config *Config, area *Area) {
 
-	return region_data
+	mid := region.Width / 2
+	location := Coordinate2D{
+		X: mid + between(rng, -config.MaxDisplacement, config.MaxDisplacement),
+		Y: mid + between(rng, -config.MaxDisplacement, config.MaxDisplacement)}
+
+	region.Fortress = &Fortress{Location: location, Parent: region}
+	area.add(NodeFortress, location)
 }
 
-func GenerateFortress(region_data *Region) {
-	log.Print("Generating Fortress")
+// GenerateTown places a town anywhere in the region that keeps its
+// distance from the other sites. It returns nil when there is no room.
+// The town is only valid until the next one is added.
+func GenerateTown(rng *rand.Rand, fortress *Fortress, config *Config, area *Area) *Town {
 
-	// generate location
-	max_displacement := 2
-	x_offset := rand.Intn(max_displacement*2+1) - max_displacement
-	y_offset := rand.Intn(max_displacement*2+1) - max_displacement
+	width := fortress.Parent.Width
+	m := config.TownMargin
+	location, ok := area.place(rng, config, NodeTown, m, width-1-m, m, width-1-m)
+	if !ok {
+		return nil
+	}
 
-	var location Coordinate2D
-	location.X = x_offset
-	location.Y = y_offset
+	fortress.Towns = append(fortress.Towns, Town{Location: location, Parent: fortress})
+	return &fortress.Towns[len(fortress.Towns)-1]
+}
 
-	region_data.Fortress.Location = location
+// GenerateOutpost places an outpost near its town.
+func GenerateOutpost(rng *rand.Rand, town *Town, width int, config *Config, area *Area) {
 
-	var town_count int
-	town_count = rand.Intn(max_towns-min_towns+1) + min_towns
-	log.Print("Town Count: ", town_count)
-	for i := 0; i < town_count; i++ {
-		GenerateTown(region_data)
+	r := config.OutpostRange
+	location, ok := area.place(rng, config, NodeOutpost,
+		clamp(town.Location.X-r, 0, width-1), clamp(town.Location.X+r, 0, width-1),
+		clamp(town.Location.Y-r, 0, width-1), clamp(town.Location.Y+r, 0, width-1))
+	if !ok {
+		return
 	}
+
+	town.Outposts = append(town.Outposts, Outpost{Location: location, Parent: town})
 }
 
-func GenerateTown(region_data *Region) {
-	log.Print("Generating Town")
+// DecodeRegion reads a region stored as JSON and links its parents.
+func DecodeRegion(data []byte) (*Region, error) {
 
-	// Choose town location
-	// Choose starting FactionScore
+	var region Region
+	err := json.Unmarshal(data, &region)
+	if err != nil {
+		return nil, err
+	}
 
-	// Choose number of outposts
-	// Generate Outposts
-	var outpost_count int
+	region.Link()
+	return &region, nil
+}
 
-	outpost_count = rand.Intn(max_outposts-min_outposts+1) + min_outposts
-	log.Print("Outpost Count: ", outpost_count)
+// Link sets the Parent of everything in the region.
+func (r *Region) Link() {
 
-	for i := 0; i < outpost_count; i++ {
-		GenerateOutpost(region_data)
+	if r.Fortress == nil {
+		return
 	}
 
-	// Add to region data
+	r.Fortress.Parent = r
+	for i := range r.Fortress.Towns {
+		town := &r.Fortress.Towns[i]
+		town.Parent = r.Fortress
+		for j := range town.Outposts {
+			town.Outposts[j].Parent = town
+		}
+	}
 }
 
-func GenerateOutpost(region_data *Region) {
-	log.Print("Generating Outpost")
+func between(rng *rand.Rand, min, max int) int {
+	return rng.Intn(max-min+1) + min
 }
 
-func printRegion(region_data *Region) {
-	message := fmt.Sprintf("Region:%s Fortress:%s\n", region_data.Location, region_data.Fortress.Location)
-	log.Print(message)
+func clamp(value, min, max int) int {
+
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
 }
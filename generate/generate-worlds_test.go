@@ -0,0 +1,97 @@
+package generate
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateRegion_Deterministic(t *testing.T) {
+
+	coord := Coordinate2D{X: 3, Y: -2}
+
+	a, _ := json.Marshal(GenerateRegion(42, coord, &DefaultConfig))
+	b, _ := json.Marshal(GenerateRegion(42, coord, &DefaultConfig))
+	if string(a) != string(b) {
+		t.Fatalf("same seed gave different regions:\n%s\n%s", a, b)
+	}
+
+	c, _ := json.Marshal(GenerateRegion(43, coord, &DefaultConfig))
+	if string(a) == string(c) {
+		t.Fatal("different seeds gave the same region")
+	}
+}
+
+func TestGenerateRegion_Complete(t *testing.T) {
+
+	config := DefaultConfig
+	for x := -3; x <= 3; x++ {
+		for y := -3; y <= 3; y++ {
+
+			region := GenerateRegion(7, Coordinate2D{X: x, Y: y}, &config)
+			if region.Fortress == nil || region.Fortress.Parent != region {
+				t.Fatalf("region (%d,%d) has no fortress", x, y)
+			}
+
+			for i := range region.Fortress.Towns {
+				town := &region.Fortress.Towns[i]
+				if town.Parent != region.Fortress || (len(town.Outposts) > 0 && town.Outposts[0].Parent != town) {
+					t.Fatalf("region (%d,%d) has unlinked towns", x, y)
+				}
+			}
+
+			towns := len(region.Fortress.Towns)
+			if towns < config.MinTowns || towns > config.MaxTowns {
+				t.Fatalf("region (%d,%d) has %d towns", x, y, towns)
+			}
+
+			used := map[Coordinate2D]bool{region.Fortress.Location: true}
+			for _, town := range region.Fortress.Towns {
+
+				outposts := len(town.Outposts)
+				if outposts < config.MinOutposts || outposts > config.MaxOutposts {
+					t.Fatalf("town %v has %d outposts", town.Location, outposts)
+				}
+
+				locations := []Coordinate2D{town.Location}
+				for _, outpost := range town.Outposts {
+					locations = append(locations, outpost.Location)
+				}
+
+				for _, l := range locations {
+					if l.X < 0 || l.Y < 0 || l.X >= region.Width || l.Y >= region.Width {
+						t.Fatalf("location %v outside region", l)
+					}
+					if used[l] {
+						t.Fatalf("location %v used twice", l)
+					}
+					used[l] = true
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeRegion_LinksParents(t *testing.T) {
+
+	region := GenerateRegion(1, Coordinate2D{X: 1, Y: 1}, &DefaultConfig)
+	data, err := json.Marshal(region)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeRegion(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	town := &decoded.Fortress.Towns[0]
+	if decoded.Fortress.Parent != decoded || town.Parent != decoded.Fortress || town.Outposts[0].Parent != town {
+		t.Fatal("parents not linked")
+	}
+
+	again, _ := json.Marshal(decoded)
+	if !reflect.DeepEqual(data, again) {
+		t.Fatal("region changed through JSON")
+	}
+}
@@ -0,0 +1,174 @@
+package generate
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// NodeType is the kind of site an AreaNode is.
+type NodeType int
+
+const (
+	NodeFortress NodeType = iota
+	NodeTown
+	NodeOutpost
+)
+
+var ErrNodeType = errors.New("generate: unknown node type")
+
+var nodeNames = []string{"fortress", "town", "outpost"}
+
+func (t NodeType) String() string {
+
+	if t < 0 || int(t) >= len(nodeNames) {
+		return "unknown"
+	}
+	return nodeNames[t]
+}
+
+func (t NodeType) MarshalText() ([]byte, error) {
+
+	if t < 0 || int(t) >= len(nodeNames) {
+		return nil, ErrNodeType
+	}
+	return []byte(nodeNames[t]), nil
+}
+
+func (t *NodeType) UnmarshalText(text []byte) error {
+
+	for i, name := range nodeNames {
+		if name == string(text) {
+			*t = NodeType(i)
+			return nil
+		}
+	}
+	return ErrNodeType
+}
+
+// AreaNode is a site placed on a region's grid.
+type AreaNode struct {
+	Type     NodeType     `json:"type"`
+	Location Coordinate2D `json:"location"`
+}
+
+// Area is the flat layout of a region: every site it holds, in the order
+// they were placed. The generators fill it while they build the region,
+// and it is what the spacing rules of a Config are checked against.
+type Area struct {
+	Location Coordinate2D `json:"location"`
+	Width    int          `json:"width"`
+	Nodes    []AreaNode   `json:"nodes"`
+}
+
+// Area returns the layout of an already built region.
+func (r *Region) Area() *Area {
+
+	area := &Area{Location: r.Location, Width: r.Width, Nodes: make([]AreaNode, 0)}
+	if r.Fortress == nil {
+		return area
+	}
+
+	area.add(NodeFortress, r.Fortress.Location)
+	for _, town := range r.Fortress.Towns {
+		area.add(NodeTown, town.Location)
+		for _, outpost := range town.Outposts {
+			area.add(NodeOutpost, outpost.Location)
+		}
+	}
+	return area
+}
+
+// At returns the node at a location of the area, if there is one.
+func (a *Area) At(location Coordinate2D) (AreaNode, bool) {
+
+	for _, node := range a.Nodes {
+		if node.Location == location {
+			return node, true
+		}
+	}
+	return AreaNode{}, false
+}
+
+// Fits reports whether a node of the given type may go at location: it
+// must be inside the area, on a free cell, and far enough from every node
+// already placed.
+func (a *Area) Fits(config *Config, t NodeType, location Coordinate2D) bool {
+
+	margin := 0
+	if t == NodeTown {
+		margin = config.TownMargin
+	}
+
+	if location.X < margin || location.Y < margin || location.X >= a.Width-margin || location.Y >= a.Width-margin {
+		return false
+	}
+
+	for _, node := range a.Nodes {
+		if node.Location == location {
+			return false
+		}
+		if dist(node.Location, location) < config.spacing(t, node.Type) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Area) add(t NodeType, location Coordinate2D) {
+	a.Nodes = append(a.Nodes, AreaNode{Type: t, Location: location})
+}
+
+// place picks a location in the rectangle that fits a node of type t and
+// adds the node. A few random tries are made before scanning the
+// rectangle in order, so crowded regions still fill up deterministically.
+func (a *Area) place(rng *rand.Rand, config *Config, t NodeType, minX, maxX, minY, maxY int) (Coordinate2D, bool) {
+
+	for try := 0; try < config.Attempts; try++ {
+		location := Coordinate2D{X: between(rng, minX, maxX), Y: between(rng, minY, maxY)}
+		if a.Fits(config, t, location) {
+			a.add(t, location)
+			return location, true
+		}
+	}
+
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			location := Coordinate2D{X: x, Y: y}
+			if a.Fits(config, t, location) {
+				a.add(t, location)
+				return location, true
+			}
+		}
+	}
+
+	return Coordinate2D{}, false
+}
+
+// spacing is the minimum distance between nodes of two types. Outposts
+// only need a cell of their own.
+func (c *Config) spacing(a, b NodeType) float64 {
+
+	if a > b {
+		a, b = b, a
+	}
+
+	switch {
+	case a == NodeFortress && b == NodeTown:
+		return c.TownFortressDistance
+	case a == NodeFortress && b == NodeOutpost:
+		return c.OutpostFortressDistance
+	case a == NodeTown && b == NodeTown:
+		return c.TownDistance
+	case a == NodeTown && b == NodeOutpost:
+		return c.OutpostTownDistance
+	}
+	return 1
+}
+
+func dist(a, b Coordinate2D) float64 {
+
+	dx := float64(a.X - b.X)
+	dy := float64(a.Y - b.Y)
+	return math.Sqrt(dx*dx + dy*dy)
+}
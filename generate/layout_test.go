@@ -0,0 +1,83 @@
+package generate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestArea_Spacing(t *testing.T) {
+
+	config := DefaultConfig
+	for seed := int64(0); seed < 50; seed++ {
+		for i := 0; i < 25; i++ {
+
+			region := GenerateRegion(seed, IndexToCoordinate(i), &config)
+			area := region.Area()
+
+			towns := len(region.Fortress.Towns)
+			if towns < config.MinTowns {
+				t.Fatalf("seed %d region %d has %d towns", seed, i, towns)
+			}
+			for _, town := range region.Fortress.Towns {
+				if len(town.Outposts) < config.MinOutposts {
+					t.Fatalf("seed %d region %d town %v has %d outposts", seed, i, town.Location, len(town.Outposts))
+				}
+			}
+
+			for j, a := range area.Nodes {
+				for _, b := range area.Nodes[j+1:] {
+					if dist(a.Location, b.Location) < config.spacing(a.Type, b.Type) {
+						t.Fatalf("seed %d region %d: %v at %v too close to %v at %v", seed, i, a.Type, a.Location, b.Type, b.Location)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestArea_Fits(t *testing.T) {
+
+	config := DefaultConfig
+	area := &Area{Width: 20}
+	area.add(NodeFortress, Coordinate2D{X: 10, Y: 10})
+
+	cases := []struct {
+		t        NodeType
+		location Coordinate2D
+		fits     bool
+	}{
+		{NodeTown, Coordinate2D{X: 10, Y: 5}, true},
+		{NodeTown, Coordinate2D{X: 10, Y: 6}, false},
+		{NodeTown, Coordinate2D{X: 1, Y: 1}, false},
+		{NodeTown, Coordinate2D{X: 17, Y: 17}, true},
+		{NodeTown, Coordinate2D{X: 18, Y: 17}, false},
+		{NodeOutpost, Coordinate2D{X: 0, Y: 0}, true},
+		{NodeOutpost, Coordinate2D{X: 10, Y: 5}, false},
+		{NodeOutpost, Coordinate2D{X: 20, Y: 0}, false},
+	}
+
+	for _, c := range cases {
+		if area.Fits(&config, c.t, c.location) != c.fits {
+			t.Errorf("%v at %v: expected fits %v", c.t, c.location, c.fits)
+		}
+	}
+}
+
+func TestArea_JSON(t *testing.T) {
+
+	area := GenerateRegion(3, Coordinate2D{}, &DefaultConfig).Area()
+	data, err := json.Marshal(area)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Area
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Nodes) != len(area.Nodes) || decoded.Nodes[0].Type != NodeFortress || decoded.Nodes[1].Type != NodeTown {
+		t.Fatalf("area changed through JSON: %s", data)
+	}
+}
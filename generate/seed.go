@@ -0,0 +1,35 @@
+package generate
+
+import "math/rand"
+
+// Stage is a step of region generation. Every stage draws from its own
+// random stream, so changing how much one stage draws doesn't move the
+// output of the others.
+type Stage int
+
+const (
+	StageFortress Stage = iota + 1
+	StageTowns
+	StageOutposts
+)
+
+// StageRand returns the random stream of a generation stage of the region
+// at a spiral index. n tells apart repeats of a stage within a region, like
+// the outposts of each town. The stream depends only on its arguments, so
+// every master and every run derives the same one.
+func StageRand(seed int64, index int, stage Stage, n int) *rand.Rand {
+
+	h := mix(uint64(seed))
+	h = mix(h ^ uint64(index))
+	h = mix(h ^ uint64(stage)<<32 ^ uint64(n))
+	return rand.New(rand.NewSource(int64(h)))
+}
+
+// mix is the splitmix64 finalizer.
+func mix(h uint64) uint64 {
+
+	h += 0x9E3779B97F4A7C15
+	h = (h ^ h>>30) * 0xBF58476D1CE4E5B9
+	h = (h ^ h>>27) * 0x94D049BB133111EB
+	return h ^ h>>31
+}
@@ -0,0 +1,92 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// go test ./generate -update rewrites the golden files. Only do that for a
+// change that is meant to alter every world.
+var update = flag.Bool("update", false, "rewrite golden files")
+
+var goldenRegions = []struct {
+	seed  int64
+	coord Coordinate2D
+}{
+	{1, Coordinate2D{X: 0, Y: 0}},
+	{1, Coordinate2D{X: 1, Y: -1}},
+	{42, Coordinate2D{X: 0, Y: 0}},
+	{42, Coordinate2D{X: -3, Y: 7}},
+	{-7, Coordinate2D{X: 250, Y: -999}},
+}
+
+func TestGenerateRegion_Golden(t *testing.T) {
+
+	for _, g := range goldenRegions {
+
+		data, err := json.MarshalIndent(GenerateRegion(g.seed, g.coord, &DefaultConfig), "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, '\n')
+
+		path := filepath.Join("testdata", fmt.Sprintf("region_%d_%d_%d.json", g.seed, g.coord.X, g.coord.Y))
+		if *update {
+			err = ioutil.WriteFile(path, data, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		golden, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, golden) {
+			t.Errorf("region of seed %d at %v differs from %s:\n%s", g.seed, g.coord, path, data)
+		}
+	}
+}
+
+func TestStageRand_Independent(t *testing.T) {
+
+	a := StageRand(1, 5, StageTowns, 0).Int63()
+	if a != StageRand(1, 5, StageTowns, 0).Int63() {
+		t.Fatal("same stage gave different streams")
+	}
+
+	others := []int64{
+		StageRand(2, 5, StageTowns, 0).Int63(),
+		StageRand(1, 6, StageTowns, 0).Int63(),
+		StageRand(1, 5, StageOutposts, 0).Int63(),
+		StageRand(1, 5, StageTowns, 1).Int63(),
+	}
+	for i, b := range others {
+		if a == b {
+			t.Errorf("stream %d matches", i)
+		}
+	}
+}
+
+func TestGenerateRegion_StagesDontShift(t *testing.T) {
+
+	fewer := DefaultConfig
+	fewer.MinOutposts = 0
+	fewer.MaxOutposts = 0
+	fewer.OutpostFortressDistance = 0
+
+	coord := Coordinate2D{X: 2, Y: 3}
+	a := GenerateRegion(9, coord, &DefaultConfig)
+	b := GenerateRegion(9, coord, &fewer)
+
+	if a.Fortress.Location != b.Fortress.Location || len(b.Fortress.Towns) == 0 || a.Fortress.Towns[0].Location != b.Fortress.Towns[0].Location {
+		t.Fatal("drawing fewer outposts moved the fortress or first town")
+	}
+}
@@ -2,3 +2,9 @@ package globals
 
 const MAX_CHARACTERS = 10
 const SESSION_EXPIRE_SECONDS = 120
+const GAME_STATUS_EXPIRE_SECONDS = 30
+const MAX_PARTY_SIZE = 8
+const GAME_RESERVATION_SECONDS = 60
+const RECONCILE_INTERVAL_SECONDS = 60
+const RECONCILE_GRACE_SECONDS = 60
+const UNHEALTHY_GAME_SECONDS = 120
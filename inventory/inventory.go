@@ -0,0 +1,297 @@
+// Package inventory holds the item catalog and the operations the master
+// applies to character inventories. An inventory is a list of stacks, the
+// index of a stack is its slot.
+package inventory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+var ErrUnknownItem = errors.New("inventory: unknown item")
+var ErrClassRestricted = errors.New("inventory: item is restricted to other classes")
+var ErrNotEnough = errors.New("inventory: not enough items")
+var ErrFull = errors.New("inventory: inventory is full")
+var ErrBadSlot = errors.New("inventory: bad slot")
+var ErrBadCount = errors.New("inventory: bad count")
+
+// ItemDef is a catalog entry. Classes lists the classes that can hold the
+// item, all classes if empty.
+type ItemDef struct {
+	ItemId   int    `json:"itemId"`
+	Name     string `json:"name"`
+	MaxStack int    `json:"maxStack"`
+	Tradable bool   `json:"tradable"`
+	Classes  []int  `json:"classes,omitempty"`
+}
+
+type Catalog struct {
+	MaxSlots int       `json:"maxSlots"`
+	Items    []ItemDef `json:"items"`
+
+	items map[int]*ItemDef
+}
+
+func LoadFile(path string) (*Catalog, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Load(file)
+}
+
+// Load reads a catalog from JSON and checks it.
+func Load(r io.Reader) (*Catalog, error) {
+
+	var c Catalog
+	err := json.NewDecoder(r).Decode(&c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.MaxSlots <= 0 {
+		return nil, errors.New("inventory: maxSlots must be positive")
+	}
+
+	c.items = make(map[int]*ItemDef)
+	for i := range c.Items {
+
+		item := &c.Items[i]
+		if item.ItemId <= 0 || item.MaxStack <= 0 {
+			return nil, fmt.Errorf("inventory: item %d needs a positive id and maxStack", item.ItemId)
+		}
+
+		if _, exists := c.items[item.ItemId]; exists {
+			return nil, fmt.Errorf("inventory: item %d defined twice", item.ItemId)
+		}
+
+		c.items[item.ItemId] = item
+	}
+
+	return &c, nil
+}
+
+func (c *Catalog) Item(itemId int) (*ItemDef, bool) {
+
+	item, ok := c.items[itemId]
+	return item, ok
+}
+
+// Allowed reports whether a character of classId can hold the item.
+func (item *ItemDef) Allowed(classId int) bool {
+
+	if len(item.Classes) == 0 {
+		return true
+	}
+
+	for _, id := range item.Classes {
+		if id == classId {
+			return true
+		}
+	}
+	return false
+}
+
+// Grant adds count items, filling existing stacks before using new slots.
+// The inventory passed in is never modified.
+func (c *Catalog) Grant(inv []model.Item, classId int, itemId int, count int) ([]model.Item, error) {
+
+	if count <= 0 {
+		return nil, ErrBadCount
+	}
+
+	item, ok := c.Item(itemId)
+	if !ok {
+		return nil, ErrUnknownItem
+	}
+
+	if !item.Allowed(classId) {
+		return nil, ErrClassRestricted
+	}
+
+	result := Copy(inv)
+	for i := range result {
+		if count == 0 {
+			break
+		}
+		if result[i].ItemId == itemId && result[i].Stacks < item.MaxStack {
+			added := min(count, item.MaxStack-result[i].Stacks)
+			result[i].Stacks += added
+			count -= added
+		}
+	}
+
+	for count > 0 {
+		if len(result) >= c.MaxSlots {
+			return nil, ErrFull
+		}
+		added := min(count, item.MaxStack)
+		result = append(result, model.Item{ItemId: itemId, Stacks: added})
+		count -= added
+	}
+
+	return result, nil
+}
+
+// Return adds items back that the inventory held before, for example from
+// a cancelled trade. It doesn't check class restrictions or the slot limit
+// so returned items are never lost.
+func (c *Catalog) Return(inv []model.Item, itemId int, count int) []model.Item {
+
+	maxStack := count
+	if item, ok := c.Item(itemId); ok {
+		maxStack = item.MaxStack
+	}
+
+	result := Copy(inv)
+	for i := range result {
+		if count == 0 {
+			break
+		}
+		if result[i].ItemId == itemId && result[i].Stacks < maxStack {
+			added := min(count, maxStack-result[i].Stacks)
+			result[i].Stacks += added
+			count -= added
+		}
+	}
+
+	for count > 0 {
+		added := min(count, maxStack)
+		result = append(result, model.Item{ItemId: itemId, Stacks: added})
+		count -= added
+	}
+
+	return result
+}
+
+// Consume removes count items, emptying the last stacks first.
+func (c *Catalog) Consume(inv []model.Item, itemId int, count int) ([]model.Item, error) {
+
+	if count <= 0 {
+		return nil, ErrBadCount
+	}
+
+	if Count(inv, itemId) < count {
+		return nil, ErrNotEnough
+	}
+
+	result := Copy(inv)
+	for i := len(result) - 1; i >= 0 && count > 0; i-- {
+		if result[i].ItemId == itemId {
+			removed := min(count, result[i].Stacks)
+			result[i].Stacks -= removed
+			count -= removed
+		}
+	}
+
+	return compact(result), nil
+}
+
+// Drop removes count items from one slot.
+func (c *Catalog) Drop(inv []model.Item, slot int, count int) ([]model.Item, error) {
+
+	if slot < 0 || slot >= len(inv) {
+		return nil, ErrBadSlot
+	}
+
+	if count <= 0 {
+		return nil, ErrBadCount
+	}
+
+	if inv[slot].Stacks < count {
+		return nil, ErrNotEnough
+	}
+
+	result := Copy(inv)
+	result[slot].Stacks -= count
+	return compact(result), nil
+}
+
+// Move moves the stack in slot onto toSlot. Stacks of the same item are
+// merged up to the max stack, other stacks swap slots.
+func (c *Catalog) Move(inv []model.Item, slot int, toSlot int) ([]model.Item, error) {
+
+	if slot < 0 || slot >= len(inv) || toSlot < 0 || toSlot >= len(inv) || slot == toSlot {
+		return nil, ErrBadSlot
+	}
+
+	result := Copy(inv)
+	from, to := &result[slot], &result[toSlot]
+
+	if from.ItemId != to.ItemId {
+		*from, *to = *to, *from
+		return result, nil
+	}
+
+	item, ok := c.Item(from.ItemId)
+	if !ok {
+		return nil, ErrUnknownItem
+	}
+
+	moved := min(from.Stacks, item.MaxStack-to.Stacks)
+	to.Stacks += moved
+	from.Stacks -= moved
+	return compact(result), nil
+}
+
+// Count returns the number of an item across all stacks.
+func Count(inv []model.Item, itemId int) int {
+
+	total := 0
+	for _, stack := range inv {
+		if stack.ItemId == itemId {
+			total += stack.Stacks
+		}
+	}
+	return total
+}
+
+// Equal compares two inventories slot by slot.
+func Equal(a []model.Item, b []model.Item) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func Copy(inv []model.Item) []model.Item {
+
+	result := make([]model.Item, len(inv))
+	copy(result, inv)
+	return result
+}
+
+// compact drops empty stacks
+func compact(inv []model.Item) []model.Item {
+
+	result := inv[:0]
+	for _, stack := range inv {
+		if stack.Stacks > 0 {
+			result = append(result, stack)
+		}
+	}
+	return result
+}
+
+func min(a int, b int) int {
+
+	if a < b {
+		return a
+	}
+	return b
+}
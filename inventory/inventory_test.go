@@ -0,0 +1,116 @@
+package inventory
+
+import (
+	"testing"
+
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+func loadShipped(t *testing.T) *Catalog {
+
+	catalog, err := LoadFile("../data/items.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return catalog
+}
+
+func TestGrant_FillsStacks(t *testing.T) {
+
+	catalog := loadShipped(t)
+
+	inv := []model.Item{{ItemId: 1, Stacks: 15}, {ItemId: 5, Stacks: 1}}
+
+	result, err := catalog.Grant(inv, 1, 1, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []model.Item{{ItemId: 1, Stacks: 20}, {ItemId: 5, Stacks: 1}, {ItemId: 1, Stacks: 20}, {ItemId: 1, Stacks: 5}}
+	if !Equal(result, want) {
+		t.Fatalf("got %v, want %v", result, want)
+	}
+
+	if inv[0].Stacks != 15 {
+		t.Fatal("grant modified its input")
+	}
+}
+
+func TestGrant_Rejects(t *testing.T) {
+
+	catalog := loadShipped(t)
+
+	if _, err := catalog.Grant(nil, 1, 99, 1); err != ErrUnknownItem {
+		t.Errorf("unknown item: %v", err)
+	}
+
+	if _, err := catalog.Grant(nil, 1, 3, 1); err != ErrClassRestricted {
+		t.Errorf("class restriction: %v", err)
+	}
+
+	if _, err := catalog.Grant(nil, 1, 1, 0); err != ErrBadCount {
+		t.Errorf("zero count: %v", err)
+	}
+
+	if _, err := catalog.Grant(nil, 1, 7, 41); err != ErrFull {
+		t.Errorf("full inventory: %v", err)
+	}
+}
+
+func TestConsumeAndDrop(t *testing.T) {
+
+	catalog := loadShipped(t)
+
+	inv := []model.Item{{ItemId: 1, Stacks: 3}, {ItemId: 2, Stacks: 4}, {ItemId: 1, Stacks: 2}}
+
+	result, err := catalog.Consume(inv, 1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Equal(result, []model.Item{{ItemId: 1, Stacks: 1}, {ItemId: 2, Stacks: 4}}) {
+		t.Fatalf("consume: %v", result)
+	}
+
+	if _, err = catalog.Consume(inv, 1, 6); err != ErrNotEnough {
+		t.Fatalf("over-consume: %v", err)
+	}
+
+	result, err = catalog.Drop(inv, 1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Equal(result, []model.Item{{ItemId: 1, Stacks: 3}, {ItemId: 1, Stacks: 2}}) {
+		t.Fatalf("drop: %v", result)
+	}
+
+	if _, err = catalog.Drop(inv, 3, 1); err != ErrBadSlot {
+		t.Fatalf("drop from missing slot: %v", err)
+	}
+}
+
+func TestMove(t *testing.T) {
+
+	catalog := loadShipped(t)
+
+	inv := []model.Item{{ItemId: 1, Stacks: 15}, {ItemId: 2, Stacks: 4}, {ItemId: 1, Stacks: 8}}
+
+	result, err := catalog.Move(inv, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Equal(result, []model.Item{{ItemId: 2, Stacks: 4}, {ItemId: 1, Stacks: 15}, {ItemId: 1, Stacks: 8}}) {
+		t.Fatalf("swap: %v", result)
+	}
+
+	result, err = catalog.Move(inv, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !Equal(result, []model.Item{{ItemId: 1, Stacks: 20}, {ItemId: 2, Stacks: 4}, {ItemId: 1, Stacks: 3}}) {
+		t.Fatalf("merge: %v", result)
+	}
+}
@@ -1,80 +1,252 @@
 package launch
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"path/filepath"
 	"strconv"
+	"sync"
+	"time"
+	"github.com/jaybennett89/thorium-go/client"
 	"github.com/jaybennett89/thorium-go/cmd/host-server/hostconf"
 	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/requests"
 )
 import "os"
 import "os/exec"
 
+var ErrNoProfile = errors.New("launch: no launch profile for the game's map and mode")
+var ErrWrongBinary = errors.New("launch: the game's profile runs another gameserver binary")
+var ErrNoGameServer = errors.New("launch: no running gameserver for the game")
+
 type GameServerProcess struct {
 	ApplicationName string
 	Game            *model.Game
 	Process         *os.Process
 	ListenPort      int
+	Directory       string
+	StartedOn       time.Time
+	Registered      bool
+	Exited          bool
+
+	tokens *gameTokens
+	cgroup string
 }
 
 var list []GameServerProcess = make([]GameServerProcess, 0)
+var listMutex sync.Mutex
 var baseListenPort int = 12690
 
-func NewGameServer(machineKey string, servicePort int, gameId int, mapName string, mode string, minLevel int, maxPlayers int) error {
+// the listen port of the next gameserver, reserved under listMutex so
+// concurrent launches never share one
+var nextListenPort int = baseListenPort
+
+// games without a working directory in their profile run in here
+const defaultGamesDirectory = "games"
+
+// NewGameServer starts a gameserver with the launch profile of the game's
+// map and mode. If the master names a binary, the profile must run it.
+// The gameserver reaches the host-server's local API on servicePort with
+// the game token it finds in its environment.
+func NewGameServer(servicePort int, data *request.NewGameServer) error {
+
+	log.Printf("Starting new game server (gameId %d, map %s, mode %s, minLevel %d, maxPlayers %d", data.GameId, data.Map, data.Mode, data.MinimumLevel, data.MaximumPlayers)
+
+	profile, ok := hostconf.Profile(data.Map, data.Mode)
+	if !ok {
+		return ErrNoProfile
+	}
+
+	binaryName := filepath.Base(profile.Binary)
+	if data.Binary != "" && data.Binary != binaryName {
+		return ErrWrongBinary
+	}
+
+	// the binary is relative to the host-server, not the working directory
+	binary, err := filepath.Abs(profile.Binary)
+	if err != nil {
+		return err
+	}
+
+	dir, err := gameDirectory(profile, data.GameId)
+	if err != nil {
+		return err
+	}
 
-	log.Printf("Starting new game server (gameId %d, map %s, mode %s, minLevel %d, maxPlayers %d", gameId, mapName, mode, minLevel, maxPlayers)
+	listMutex.Lock()
+	listenPort := nextListenPort
+	nextListenPort++
+	listMutex.Unlock()
 
-	listenPort := baseListenPort + len(list)
+	tokens, err := newGameTokens()
+	if err != nil {
+		return err
+	}
 
-	cmd := exec.Command(
-		hostconf.GameserverBinaryPath(),
-		"-key", machineKey,
-		"-id", strconv.Itoa(gameId),
+	args := []string{
+		"-id", strconv.Itoa(data.GameId),
 		"-listen", strconv.Itoa(listenPort),
 		"-service", strconv.Itoa(servicePort),
-		"-map", mapName,
-		"-mode", mode,
-		"-minlvl", strconv.Itoa(minLevel),
-		"-maxplayers", strconv.Itoa(maxPlayers),
-	)
+		"-map", data.Map,
+		"-mode", data.Mode,
+		"-minlvl", strconv.Itoa(data.MinimumLevel),
+		"-maxplayers", strconv.Itoa(data.MaximumPlayers),
+	}
+
+	if data.WorldRegion != nil {
+		args = append(args, "-region", fmt.Sprintf("%d,%d", data.WorldRegion.X, data.WorldRegion.Y))
+	}
+
+	cmd := exec.Command(binary, append(args, profile.Args...)...)
+	cmd.Env = append(os.Environ(), profile.Env...)
+	cmd.Env = append(cmd.Env, client.GameTokenEnv+"="+tokens.current)
+	cmd.Dir = dir
 
 	// setup log file
-	log, err := os.Create("example-gameserver.log")
+	logFile, err := os.Create(filepath.Join(dir, "gameserver.log"))
 	if err != nil {
 		return err
 	}
 
-	cmd.Stdout = log
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
+	err = setUser(cmd, dir, profile)
+	if err != nil {
+
+		logFile.Close()
+		return err
+	}
+
+	// a gameserver without its limits doesn't get to run
+	group, err := confine(cmd, data.GameId, profile)
+	if err != nil {
+
+		logFile.Close()
+		return err
+	}
 
 	err = cmd.Start()
+	started(cmd)
 	if err != nil {
 
+		removeCgroup(group)
+		logFile.Close()
 		return err
 	}
 
 	game := model.Game{
 
-		GameId:         gameId,
-		Map:            mapName,
-		Mode:           mode,
-		MinimumLevel:   minLevel,
+		GameId:         data.GameId,
+		Map:            data.Map,
+		Mode:           data.Mode,
+		MinimumLevel:   data.MinimumLevel,
 		PlayerCount:    0,
-		MaximumPlayers: maxPlayers,
+		MaximumPlayers: data.MaximumPlayers,
+		WorldRegion:    data.WorldRegion,
 	}
 
 	gameServer := GameServerProcess{
 
-		ApplicationName: hostconf.GameserverBinaryPath(),
+		ApplicationName: binary,
 		Game:            &game,
 		Process:         cmd.Process,
 		ListenPort:      listenPort,
+		Directory:       dir,
+		StartedOn:       time.Now(),
+		tokens:          tokens,
+		cgroup:          group,
 	}
 
+	listMutex.Lock()
 	list = append(list, gameServer)
+	listMutex.Unlock()
+
+	go wait(cmd, logFile, group, data.GameId)
 
 	return nil
 }
 
+// GetServerList returns every gameserver launched by this host, including
+// the ones that exited.
 func GetServerList() []GameServerProcess {
 
-	return list
+	listMutex.Lock()
+	defer listMutex.Unlock()
+
+	servers := make([]GameServerProcess, len(list))
+	copy(servers, list)
+	return servers
+}
+
+// MarkRegistered records that a game's server registered with the master.
+func MarkRegistered(gameId int) {
+
+	listMutex.Lock()
+	defer listMutex.Unlock()
+
+	for i := range list {
+		if list[i].Game.GameId == gameId {
+			list[i].Registered = true
+		}
+	}
+}
+
+// StopGameServer kills the gameserver of a game, along with any process
+// it started when it runs in a cgroup. It is reaped and marked exited like
+// one that stopped on its own.
+func StopGameServer(gameId int) error {
+
+	listMutex.Lock()
+	defer listMutex.Unlock()
+
+	for i := range list {
+		if list[i].Game.GameId == gameId && !list[i].Exited {
+			return kill(list[i].Process, list[i].cgroup)
+		}
+	}
+
+	return ErrNoGameServer
+}
+
+// gameDirectory creates the directory a game runs in. It is kept after
+// the game exits so its log can be read.
+func gameDirectory(profile *hostconf.LaunchProfile, gameId int) (string, error) {
+
+	base := profile.WorkingDirectory
+	if base == "" {
+		base = defaultGamesDirectory
+	}
+
+	dir, err := filepath.Abs(filepath.Join(base, fmt.Sprintf("game-%d", gameId)))
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(dir, 0750)
+	if err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// wait reaps a gameserver when it exits and removes the cgroup confine
+// set up for it.
+func wait(cmd *exec.Cmd, logFile *os.File, group string, gameId int) {
+
+	err := cmd.Wait()
+	log.Printf("gameserver of game %d exited: %v", gameId, err)
+
+	logFile.Close()
+	removeCgroup(group)
+
+	listMutex.Lock()
+	for i := range list {
+		if list[i].Process == cmd.Process {
+			list[i].Exited = true
+		}
+	}
+	listMutex.Unlock()
 }
@@ -0,0 +1,213 @@
+//go:build linux
+// +build linux
+
+package launch
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/jaybennett89/thorium-go/cmd/host-server/hostconf"
+)
+
+var ErrNoCgroup = errors.New("launch: CPUPercent and MaxProcesses need a cgroup v2 CgroupParent")
+
+// setUser makes the gameserver run as the profile's user and hands it
+// its directory. Without a Uid it runs as the host-server.
+func setUser(cmd *exec.Cmd, dir string, profile *hostconf.LaunchProfile) error {
+
+	if profile.Uid == 0 {
+		return nil
+	}
+
+	gid := profile.Gid
+	if gid == 0 {
+		gid = profile.Uid
+	}
+
+	err := os.Chown(dir, profile.Uid, gid)
+	if err != nil {
+		return err
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(profile.Uid), Gid: uint32(gid)}}
+	return nil
+}
+
+// confine sets cmd up to start in a cgroup of its own when the host has
+// one, and to set its rlimits before it runs the gameserver, so nothing it
+// does escapes its limits. It returns the cgroup, "" without one, which is
+// for removeCgroup once the game has exited. Call started after cmd.Start.
+func confine(cmd *exec.Cmd, gameId int, profile *hostconf.LaunchProfile) (string, error) {
+
+	if cmd.Err != nil {
+		return "", cmd.Err
+	}
+
+	limits := profile.Limits
+	group, err := newCgroup(gameId, &limits)
+	if err != nil {
+		return "", err
+	}
+
+	if group == "" && (limits.CPUPercent > 0 || limits.MaxProcesses > 0) {
+		return "", ErrNoCgroup
+	}
+
+	if group != "" {
+
+		fd, err := syscall.Open(group, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			removeCgroup(group)
+			return "", err
+		}
+
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = fd
+	}
+
+	// the cgroup caps memory, the address space limit is the fallback
+	memory := limits.MemoryMB << 10
+	if group != "" {
+		memory = 0
+	}
+
+	setRlimits(cmd, memory, limits.CPUSeconds, limits.OpenFiles)
+	return group, nil
+}
+
+// started closes what confine kept open for cmd.Start.
+func started(cmd *exec.Cmd) {
+
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.UseCgroupFD {
+		syscall.Close(cmd.SysProcAttr.CgroupFD)
+	}
+}
+
+// kill stops a gameserver and, when it has a cgroup, everything it forked.
+func kill(process *os.Process, group string) error {
+
+	if group != "" {
+
+		// cgroup.kill needs linux 5.14
+		err := ioutil.WriteFile(filepath.Join(group, "cgroup.kill"), []byte("1"), 0644)
+		if err == nil {
+			return nil
+		}
+		log.Print("launch: couldn't kill cgroup: ", err)
+	}
+
+	return process.Kill()
+}
+
+// newCgroup creates game-<id> under the configured parent and writes its
+// limits. It returns "" when the host has no cgroup v2 parent.
+func newCgroup(gameId int, limits *hostconf.ResourceLimits) (string, error) {
+
+	parent := hostconf.CgroupParent()
+	if parent == "" {
+		return "", nil
+	}
+
+	_, err := os.Stat(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		log.Print("launch: ", parent, " is not a cgroup v2 group, games run without one")
+		return "", nil
+	}
+
+	// fails once the parent holds processes, by then it's usually done
+	err = ioutil.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+memory +cpu +pids"), 0644)
+	if err != nil {
+		log.Print("launch: couldn't enable cgroup controllers: ", err)
+	}
+
+	group := filepath.Join(parent, fmt.Sprintf("game-%d", gameId))
+	err = os.Mkdir(group, 0755)
+	if err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
+	settings := map[string]string{}
+	if limits.MemoryMB > 0 {
+		settings["memory.max"] = strconv.Itoa(limits.MemoryMB << 20)
+	}
+	if limits.CPUPercent > 0 {
+		settings["cpu.max"] = fmt.Sprintf("%d 100000", limits.CPUPercent*1000)
+	}
+	if limits.MaxProcesses > 0 {
+		settings["pids.max"] = strconv.Itoa(limits.MaxProcesses)
+	}
+
+	for _, name := range []string{"memory.max", "cpu.max", "pids.max"} {
+
+		value, ok := settings[name]
+		if !ok {
+			continue
+		}
+
+		err = ioutil.WriteFile(filepath.Join(group, name), []byte(value), 0644)
+		if err != nil {
+			removeCgroup(group)
+			return "", err
+		}
+	}
+
+	return group, nil
+}
+
+// removeCgroup kills anything the gameserver left behind in its group and
+// removes it.
+func removeCgroup(group string) {
+
+	if group == "" {
+		return
+	}
+
+	// cgroup.kill needs linux 5.14, rmdir fails on older kernels if the
+	// gameserver left children running
+	ioutil.WriteFile(filepath.Join(group, "cgroup.kill"), []byte("1"), 0644)
+
+	err := os.Remove(group)
+	if err != nil {
+		log.Print("launch: couldn't remove cgroup: ", err)
+	}
+}
+
+// setRlimits makes cmd start through a shell that lowers its rlimits and
+// then replaces itself with the gameserver, which keeps the pid. Memory is
+// in KB, zero values are left alone.
+func setRlimits(cmd *exec.Cmd, memoryKB int, cpuSeconds int, openFiles int) {
+
+	script := ""
+	for _, l := range []struct {
+		flag  string
+		value int
+	}{
+		{"-v", memoryKB},
+		{"-t", cpuSeconds},
+		{"-n", openFiles},
+	} {
+
+		if l.value > 0 {
+			script += fmt.Sprintf("ulimit %s %d || exit 126; ", l.flag, l.value)
+		}
+	}
+
+	if script == "" {
+		return
+	}
+
+	cmd.Args = append([]string{"/bin/sh", "-c", script + `exec "$0" "$@"`, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+}
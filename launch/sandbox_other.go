@@ -0,0 +1,44 @@
+//go:build !linux
+// +build !linux
+
+package launch
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/jaybennett89/thorium-go/cmd/host-server/hostconf"
+)
+
+var ErrNoSandbox = errors.New("launch: running gameservers as another user is only supported on linux")
+
+// setUser is only supported on Linux, where it runs the gameserver as the
+// profile's user.
+func setUser(cmd *exec.Cmd, dir string, profile *hostconf.LaunchProfile) error {
+
+	if profile.Uid != 0 {
+		return ErrNoSandbox
+	}
+	return nil
+}
+
+// confine is only supported on Linux; elsewhere limits are logged and
+// ignored.
+func confine(cmd *exec.Cmd, gameId int, profile *hostconf.LaunchProfile) (string, error) {
+
+	if profile.Limits != (hostconf.ResourceLimits{}) {
+		log.Print("launch: resource limits are only applied on linux")
+	}
+	return "", nil
+}
+
+func started(cmd *exec.Cmd) {}
+
+func kill(process *os.Process, group string) error {
+
+	return process.Kill()
+}
+
+func removeCgroup(group string) {}
@@ -0,0 +1,105 @@
+package launch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var ErrBadToken = errors.New("launch: unknown or expired game token")
+
+// TokenLifetime is how long a game token is accepted. A gameserver gets a
+// new token once its current one is half way through its lifetime, the
+// old one stays valid until it expires.
+var TokenLifetime = 15 * time.Minute
+
+// gameTokens are the tokens a gameserver authenticates with to the
+// host-server's local API, mapped to when they expire.
+type gameTokens struct {
+	current string
+	issued  time.Time
+	expires map[string]time.Time
+}
+
+func newGameTokens() (*gameTokens, error) {
+
+	tokens := &gameTokens{expires: make(map[string]time.Time)}
+	_, err := tokens.issue()
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (t *gameTokens) issue() (string, error) {
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	t.current = hex.EncodeToString(b)
+	t.issued = now
+	t.expires[t.current] = now.Add(TokenLifetime)
+	return t.current, nil
+}
+
+// check reports whether token is valid. It returns a new token when the
+// current one is due to be replaced.
+func (t *gameTokens) check(token string) (bool, string) {
+
+	now := time.Now()
+	for known, expires := range t.expires {
+		if now.After(expires) {
+			delete(t.expires, known)
+		}
+	}
+
+	if _, ok := t.expires[token]; !ok {
+		return false, ""
+	}
+
+	// the gameserver missed its new token
+	if token != t.current {
+		return true, t.current
+	}
+
+	if now.Sub(t.issued) < TokenLifetime/2 {
+		return true, ""
+	}
+
+	renewed, err := t.issue()
+	if err != nil {
+		// the current token is still good for half its lifetime
+		return true, ""
+	}
+
+	return true, renewed
+}
+
+// Authenticate finds the running game a token belongs to. A new token for
+// the gameserver is returned along with it when the old one is due to be
+// replaced.
+func Authenticate(token string) (int, string, error) {
+
+	listMutex.Lock()
+	defer listMutex.Unlock()
+
+	for i := range list {
+
+		if list[i].Exited {
+			continue
+		}
+
+		ok, renewed := list[i].tokens.check(token)
+		if ok {
+			return list[i].Game.GameId, renewed, nil
+		}
+	}
+
+	return 0, "", ErrBadToken
+}
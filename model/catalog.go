@@ -0,0 +1,74 @@
+package model
+
+import "errors"
+
+var ErrModeNotAllowed = errors.New("model: mode is not allowed on this map")
+var ErrTooManyPlayers = errors.New("model: more players than the map allows")
+var ErrBadMapEntry = errors.New("model: bad map catalog entry")
+
+// MapEntry is a map of the catalog: the modes it can be played in, its
+// player limits and the gameserver binary that runs it. Binary names a
+// launch profile of the hosts, not a path.
+type MapEntry struct {
+	Map            string   `json:"map"`
+	Modes          []string `json:"modes"`
+	DefaultPlayers int      `json:"defaultPlayers"`
+	MaximumPlayers int      `json:"maxPlayers"`
+	MinimumLevel   int      `json:"minimumLevel"`
+	Binary         string   `json:"binary"`
+}
+
+// Validate checks that an entry can be stored.
+func (e *MapEntry) Validate() error {
+
+	if e.Map == "" || e.Binary == "" || len(e.Modes) == 0 {
+		return ErrBadMapEntry
+	}
+
+	if e.MinimumLevel < 0 || e.DefaultPlayers < 1 || e.MaximumPlayers < e.DefaultPlayers {
+		return ErrBadMapEntry
+	}
+
+	for _, mode := range e.Modes {
+		if mode == "" {
+			return ErrBadMapEntry
+		}
+	}
+
+	return nil
+}
+
+// AllowsMode reports whether the map can be played in mode.
+func (e *MapEntry) AllowsMode(mode string) bool {
+
+	for _, m := range e.Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// GameSettings checks a requested game against the entry and fills in
+// its defaults. A maxPlayers of 0 takes the map's default, and the
+// minimum level is never below the map's.
+func (e *MapEntry) GameSettings(mode string, minimumLevel int, maxPlayers int) (int, int, error) {
+
+	if !e.AllowsMode(mode) {
+		return 0, 0, ErrModeNotAllowed
+	}
+
+	if maxPlayers <= 0 {
+		maxPlayers = e.DefaultPlayers
+	}
+
+	if maxPlayers > e.MaximumPlayers {
+		return 0, 0, ErrTooManyPlayers
+	}
+
+	if minimumLevel < e.MinimumLevel {
+		minimumLevel = e.MinimumLevel
+	}
+
+	return minimumLevel, maxPlayers, nil
+}
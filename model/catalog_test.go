@@ -0,0 +1,58 @@
+package model
+
+import "testing"
+
+func TestMapEntry_GameSettings(t *testing.T) {
+
+	entry := MapEntry{
+		Map:            "mp_sandbox",
+		Modes:          []string{"basic", "tutorial"},
+		DefaultPlayers: 16,
+		MaximumPlayers: 32,
+		MinimumLevel:   2,
+		Binary:         "example-gameserver"}
+
+	cases := []struct {
+		mode       string
+		level      int
+		players    int
+		wantLevel  int
+		wantPlayer int
+		err        error
+	}{
+		{"basic", 0, 0, 2, 16, nil},
+		{"tutorial", 5, 32, 5, 32, nil},
+		{"basic", 1, -1, 2, 16, nil},
+		{"freeforall", 0, 0, 0, 0, ErrModeNotAllowed},
+		{"basic", 0, 33, 0, 0, ErrTooManyPlayers},
+	}
+
+	for _, c := range cases {
+		level, players, err := entry.GameSettings(c.mode, c.level, c.players)
+		if err != c.err || level != c.wantLevel || players != c.wantPlayer {
+			t.Errorf("%s %d %d: got %d %d %v", c.mode, c.level, c.players, level, players, err)
+		}
+	}
+}
+
+func TestMapEntry_Validate(t *testing.T) {
+
+	good := MapEntry{Map: "mp_openworld", Modes: []string{"basic"}, DefaultPlayers: 8, MaximumPlayers: 8, Binary: "openworld"}
+	if err := good.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := []MapEntry{
+		{Modes: []string{"basic"}, DefaultPlayers: 8, MaximumPlayers: 8, Binary: "openworld"},
+		{Map: "mp_openworld", DefaultPlayers: 8, MaximumPlayers: 8, Binary: "openworld"},
+		{Map: "mp_openworld", Modes: []string{""}, DefaultPlayers: 8, MaximumPlayers: 8, Binary: "openworld"},
+		{Map: "mp_openworld", Modes: []string{"basic"}, DefaultPlayers: 9, MaximumPlayers: 8, Binary: "openworld"},
+		{Map: "mp_openworld", Modes: []string{"basic"}, DefaultPlayers: 8, MaximumPlayers: 8},
+	}
+
+	for i, entry := range bad {
+		if entry.Validate() != ErrBadMapEntry {
+			t.Errorf("entry %d accepted", i)
+		}
+	}
+}
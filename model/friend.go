@@ -0,0 +1,29 @@
+package model
+
+// friend link states, seen from the account listing its friends
+const (
+	FriendAccepted = "accepted"
+	FriendIncoming = "incoming"
+	FriendOutgoing = "outgoing"
+	FriendBlocked  = "blocked"
+)
+
+// presence of an account
+const (
+	PresenceOffline = "offline"
+	PresenceOnline  = "online"
+	PresenceInGame  = "in_game"
+)
+
+// Friend is an account on another account's friends list. Presence is only
+// filled in for accepted friends, CharacterId and GameId only while the
+// friend has a character selected or is in a game.
+type Friend struct {
+	UserId        int    `json:"uid"`
+	Username      string `json:"username"`
+	Status        string `json:"status"`
+	Presence      string `json:"presence,omitempty"`
+	CharacterId   int    `json:"characterId,omitempty"`
+	CharacterName string `json:"characterName,omitempty"`
+	GameId        int    `json:"gameId,omitempty"`
+}
@@ -0,0 +1,53 @@
+package model
+
+import "time"
+
+// match outcomes of a participant
+const (
+	MatchWin  = "win"
+	MatchLoss = "loss"
+	MatchDraw = "draw"
+)
+
+// Match is a finished match of a game. A game can play several matches.
+// WinningTeam is nil for a draw.
+type Match struct {
+	MatchId      int                `json:"matchId"`
+	GameId       int                `json:"gameId"`
+	Map          string             `json:"map"`
+	Mode         string             `json:"mode"`
+	StartedOn    time.Time          `json:"startedOn"`
+	EndedOn      time.Time          `json:"endedOn"`
+	WinningTeam  *int               `json:"winningTeam"`
+	Participants []MatchParticipant `json:"participants,omitempty"`
+}
+
+type MatchParticipant struct {
+	CharacterId int                `json:"characterId"`
+	Name        string             `json:"name"`
+	Team        int                `json:"team"`
+	Outcome     string             `json:"outcome"`
+	Stats       map[string]float64 `json:"stats"`
+}
+
+// CharacterMatch is a match in a character's history with the character's
+// own result.
+type CharacterMatch struct {
+	Match
+	Team    int                `json:"team"`
+	Outcome string             `json:"outcome"`
+	Stats   map[string]float64 `json:"stats"`
+}
+
+// MatchOutcome is the outcome of a participant on team.
+func MatchOutcome(team int, winningTeam *int) string {
+
+	switch {
+	case winningTeam == nil:
+		return MatchDraw
+	case team == *winningTeam:
+		return MatchWin
+	default:
+		return MatchLoss
+	}
+}
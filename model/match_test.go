@@ -0,0 +1,24 @@
+package model
+
+import "testing"
+
+func TestMatchOutcome(t *testing.T) {
+
+	one := 1
+
+	cases := []struct {
+		team    int
+		winner  *int
+		outcome string
+	}{
+		{1, &one, MatchWin},
+		{2, &one, MatchLoss},
+		{1, nil, MatchDraw},
+	}
+
+	for _, c := range cases {
+		if outcome := MatchOutcome(c.team, c.winner); outcome != c.outcome {
+			t.Errorf("team %d: got %s, want %s", c.team, outcome, c.outcome)
+		}
+	}
+}
@@ -1,5 +1,11 @@
 package model
 
+import (
+	"time"
+
+	"github.com/jaybennett89/thorium-go/generate"
+)
+
 type Account struct {
 	UserId       int    `json:"uid"`
 	Username     string `json:"username"`
@@ -8,10 +14,11 @@ type Account struct {
 }
 
 type Machine struct {
-	MachineId     int    `json:"machineId"`
-	RemoteAddress string `json:"remoteAddress"`
-	ListenPort    int    `json:"listenPort"`
-	MachineKey    string `json:"machineKey"`
+	MachineId     int           `json:"machineId"`
+	RemoteAddress string        `json:"remoteAddress"`
+	ListenPort    int           `json:"listenPort"`
+	MachineKey    string        `json:"machineKey"`
+	Profiles      []HostProfile `json:"profiles,omitempty"`
 }
 
 type HostServer struct {
@@ -20,6 +27,13 @@ type HostServer struct {
 	ListenPort    int    `json:"listenPort"`
 }
 
+// game lifecycle states
+const (
+	GameLoading = "loading"
+	GameRunning = "running"
+	GameEnded   = "ended"
+)
+
 type Game struct {
 	GameId         int    `json:"gameId"`
 	Map            string `json:"map"`
@@ -27,6 +41,52 @@ type Game struct {
 	MinimumLevel   int    `json:"minimumLevel"`
 	PlayerCount    int    `json:"playerCount"`
 	MaximumPlayers int    `json:"maxPlayers"`
+	HostStatus     string `json:"hostStatus"`
+	Region         string `json:"region"`
+
+	// the open world region an mp_openworld game hosts
+	WorldRegion *generate.Coordinate2D `json:"worldRegion,omitempty"`
+
+	// a running game is healthy while its latest status report is fresh
+	Healthy      bool              `json:"healthy"`
+	ServerStatus *GameServerStatus `json:"serverStatus,omitempty"`
+}
+
+// match phases reported by gameservers
+const (
+	MatchWarmup     = "warmup"
+	MatchInProgress = "in_progress"
+	MatchEnded      = "ended"
+)
+
+// GameServerStatus is the latest report a gameserver sent about its match.
+// Scores and Stats are free-form and shown as sent.
+type GameServerStatus struct {
+	TickRate    float64           `json:"tickRate"`
+	PlayerCount int               `json:"playerCount"`
+	Phase       string            `json:"phase"`
+	Scores      map[string]int    `json:"scores,omitempty"`
+	Stats       map[string]string `json:"stats,omitempty"`
+	ReportedOn  time.Time         `json:"reportedOn"`
+}
+
+// GameDetail is a game with its host and the characters playing in it.
+// Timestamps that don't apply to the current state are omitted.
+type GameDetail struct {
+	Game
+	MachineId     int          `json:"machineId,omitempty"`
+	KickoffTime   *time.Time   `json:"kickoffTime,omitempty"`
+	RegisteredOn  *time.Time   `json:"registeredOn,omitempty"`
+	EndedOn       *time.Time   `json:"endedOn,omitempty"`
+	UptimeSeconds int64        `json:"uptimeSeconds"`
+	Players       []GamePlayer `json:"players"`
+}
+
+type GamePlayer struct {
+	CharacterId int       `json:"characterId"`
+	Name        string    `json:"name"`
+	Level       int       `json:"level"`
+	JoinedOn    time.Time `json:"joinedOn"`
 }
 
 type Vector3 struct {
@@ -50,10 +110,62 @@ type Character struct {
 	CharacterId    int    `json:"characterId"`
 	Name           string `json:"name"`
 	LastGameId     int    `json:"lastGameId"`
+	Revision       int    `json:"revision"`
 	CharacterState `json:"characterState"`
+
+	// the version of the inventory ledger the inventory was read at
+	InventoryVersion int `json:"inventoryVersion"`
+}
+
+// trade states
+const (
+	TradePending   = "pending"
+	TradeAccepted  = "accepted"
+	TradeCancelled = "cancelled"
+)
+
+// Trade is an offer of items from one character to another in exchange
+// for requested items. Offered items are held in escrow while pending.
+// Stacks is the number of items of each entry.
+type Trade struct {
+	TradeId         int        `json:"tradeId"`
+	FromCharacterId int        `json:"fromCharacterId"`
+	ToCharacterId   int        `json:"toCharacterId"`
+	Offer           []Item     `json:"offer"`
+	Request         []Item     `json:"request"`
+	Status          string     `json:"status"`
+	CreatedOn       time.Time  `json:"createdOn"`
+	ClosedOn        *time.Time `json:"closedOn,omitempty"`
+}
+
+// InventoryChange is an entry of a character's inventory log.
+type InventoryChange struct {
+	ChangeId    int       `json:"changeId"`
+	CharacterId int       `json:"characterId"`
+	Action      string    `json:"action"`
+	ItemId      int       `json:"itemId"`
+	Count       int       `json:"count"`
+	Slot        int       `json:"slot"`
+	ToSlot      int       `json:"toSlot"`
+	MachineId   int       `json:"machineId"`
+	GameId      int       `json:"gameId"`
+	TradeId     int       `json:"tradeId,omitempty"`
+	Before      []Item    `json:"before"`
+	After       []Item    `json:"after"`
+	RecordedOn  time.Time `json:"recordedOn"`
+}
+
+// CharacterRevision is a stored state of a character, kept in its history.
+type CharacterRevision struct {
+	Revision   int            `json:"revision"`
+	LastGameId int            `json:"lastGameId"`
+	Source     string         `json:"source"`
+	RecordedOn time.Time      `json:"recordedOn"`
+	State      CharacterState `json:"characterState"`
 }
 
 type CharacterState struct {
+	SchemaVersion  int     `json:"schemaVersion"`
 	ClassId        int     `json:"classId"`
 	BaseMeshId     int     `json:"baseMeshId"`
 	Alive          bool    `json:"alive"`
@@ -82,6 +194,8 @@ func NewCharacter() *Character {
 	return &character
 }
 
+// SetClassAttributes sets the same fixed attributes for every class. The
+// master creates characters from the class table in data/classes.json.
 func (c *Character) SetClassAttributes(classId int) {
 
 	c.ClassId = classId
@@ -0,0 +1,16 @@
+package model
+
+// Party is a group of accounts that join games together. Accounts in
+// Invited can accept an invite, GameId is the last game the leader joined.
+type Party struct {
+	PartyId  int           `json:"partyId"`
+	LeaderId int           `json:"leaderId"`
+	Members  []PartyMember `json:"members"`
+	Invited  []int         `json:"invited"`
+	GameId   int           `json:"gameId,omitempty"`
+}
+
+type PartyMember struct {
+	UserId   int    `json:"uid"`
+	Username string `json:"username"`
+}
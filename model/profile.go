@@ -0,0 +1,74 @@
+package model
+
+import "strings"
+
+// AnyProfileMatch stands for any map or any mode in a launch profile.
+const AnyProfileMatch = "*"
+
+// HostProfile is a kind of game a host can launch, as it reports at
+// registration. Map and Mode are AnyProfileMatch to match any. Binary is
+// the name of the gameserver the profile runs, checked against the
+// binary the map catalog asks for.
+type HostProfile struct {
+	Map    string `json:"map"`
+	Mode   string `json:"mode"`
+	Binary string `json:"binary"`
+}
+
+// ParseProfileKey splits a host.config profile key, "map/mode", into its
+// map and mode. A key without a mode matches every mode of the map.
+func ParseProfileKey(key string) (string, string) {
+
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) == 1 || parts[1] == "" {
+		return parts[0], AnyProfileMatch
+	}
+	return parts[0], parts[1]
+}
+
+// ProfileKey is the host.config key of a map and mode.
+func ProfileKey(mapName string, mode string) string {
+	return mapName + "/" + mode
+}
+
+// SelectProfile returns the index of the profile that runs a game of map
+// and mode, or -1 if none does. The most specific profile wins: the map
+// and mode, then the map with any mode, then the mode on any map, then
+// the catch-all. Hosts and the master pick with the same rules.
+func SelectProfile(profiles []HostProfile, mapName string, mode string) int {
+
+	best, bestRank := -1, 0
+	for i, p := range profiles {
+
+		rank := 0
+		switch {
+		case p.Map == mapName && p.Mode == mode:
+			rank = 4
+		case p.Map == mapName && p.Mode == AnyProfileMatch:
+			rank = 3
+		case p.Map == AnyProfileMatch && p.Mode == mode:
+			rank = 2
+		case p.Map == AnyProfileMatch && p.Mode == AnyProfileMatch:
+			rank = 1
+		}
+
+		if rank > bestRank {
+			best, bestRank = i, rank
+		}
+	}
+
+	return best
+}
+
+// SupportsGame reports whether a host with the given profiles can run a
+// game of map and mode with the catalog's binary. Hosts that report no
+// profiles predate them and are taken to run everything.
+func SupportsGame(profiles []HostProfile, mapName string, mode string, binary string) bool {
+
+	if profiles == nil {
+		return true
+	}
+
+	i := SelectProfile(profiles, mapName, mode)
+	return i >= 0 && (binary == "" || profiles[i].Binary == binary)
+}
@@ -0,0 +1,71 @@
+package model
+
+import "testing"
+
+func TestSelectProfile(t *testing.T) {
+
+	profiles := []HostProfile{
+		{Map: "*", Mode: "*", Binary: "any"},
+		{Map: "*", Mode: "tutorial", Binary: "tutorial"},
+		{Map: "mp_openworld", Mode: "*", Binary: "openworld"},
+		{Map: "mp_openworld", Mode: "freeforall", Binary: "openworld-ffa"},
+	}
+
+	cases := []struct {
+		mapName string
+		mode    string
+		index   int
+	}{
+		{"mp_openworld", "freeforall", 3},
+		{"mp_openworld", "basic", 2},
+		{"mp_openworld", "tutorial", 2},
+		{"mp_sandbox", "tutorial", 1},
+		{"mp_sandbox", "basic", 0},
+	}
+
+	for _, c := range cases {
+		if i := SelectProfile(profiles, c.mapName, c.mode); i != c.index {
+			t.Errorf("%s/%s: got %d, want %d", c.mapName, c.mode, i, c.index)
+		}
+	}
+
+	if SelectProfile(profiles[2:], "mp_sandbox", "basic") != -1 {
+		t.Error("selected a profile for an unsupported map")
+	}
+}
+
+func TestSupportsGame(t *testing.T) {
+
+	profiles := []HostProfile{{Map: "mp_sandbox", Mode: "*", Binary: "example-gameserver"}}
+
+	if !SupportsGame(profiles, "mp_sandbox", "basic", "example-gameserver") {
+		t.Error("matching profile refused")
+	}
+	if SupportsGame(profiles, "mp_sandbox", "basic", "other-gameserver") {
+		t.Error("profile with another binary accepted")
+	}
+	if SupportsGame(profiles, "mp_openworld", "basic", "example-gameserver") {
+		t.Error("unsupported map accepted")
+	}
+	if !SupportsGame(nil, "mp_openworld", "basic", "example-gameserver") {
+		t.Error("host without profiles refused")
+	}
+}
+
+func TestParseProfileKey(t *testing.T) {
+
+	cases := map[string][2]string{
+		"mp_sandbox/basic": {"mp_sandbox", "basic"},
+		"mp_sandbox":       {"mp_sandbox", "*"},
+		"mp_sandbox/":      {"mp_sandbox", "*"},
+		"*":                {"*", "*"},
+		"*/tutorial":       {"*", "tutorial"},
+	}
+
+	for key, want := range cases {
+		m, mode := ParseProfileKey(key)
+		if m != want[0] || mode != want[1] {
+			t.Errorf("%s: got %s %s", key, m, mode)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// CharacterSchemaVersion is the CharacterState layout written by this
+// build. Bump it when the stored shape changes and register an upgrade
+// from the previous version with RegisterCharacterUpgrade.
+const CharacterSchemaVersion = 1
+
+var ErrSchemaTooNew = errors.New("model: character data is newer than this build")
+
+// CharacterUpgrade rewrites decoded game data from one schema version to
+// the next. It works on the generic JSON form because old layouts can't
+// be decoded into the current CharacterState.
+type CharacterUpgrade func(data map[string]interface{}) error
+
+var characterUpgrades = make(map[int]CharacterUpgrade)
+
+func init() {
+	RegisterCharacterUpgrade(0, upgradeCharacterV0)
+}
+
+// RegisterCharacterUpgrade adds the upgrade from version from to from+1.
+func RegisterCharacterUpgrade(from int, upgrade CharacterUpgrade) {
+
+	if _, exists := characterUpgrades[from]; exists {
+		panic(fmt.Sprintf("model: character upgrade from version %d registered twice", from))
+	}
+
+	characterUpgrades[from] = upgrade
+}
+
+// EncodeCharacterState marshals state stamped with the current version.
+func EncodeCharacterState(state *CharacterState) ([]byte, error) {
+
+	state.SchemaVersion = CharacterSchemaVersion
+	return json.Marshal(state)
+}
+
+// DecodeCharacterState unmarshals stored game data, upgrading it to the
+// current version first if needed.
+func DecodeCharacterState(data []byte) (*CharacterState, error) {
+
+	upgraded, _, err := UpgradeCharacterState(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var state CharacterState
+	err = json.Unmarshal(upgraded, &state)
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// UpgradeCharacterState returns stored game data in the current version
+// and whether any upgrade was applied.
+func UpgradeCharacterState(data []byte) ([]byte, bool, error) {
+
+	var raw map[string]interface{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	version := 0
+	if v, ok := raw["schemaVersion"].(float64); ok {
+		version = int(v)
+	}
+
+	switch {
+	case version == CharacterSchemaVersion:
+		return data, false, nil
+	case version > CharacterSchemaVersion:
+		return nil, false, ErrSchemaTooNew
+	}
+
+	for version < CharacterSchemaVersion {
+
+		upgrade, ok := characterUpgrades[version]
+		if !ok {
+			return nil, false, fmt.Errorf("model: no character upgrade from version %d", version)
+		}
+
+		err = upgrade(raw)
+		if err != nil {
+			return nil, false, fmt.Errorf("model: character upgrade from version %d: %v", version, err)
+		}
+
+		version++
+		raw["schemaVersion"] = version
+	}
+
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return upgraded, true, nil
+}
+
+// upgradeCharacterV0 handles rows written before game data was versioned.
+// Most have the CharacterState layout already, but early rows used the
+// legacy thordb.CharacterData layout under the same column.
+func upgradeCharacterV0(data map[string]interface{}) error {
+
+	_, legacyPosition := data["worldPosition"]
+	_, legacyExperience := data["experienceLevel"]
+
+	if legacyPosition || legacyExperience {
+		upgradeLegacyCharacterData(data)
+	}
+
+	// nil slices were stored as null
+	if data["inventory"] == nil {
+		data["inventory"] = []interface{}{}
+	}
+
+	if data["weapons"] == nil {
+		data["weapons"] = []interface{}{}
+	}
+
+	return nil
+}
+
+func upgradeLegacyCharacterData(data map[string]interface{}) {
+
+	health := number(data["health"])
+	power := number(data["powerLevel"])
+
+	// legacy slots held 0 when empty, inventory slots held one item each
+	weapons := make([]interface{}, 0)
+	for _, id := range list(data["weapons"]) {
+		if number(id) != 0 {
+			weapons = append(weapons, number(id))
+		}
+	}
+
+	inventory := make([]interface{}, 0)
+	stacks := make(map[float64]map[string]interface{})
+	for _, id := range list(data["inventory"]) {
+		itemId := number(id)
+		if itemId == 0 {
+			continue
+		}
+		if item, ok := stacks[itemId]; ok {
+			item["stacks"] = item["stacks"].(float64) + 1
+			continue
+		}
+		item := map[string]interface{}{"itemId": itemId, "stacks": float64(1)}
+		stacks[itemId] = item
+		inventory = append(inventory, item)
+	}
+
+	selectedWeapon := -1
+	if len(weapons) > 0 {
+		selectedWeapon = 0
+	}
+
+	converted := map[string]interface{}{
+		"classId":        0,
+		"baseMeshId":     1,
+		"alive":          health > 0,
+		"position":       data["worldPosition"],
+		"facingDir":      0,
+		"baseMovespeed":  8,
+		"level":          1,
+		"xp":             number(data["experienceLevel"]),
+		"team":           0,
+		"health":         map[string]interface{}{"current": health, "max": maxOf(health, 100), "regenRate": 10},
+		"energy":         map[string]interface{}{"current": 100, "max": 100, "regenRate": 20},
+		"power":          map[string]interface{}{"current": power, "max": maxOf(power, 100), "regenRate": 30},
+		"armor":          0,
+		"inventory":      inventory,
+		"weapons":        weapons,
+		"selectedWeapon": selectedWeapon,
+		"stunned":        false,
+	}
+
+	for key := range data {
+		delete(data, key)
+	}
+
+	for key, value := range converted {
+		data[key] = value
+	}
+}
+
+func number(value interface{}) float64 {
+
+	f, _ := value.(float64)
+	return f
+}
+
+func list(value interface{}) []interface{} {
+
+	l, _ := value.([]interface{})
+	return l
+}
+
+func maxOf(a float64, b float64) float64 {
+
+	if a > b {
+		return a
+	}
+	return b
+}
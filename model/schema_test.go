@@ -0,0 +1,68 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeCharacterState_Unversioned(t *testing.T) {
+
+	character := NewCharacter()
+	character.SetClassAttributes(2)
+	character.Position.X = 12
+
+	// rows written before versioning have no schemaVersion
+	data, _ := json.Marshal(&character.CharacterState)
+
+	state, err := DecodeCharacterState(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.SchemaVersion != CharacterSchemaVersion || state.ClassId != 2 || state.Position.X != 12 || len(state.Weapons) != 1 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+}
+
+func TestDecodeCharacterState_Legacy(t *testing.T) {
+
+	data := []byte(`{"name":"legacy33","soul":3,"worldCoord":{"X":1,"Y":2},"worldPosition":{"x":4,"y":5,"z":6},
+		"weapons":[3,0],"inventory":[9,9,0,4],"health":80,"powerLevel":120,"experienceLevel":450}`)
+
+	state, err := DecodeCharacterState(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Position != (Vector3{4, 5, 6}) || state.XP != 450 || !state.Alive {
+		t.Fatalf("unexpected state %+v", state)
+	}
+
+	if state.Health.Current != 80 || state.Health.Max != 100 || state.Power.Current != 120 || state.Power.Max != 120 {
+		t.Fatalf("unexpected vitals %+v %+v", state.Health, state.Power)
+	}
+
+	if len(state.Weapons) != 1 || state.Weapons[0] != 3 || state.SelectedWeapon != 0 {
+		t.Fatalf("unexpected weapons %v", state.Weapons)
+	}
+
+	if len(state.Inventory) != 2 || state.Inventory[0] != (Item{9, 2}) || state.Inventory[1] != (Item{4, 1}) {
+		t.Fatalf("unexpected inventory %v", state.Inventory)
+	}
+}
+
+func TestUpgradeCharacterState_Current(t *testing.T) {
+
+	state := NewCharacter().CharacterState
+	data, _ := EncodeCharacterState(&state)
+
+	_, changed, err := UpgradeCharacterState(data)
+	if err != nil || changed {
+		t.Fatalf("current data changed %v, err %v", changed, err)
+	}
+
+	_, _, err = UpgradeCharacterState([]byte(`{"schemaVersion":99}`))
+	if err != ErrSchemaTooNew {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+// Package progression holds the class and level table and the rules the
+// master applies to character snapshots: XP only grows within a cap per
+// game a character plays in, levels follow from XP, and vitals, movespeed and weapons follow from
+// class and level. Gameservers can't set any of these directly.
+package progression
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+var ErrUnknownClass = errors.New("progression: unknown class")
+
+// Stats are the attributes of a class from a level on. Weapons lists the
+// weapons unlocked at that level.
+type Stats struct {
+	Health      float64 `json:"health"`
+	HealthRegen float64 `json:"healthRegen"`
+	Energy      float64 `json:"energy"`
+	EnergyRegen float64 `json:"energyRegen"`
+	Power       float64 `json:"power"`
+	PowerRegen  float64 `json:"powerRegen"`
+	Armor       int     `json:"armor"`
+	Movespeed   float64 `json:"movespeed"`
+	Weapons     []int   `json:"weapons"`
+}
+
+// ClassLevel sets the stats of a class from Level until the next entry.
+type ClassLevel struct {
+	Level int `json:"level"`
+	Stats
+}
+
+type Class struct {
+	ClassId    int          `json:"classId"`
+	Name       string       `json:"name"`
+	BaseMeshId int          `json:"baseMeshId"`
+	Levels     []ClassLevel `json:"levels"`
+}
+
+// Table is the class and level table. LevelXP[n] is the total XP needed
+// for level n+1, so LevelXP[0] is 0 and len(LevelXP) is the level cap.
+// Characters of a class that isn't in the table, like the ones from
+// before classes, are moved to DefaultClassId, the lowest class if unset.
+// MaxXPPerMatch caps the XP a character gains in one game, however many
+// matches it runs.
+type Table struct {
+	MaxXPPerMatch  int     `json:"maxXpPerMatch"`
+	LevelXP        []int   `json:"levelXp"`
+	Classes        []Class `json:"classes"`
+	DefaultClassId int     `json:"defaultClassId"`
+
+	classes map[int]*Class
+}
+
+// Result describes what Progress changed in a snapshot.
+type Result struct {
+	Gained    int  // XP gained, after the cap
+	Capped    bool // the snapshot claimed more XP than allowed
+	LevelsUp  int
+	Defaulted bool // the stored class is unknown, the default was used
+}
+
+func LoadFile(path string) (*Table, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Load(file)
+}
+
+// Load reads a table from JSON and checks it.
+func Load(r io.Reader) (*Table, error) {
+
+	var t Table
+	err := json.NewDecoder(r).Decode(&t)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.MaxXPPerMatch < 0 {
+		return nil, errors.New("progression: negative maxXpPerMatch")
+	}
+
+	if len(t.LevelXP) == 0 || t.LevelXP[0] != 0 {
+		return nil, errors.New("progression: levelXp must start at 0")
+	}
+
+	for i := 1; i < len(t.LevelXP); i++ {
+		if t.LevelXP[i] <= t.LevelXP[i-1] {
+			return nil, fmt.Errorf("progression: levelXp of level %d is not above level %d", i+1, i)
+		}
+	}
+
+	lowest := 0
+	t.classes = make(map[int]*Class)
+	for i := range t.Classes {
+
+		class := &t.Classes[i]
+		if _, exists := t.classes[class.ClassId]; exists {
+			return nil, fmt.Errorf("progression: class %d defined twice", class.ClassId)
+		}
+
+		sort.Slice(class.Levels, func(a, b int) bool { return class.Levels[a].Level < class.Levels[b].Level })
+		if len(class.Levels) == 0 || class.Levels[0].Level != 1 {
+			return nil, fmt.Errorf("progression: class %d has no level 1 entry", class.ClassId)
+		}
+
+		t.classes[class.ClassId] = class
+
+		if t.DefaultClassId == 0 && (i == 0 || class.ClassId < lowest) {
+			lowest = class.ClassId
+		}
+	}
+
+	if t.DefaultClassId == 0 {
+		t.DefaultClassId = lowest
+	} else if _, ok := t.classes[t.DefaultClassId]; !ok {
+		return nil, fmt.Errorf("progression: default class %d is not defined", t.DefaultClassId)
+	}
+
+	return &t, nil
+}
+
+func (t *Table) Class(classId int) (*Class, bool) {
+
+	class, ok := t.classes[classId]
+	return class, ok
+}
+
+// MaxLevel is the level cap.
+func (t *Table) MaxLevel() int {
+	return len(t.LevelXP)
+}
+
+// LevelFor returns the level reached with xp.
+func (t *Table) LevelFor(xp int) int {
+
+	// first level that needs more than xp
+	return sort.Search(len(t.LevelXP), func(i int) bool { return t.LevelXP[i] > xp })
+}
+
+// NewCharacter sets up the state of a new level 1 character of a class.
+func (t *Table) NewCharacter(state *model.CharacterState, classId int) error {
+
+	class, ok := t.Class(classId)
+	if !ok {
+		return ErrUnknownClass
+	}
+
+	state.ClassId = classId
+	state.BaseMeshId = class.BaseMeshId
+	state.Alive = true
+	state.Level = 1
+	state.XP = 0
+	state.Stunned = false
+	t.apply(class, state, true)
+
+	if len(state.Weapons) > 0 {
+		state.SelectedWeapon = 0
+	}
+
+	return nil
+}
+
+// Progress checks a snapshot against the stored state it replaces.
+// gainedInGame is the XP the character already gained in its current
+// game. The snapshot's class, XP, level and stats are corrected in place.
+func (t *Table) Progress(stored *model.CharacterState, snapshot *model.CharacterState, gainedInGame int) (Result, error) {
+
+	var result Result
+
+	class, ok := t.Class(stored.ClassId)
+	if !ok {
+
+		class, ok = t.Class(t.DefaultClassId)
+		if !ok {
+			return result, ErrUnknownClass
+		}
+
+		stored.ClassId = class.ClassId
+		stored.BaseMeshId = class.BaseMeshId
+		result.Defaulted = true
+	}
+
+	snapshot.ClassId = stored.ClassId
+	snapshot.BaseMeshId = stored.BaseMeshId
+
+	gain := snapshot.XP - stored.XP
+	if gain < 0 {
+		gain = 0
+	}
+
+	allowed := t.MaxXPPerMatch - gainedInGame
+	if allowed < 0 {
+		allowed = 0
+	}
+
+	if gain > allowed {
+		gain = allowed
+		result.Capped = true
+	}
+
+	// xp past the level cap is kept but grants nothing
+	snapshot.XP = stored.XP + gain
+	result.Gained = gain
+
+	snapshot.Level = t.LevelFor(snapshot.XP)
+	if snapshot.Level < stored.Level {
+		// the table changed since the character leveled, levels are never lost
+		snapshot.Level = stored.Level
+	}
+
+	result.LevelsUp = snapshot.Level - stored.Level
+	t.apply(class, snapshot, result.LevelsUp > 0)
+
+	return result, nil
+}
+
+// apply sets the stats of the character's level. Vitals are refilled on a
+// level up, otherwise the current values are only clamped to the new max.
+func (t *Table) apply(class *Class, state *model.CharacterState, refill bool) {
+
+	var stats Stats
+	unlocked := make([]int, 0)
+	for _, entry := range class.Levels {
+		if entry.Level > state.Level {
+			break
+		}
+		stats = entry.Stats
+		unlocked = append(unlocked, entry.Weapons...)
+	}
+
+	setVital(&state.Health, stats.Health, stats.HealthRegen, refill)
+	setVital(&state.Energy, stats.Energy, stats.EnergyRegen, refill)
+	setVital(&state.Power, stats.Power, stats.PowerRegen, refill)
+	state.Armor = stats.Armor
+	state.BaseMovespeed = stats.Movespeed
+
+	// weapons picked up in game are kept
+	for _, weapon := range unlocked {
+		if !hasWeapon(state.Weapons, weapon) {
+			state.Weapons = append(state.Weapons, weapon)
+		}
+	}
+}
+
+func setVital(vital *model.Vital, max float64, regen float64, refill bool) {
+
+	vital.Max = max
+	vital.RegenRate = regen
+
+	switch {
+	case refill || vital.Current > max:
+		vital.Current = max
+	case vital.Current < 0:
+		vital.Current = 0
+	}
+}
+
+func hasWeapon(weapons []int, weapon int) bool {
+
+	for _, w := range weapons {
+		if w == weapon {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package progression
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+func loadShipped(t *testing.T) *Table {
+
+	table, err := LoadFile("../data/classes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func TestLoad_Rejects(t *testing.T) {
+
+	bad := []string{
+		`{"levelXp": [100, 200], "classes": []}`,
+		`{"levelXp": [0, 200, 150], "classes": []}`,
+		`{"levelXp": [0], "classes": [{"classId": 1, "levels": [{"level": 2}]}]}`,
+		`{"levelXp": [0], "classes": [{"classId": 1, "levels": [{"level": 1}]}, {"classId": 1, "levels": [{"level": 1}]}]}`,
+	}
+
+	for _, data := range bad {
+		if _, err := Load(strings.NewReader(data)); err == nil {
+			t.Errorf("accepted %s", data)
+		}
+	}
+}
+
+func TestLevelFor(t *testing.T) {
+
+	table := loadShipped(t)
+
+	cases := map[int]int{0: 1, 999: 1, 1000: 2, 2499: 2, 2500: 3, 1000000: table.MaxLevel()}
+	for xp, level := range cases {
+		if got := table.LevelFor(xp); got != level {
+			t.Errorf("xp %d: got level %d, want %d", xp, got, level)
+		}
+	}
+}
+
+func TestProgress_CapsAndLevels(t *testing.T) {
+
+	table := loadShipped(t)
+
+	var stored model.CharacterState
+	err := table.NewCharacter(&stored, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored.XP = 900
+	stored.Health.Current = 40
+
+	// claims a huge gain, a new class and a level
+	snapshot := stored
+	snapshot.Weapons = append([]int(nil), stored.Weapons...)
+	snapshot.XP = 50000
+	snapshot.ClassId = 3
+	snapshot.Level = 10
+	snapshot.Health.Max = 1000
+
+	result, err := table.Progress(&stored, &snapshot, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Capped || result.Gained != 1500 || snapshot.XP != 2400 {
+		t.Fatalf("unexpected cap %+v, xp %d", result, snapshot.XP)
+	}
+
+	if snapshot.ClassId != 1 || snapshot.Level != 2 || result.LevelsUp != 1 {
+		t.Fatalf("class %d level %d", snapshot.ClassId, snapshot.Level)
+	}
+
+	if snapshot.Health.Max != 100 || snapshot.Health.Current != 100 {
+		t.Fatalf("health not recomputed and refilled: %+v", snapshot.Health)
+	}
+}
+
+func TestProgress_UnlocksWeapons(t *testing.T) {
+
+	table := loadShipped(t)
+
+	var stored model.CharacterState
+	table.NewCharacter(&stored, 2)
+	stored.XP = 4000
+	stored.Level = 3
+
+	snapshot := stored
+	snapshot.Weapons = append([]int{11}, stored.Weapons...)
+	snapshot.XP = 4600
+	snapshot.Health.Current = 10
+
+	_, err := table.Progress(&stored, &snapshot, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snapshot.Level != 4 || !hasWeapon(snapshot.Weapons, 5) || !hasWeapon(snapshot.Weapons, 11) {
+		t.Fatalf("level %d weapons %v", snapshot.Level, snapshot.Weapons)
+	}
+
+	if snapshot.BaseMovespeed != 10.5 || snapshot.Health.Max != 100 {
+		t.Fatalf("level 4 stats not applied: %+v", snapshot)
+	}
+}
+
+func TestProgress_NoXPLoss(t *testing.T) {
+
+	table := loadShipped(t)
+
+	var stored model.CharacterState
+	table.NewCharacter(&stored, 1)
+	stored.XP = 500
+
+	snapshot := stored
+	snapshot.XP = 0
+	snapshot.Health.Current = 30
+
+	result, err := table.Progress(&stored, &snapshot, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if snapshot.XP != 500 || result.Gained != 0 || snapshot.Health.Current != 30 {
+		t.Fatalf("xp %d result %+v health %+v", snapshot.XP, result, snapshot.Health)
+	}
+}
+
+func TestNewCharacter_UnknownClass(t *testing.T) {
+
+	table := loadShipped(t)
+
+	var state model.CharacterState
+	if err := table.NewCharacter(&state, 99); err != ErrUnknownClass {
+		t.Fatalf("expected ErrUnknownClass, got %v", err)
+	}
+}
+
+func TestProgress_UnknownClassDefaults(t *testing.T) {
+
+	table := loadShipped(t)
+
+	// characters converted from before classes have class 0
+	stored := model.CharacterState{Level: 1, XP: 100}
+	snapshot := stored
+	snapshot.XP = 300
+
+	result, err := table.Progress(&stored, &snapshot, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Defaulted || snapshot.ClassId != table.DefaultClassId || snapshot.XP != 300 {
+		t.Fatalf("class %d xp %d result %+v", snapshot.ClassId, snapshot.XP, result)
+	}
+}
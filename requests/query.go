@@ -0,0 +1,161 @@
+package request
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var ErrBadQuery = errors.New("request: bad query parameters")
+
+// sort orders accepted by GET /games, prefix with "-" for descending
+var GameListSorts = []string{"id", "players", "free_slots", "min_level"}
+
+const DefaultGameListLimit = 50
+const MaxGameListLimit = 200
+
+// GET /games sends the cursor of the next page in this header
+const NextCursorHeader = "X-Next-Cursor"
+
+// GameListQuery filters and pages GET /games. It is sent as query
+// parameters rather than a body. Zero values don't filter.
+type GameListQuery struct {
+	Map       string
+	Mode      string
+	Region    string
+	MinLevel  int  // games requiring at least this level
+	MaxLevel  int  // games requiring at most this level
+	FreeSlots bool // games with room for another player
+	Running   bool // games whose server has registered with its host
+	Sort      string
+	Limit     int
+	Cursor    string // NextCursorHeader of the previous page
+}
+
+// Values encodes the query for a request URL.
+func (q *GameListQuery) Values() url.Values {
+
+	values := url.Values{}
+	setString := func(key string, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	setInt := func(key string, value int) {
+		if value != 0 {
+			values.Set(key, strconv.Itoa(value))
+		}
+	}
+
+	setString("map", q.Map)
+	setString("mode", q.Mode)
+	setString("region", q.Region)
+	setInt("min_level", q.MinLevel)
+	setInt("max_level", q.MaxLevel)
+	if q.FreeSlots {
+		values.Set("free_slots", "true")
+	}
+	if q.Running {
+		values.Set("running", "true")
+	}
+	setString("sort", q.Sort)
+	setInt("limit", q.Limit)
+	setString("cursor", q.Cursor)
+
+	return values
+}
+
+// ParseGameListQuery reads the query parameters of GET /games and fills
+// in the default sort and limit.
+func ParseGameListQuery(values url.Values) (*GameListQuery, error) {
+
+	var q GameListQuery
+	var err error
+
+	q.Map = values.Get("map")
+	q.Mode = values.Get("mode")
+	q.Region = values.Get("region")
+	q.Sort = values.Get("sort")
+	q.Cursor = values.Get("cursor")
+
+	q.MinLevel, err = intParam(values, "min_level")
+	if err != nil {
+		return nil, err
+	}
+
+	q.MaxLevel, err = intParam(values, "max_level")
+	if err != nil {
+		return nil, err
+	}
+
+	q.Limit, err = intParam(values, "limit")
+	if err != nil {
+		return nil, err
+	}
+
+	q.FreeSlots, err = boolParam(values, "free_slots")
+	if err != nil {
+		return nil, err
+	}
+
+	q.Running, err = boolParam(values, "running")
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Sort == "" {
+		q.Sort = "id"
+	}
+
+	valid := false
+	for _, sort := range GameListSorts {
+		if strings.TrimPrefix(q.Sort, "-") == sort {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, ErrBadQuery
+	}
+
+	switch {
+	case q.Limit < 0:
+		return nil, ErrBadQuery
+	case q.Limit == 0:
+		q.Limit = DefaultGameListLimit
+	case q.Limit > MaxGameListLimit:
+		q.Limit = MaxGameListLimit
+	}
+
+	return &q, nil
+}
+
+func intParam(values url.Values, key string) (int, error) {
+
+	value := values.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, ErrBadQuery
+	}
+
+	return i, nil
+}
+
+func boolParam(values url.Values, key string) (bool, error) {
+
+	value := values.Get(key)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, ErrBadQuery
+	}
+
+	return b, nil
+}
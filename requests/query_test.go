@@ -0,0 +1,48 @@
+package request
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseGameListQuery_RoundTrip(t *testing.T) {
+
+	in := GameListQuery{Map: "mp_sandbox", MinLevel: 2, FreeSlots: true, Sort: "-players", Limit: 10, Cursor: "abc"}
+
+	out, err := ParseGameListQuery(in.Values())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *out != in {
+		t.Fatalf("got %+v, want %+v", *out, in)
+	}
+}
+
+func TestParseGameListQuery_Defaults(t *testing.T) {
+
+	q, err := ParseGameListQuery(url.Values{"limit": {"1000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.Sort != "id" || q.Limit != MaxGameListLimit {
+		t.Fatalf("unexpected defaults %+v", q)
+	}
+}
+
+func TestParseGameListQuery_Rejects(t *testing.T) {
+
+	bad := []url.Values{
+		{"sort": {"name"}},
+		{"min_level": {"high"}},
+		{"free_slots": {"maybe"}},
+		{"limit": {"-1"}},
+	}
+
+	for _, values := range bad {
+		if _, err := ParseGameListQuery(values); err != ErrBadQuery {
+			t.Errorf("%v: expected ErrBadQuery, got %v", values, err)
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package request
 
-import "github.com/jaybennett89/thorium-go/model"
+import (
+	"time"
+
+	"github.com/jaybennett89/thorium-go/generate"
+	"github.com/jaybennett89/thorium-go/model"
+	"github.com/jaybennett89/thorium-go/world"
+)
 
 type CreateNewGame struct {
 	SessionKey   string `json:"sessionKey"`
@@ -8,14 +14,22 @@ type CreateNewGame struct {
 	GameMode     string `json:"gameMode"`
 	MinimumLevel int    `json:"minimumLevel"`
 	MaxPlayers   int    `json:"maxPlayers"`
+
+	// required for mp_openworld games, the region they host
+	WorldRegion *generate.Coordinate2D `json:"worldRegion,omitempty"`
 }
 
+// NewGameServer asks a host to launch a game. Binary is the gameserver
+// the map catalog asks for.
 type NewGameServer struct {
 	GameId         int    `json:"gameId"`
 	Map            string `json:"map"`
 	Mode           string `json:"mode"`
 	MinimumLevel   int    `json:"minimumLevel"`
 	MaximumPlayers int    `json:"maxPlayers"`
+	Binary         string `json:"binary"`
+
+	WorldRegion *generate.Coordinate2D `json:"worldRegion,omitempty"`
 }
 
 type RegisterGameServer struct {
@@ -24,8 +38,115 @@ type RegisterGameServer struct {
 	Port       int    `json:"gameListenPort"`
 }
 
+type UnregisterGameServer struct {
+	MachineKey string `json:"machineKey"`
+	GameId     int    `json:"gameId"`
+}
+
+type GameServerStatus struct {
+	MachineKey string                 `json:"machineKey"`
+	GameId     int                    `json:"gameId"`
+	Status     model.GameServerStatus `json:"status"`
+}
+
+// MatchResult is sent by a gameserver when a match ends. WinningTeam is
+// nil for a draw. Open world games set the Site the match was fought at.
+type MatchResult struct {
+	MachineKey   string                   `json:"machineKey"`
+	GameId       int                      `json:"gameId"`
+	StartedOn    time.Time                `json:"startedOn"`
+	EndedOn      time.Time                `json:"endedOn"`
+	WinningTeam  *int                     `json:"winningTeam"`
+	Site         *world.Site              `json:"site,omitempty"`
+	Participants []MatchResultParticipant `json:"participants"`
+}
+
+type MatchResultParticipant struct {
+	CharacterId int                `json:"characterId"`
+	Team        int                `json:"team"`
+	Stats       map[string]float64 `json:"stats"`
+}
+
+// InventoryOperation changes a character's inventory. Grant and consume
+// use ItemId and Count, drop uses Slot and Count, move uses Slot and ToSlot.
+type InventoryOperation struct {
+	MachineKey string `json:"machineKey"`
+	ItemId     int    `json:"itemId"`
+	Count      int    `json:"count"`
+	Slot       int    `json:"slot"`
+	ToSlot     int    `json:"toSlot"`
+}
+
+// GetInventory reads the inventory of a character playing on the machine.
+type GetInventory struct {
+	MachineKey string `json:"machineKey"`
+}
+
+// ProposeTrade offers items of the session's character FromCharacterId to
+// ToCharacterId in exchange for the requested items.
+type ProposeTrade struct {
+	SessionKey      string       `json:"sessionKey"`
+	FromCharacterId int          `json:"fromCharacterId"`
+	ToCharacterId   int          `json:"toCharacterId"`
+	Offer           []model.Item `json:"offer"`
+	Request         []model.Item `json:"request"`
+}
+
+// TradeAction accepts or cancels a trade for one of the session's characters.
+type TradeAction struct {
+	SessionKey  string `json:"sessionKey"`
+	CharacterId int    `json:"characterId"`
+}
+
+type CharacterTrades struct {
+	SessionKey string `json:"sessionKey"`
+	Limit      int    `json:"limit"`
+}
+
+type InventoryLog struct {
+	AdminKey string `json:"adminKey"`
+	Limit    int    `json:"limit"`
+}
+
+// SetMapEntry adds or replaces a map of the catalog.
+type SetMapEntry struct {
+	AdminKey string `json:"adminKey"`
+	model.MapEntry
+}
+
+type DeleteMapEntry struct {
+	AdminKey string `json:"adminKey"`
+}
+
+// RegisterMachine announces a host and the games its launch profiles can
+// run.
 type RegisterMachine struct {
-	Port int `json:"serviceListenPort"`
+	Port     int                 `json:"serviceListenPort"`
+	Region   string              `json:"region"`
+	Profiles []model.HostProfile `json:"profiles"`
+}
+
+// AnnounceGames lists the games a host still runs after it registered
+// again. Registered is false while the gameserver is still loading.
+type AnnounceGames struct {
+	MachineKey string          `json:"machineKey"`
+	Games      []AnnouncedGame `json:"games"`
+}
+
+type AnnouncedGame struct {
+	GameId         int    `json:"gameId"`
+	Port           int    `json:"gameListenPort"`
+	Map            string `json:"map"`
+	Mode           string `json:"mode"`
+	MinimumLevel   int    `json:"minimumLevel"`
+	MaximumPlayers int    `json:"maxPlayers"`
+	Registered     bool   `json:"registered"`
+
+	WorldRegion *generate.Coordinate2D `json:"worldRegion,omitempty"`
+
+	// set in the host's game inventory
+	StartedOn time.Time `json:"startedOn,omitempty"`
+	Exited    bool      `json:"exited,omitempty"`
 }
 
 type UnregisterMachine struct {
@@ -65,8 +186,46 @@ type UpdateCharacter struct {
 	Snapshot   *model.Character `json:"snapshot"`
 }
 
+type CharacterHistory struct {
+	AdminKey string `json:"adminKey"`
+	Limit    int    `json:"limit"`
+}
+
+type RestoreCharacter struct {
+	AdminKey string `json:"adminKey"`
+	Revision int    `json:"revision"`
+}
+
+// JoinGame asks for the server of a game. With FriendId set the game is
+// the one that friend is playing in and GameId is ignored.
 type JoinGame struct {
 	GameId     int    `json:"gameId"`
+	FriendId   int    `json:"friendId,omitempty"`
+	SessionKey string `json:"sessionKey"`
+}
+
+// FriendAction names the other account by UserId, or by Username where
+// an account can be named before it's a friend.
+type FriendAction struct {
+	SessionKey string `json:"sessionKey"`
+	UserId     int    `json:"uid"`
+	Username   string `json:"username"`
+}
+
+// PartyAction names a party to accept an invite to, or an account to
+// invite or kick. Invites can name the account by Username.
+type PartyAction struct {
+	SessionKey string `json:"sessionKey"`
+	PartyId    int    `json:"partyId"`
+	UserId     int    `json:"uid"`
+	Username   string `json:"username"`
+}
+
+type GetParty struct {
+	SessionKey string `json:"sessionKey"`
+}
+
+type GetFriends struct {
 	SessionKey string `json:"sessionKey"`
 }
 
@@ -11,18 +11,38 @@ type NewCharacterResponse struct {
 	CharacterId int `json:"characterId"`
 }
 
+type UpdateCharacterResponse struct {
+	Revision int `json:"revision"`
+}
+
 type MachineRegisterResponse struct {
 	MachineId  int    `json:"machineId"`
 	MachineKey string `json:"machineKey"`
 }
 
+// AnnounceGamesResponse lists the announced games the master took over
+// and the ones it refused, because they ended or another host runs them.
+type AnnounceGamesResponse struct {
+	Adopted []int `json:"adopted"`
+	Refused []int `json:"refused"`
+}
+
+// HostGamesResponse is a host's inventory of the gameservers it launched,
+// including the ones that exited.
+type HostGamesResponse struct {
+	Games []AnnouncedGame `json:"games"`
+}
+
 type ServerInfoResponse struct {
 	RemoteAddress string `json:"remoteAddress"`
 	ListenPort    int    `json:"listenPort"`
 }
 
+// GetGamesResponse is one page of GET /games. The body only holds List,
+// NextCursor comes from the NextCursorHeader.
 type GetGamesResponse struct {
-	List []model.Game `json:"list"`
+	List       []model.Game
+	NextCursor string
 }
 
 type CreateNewGameResponse struct {
@@ -38,6 +58,22 @@ type JoinGameResponse struct {
 	ListenPort    int    `json:"listenPort"`
 }
 
+// PartyResponse carries the server of the game the party's leader joined
+// in Join, the same for every member, once that game is running.
+type PartyResponse struct {
+	Party model.Party       `json:"party"`
+	Join  *JoinGameResponse `json:"join,omitempty"`
+}
+
 type PlayerConnectResponse struct {
 	Character *model.Character `json:"character"`
 }
+
+type MatchResultResponse struct {
+	MatchId int `json:"matchId"`
+}
+
+type InventoryResponse struct {
+	Inventory []model.Item `json:"inventory"`
+	Version   int          `json:"inventoryVersion"`
+}
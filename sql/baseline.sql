@@ -5,9 +5,25 @@ CREATE TABLE "games" (
 	"game_mode" TEXT NOT NULL,
 	"minimum_level" INTEGER DEFAULT 0,
 	"player_count" INTEGER DEFAULT 0,
-	"maximum_players" INTEGER DEFAULT 16
+	"maximum_players" INTEGER DEFAULT 16,
+	"world_x" INTEGER,
+	"world_y" INTEGER,
+	"ended_on" TIMESTAMP
 );
 
+CREATE TABLE "map_catalog" (
+	"map_name" TEXT PRIMARY KEY,
+	"modes" JSON NOT NULL,
+	"default_players" INTEGER NOT NULL,
+	"maximum_players" INTEGER NOT NULL,
+	"minimum_level" INTEGER NOT NULL DEFAULT 0,
+	"gameserver_binary" TEXT NOT NULL
+);
+
+INSERT INTO map_catalog (map_name, modes, default_players, maximum_players, minimum_level, gameserver_binary) VALUES
+	('mp_sandbox', '["basic", "tutorial", "freeforall"]', 16, 64, 0, 'example-gameserver'),
+	('mp_openworld', '["basic", "freeforall"]', 16, 64, 0, 'example-gameserver');
+
 CREATE TABLE "account_data" (
 	"user_id" SERIAL PRIMARY KEY,
 	"username" TEXT NOT NULL,
@@ -18,19 +34,46 @@ CREATE TABLE "account_data" (
 	"lastlogin" TIMESTAMP NOT NULL
 );
 
+CREATE TABLE "friends" (
+	"user_id" INTEGER references account_data ON DELETE CASCADE,
+	"friend_id" INTEGER references account_data ON DELETE CASCADE,
+	"status" TEXT NOT NULL,
+	"created_on" TIMESTAMP NOT NULL,
+	PRIMARY KEY ("user_id", "friend_id")
+);
+
+CREATE INDEX ON "friends" ("friend_id");
+
 CREATE TABLE "characters" (
 	"id" SERIAL PRIMARY KEY,
 	"uid" INTEGER references account_data,
 	"name" TEXT,
 	"game_data" JSON,
-	"last_game_id" INTEGER DEFAULT 0
+	"last_game_id" INTEGER DEFAULT 0,
+	"revision" INTEGER NOT NULL DEFAULT 0,
+	"inventory" JSON,
+	"inventory_version" INTEGER NOT NULL DEFAULT 0
 );
 
+CREATE TABLE "character_history" (
+	"history_id" SERIAL PRIMARY KEY,
+	"character_id" INTEGER references characters(id) ON DELETE CASCADE,
+	"revision" INTEGER NOT NULL,
+	"last_game_id" INTEGER,
+	"game_data" JSON,
+	"source" TEXT NOT NULL,
+	"recorded_on" TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ON "character_history" ("character_id", "revision");
+
 
 CREATE TABLE "machines" (
 	"machine_id" SERIAL PRIMARY KEY,
 	"remote_address" TEXT,
-	"service_listen_port" INTEGER
+	"service_listen_port" INTEGER,
+	"region" TEXT NOT NULL DEFAULT '',
+	"profiles" JSON
 );
 
 CREATE TABLE "machines_metadata" (
@@ -51,7 +94,117 @@ CREATE TABLE "loading_hosts" (
 CREATE TABLE "hosts" (
 	"game_id" SERIAL PRIMARY KEY references games(game_id),
 	"machine_id" SERIAL references machines(machine_id) ON DELETE CASCADE,
-	"port" INTEGER
+	"port" INTEGER,
+	"kickoff_time" TIMESTAMP,
+	"registered_on" TIMESTAMP,
+	"reported_on" TIMESTAMP
+);
+
+CREATE TABLE "game_players" (
+	"character_id" INTEGER PRIMARY KEY references characters(id) ON DELETE CASCADE,
+	"game_id" INTEGER NOT NULL references games(game_id) ON DELETE CASCADE,
+	"joined_on" TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ON "game_players" ("game_id");
+
+CREATE TABLE "game_characters" (
+	"game_id" INTEGER NOT NULL references games(game_id) ON DELETE CASCADE,
+	"character_id" INTEGER NOT NULL references characters(id) ON DELETE CASCADE,
+	"xp_gained" INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY ("game_id", "character_id")
+);
+
+CREATE TABLE "matches" (
+	"match_id" SERIAL PRIMARY KEY,
+	"game_id" INTEGER NOT NULL references games(game_id),
+	"map_name" TEXT NOT NULL,
+	"game_mode" TEXT NOT NULL,
+	"started_on" TIMESTAMP NOT NULL,
+	"ended_on" TIMESTAMP NOT NULL,
+	"winning_team" INTEGER
+);
+
+CREATE TABLE "match_participants" (
+	"match_id" INTEGER references matches(match_id) ON DELETE CASCADE,
+	"character_id" INTEGER references characters(id) ON DELETE CASCADE,
+	"team" INTEGER NOT NULL,
+	"outcome" TEXT NOT NULL,
+	"stats" JSON,
+	PRIMARY KEY ("match_id", "character_id")
+);
+
+CREATE INDEX ON "match_participants" ("character_id");
+
+CREATE TABLE "game_reservations" (
+	"user_id" INTEGER PRIMARY KEY references account_data ON DELETE CASCADE,
+	"game_id" INTEGER NOT NULL,
+	"reserved_on" TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ON "game_reservations" ("game_id");
+
+CREATE TABLE "inventory_log" (
+	"change_id" SERIAL PRIMARY KEY,
+	"character_id" INTEGER references characters(id) ON DELETE CASCADE,
+	"action" TEXT NOT NULL,
+	"item_id" INTEGER,
+	"count" INTEGER,
+	"slot" INTEGER,
+	"to_slot" INTEGER,
+	"machine_id" INTEGER,
+	"game_id" INTEGER,
+	"trade_id" INTEGER,
+	"before" JSON,
+	"after" JSON,
+	"recorded_on" TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ON "inventory_log" ("character_id", "change_id");
+
+CREATE TABLE "trades" (
+	"trade_id" SERIAL PRIMARY KEY,
+	"from_character_id" INTEGER references characters(id) ON DELETE CASCADE,
+	"to_character_id" INTEGER references characters(id) ON DELETE CASCADE,
+	"offer" JSON NOT NULL,
+	"request" JSON NOT NULL,
+	"status" TEXT NOT NULL,
+	"created_on" TIMESTAMP NOT NULL,
+	"closed_on" TIMESTAMP
+);
+
+CREATE INDEX ON "trades" ("from_character_id", "trade_id");
+CREATE INDEX ON "trades" ("to_character_id", "trade_id");
+
+CREATE TABLE "worlds" (
+	"world_id" INTEGER PRIMARY KEY,
+	"seed" BIGINT NOT NULL,
+	"created_on" TIMESTAMP NOT NULL
+);
+
+CREATE TABLE "world_regions" (
+	"x" INTEGER NOT NULL,
+	"y" INTEGER NOT NULL,
+	"spiral_index" INTEGER NOT NULL,
+	"region" JSON NOT NULL,
+	"created_on" TIMESTAMP NOT NULL,
+	PRIMARY KEY ("x", "y")
+);
+
+CREATE UNIQUE INDEX ON "world_regions" ("spiral_index");
+
+CREATE TABLE "world_site_log" (
+	"event_id" SERIAL PRIMARY KEY,
+	"match_id" INTEGER references matches(match_id) ON DELETE CASCADE,
+	"x" INTEGER NOT NULL,
+	"y" INTEGER NOT NULL,
+	"town" INTEGER NOT NULL,
+	"outpost" INTEGER NOT NULL,
+	"faction" INTEGER NOT NULL,
+	"owner" INTEGER NOT NULL,
+	"score" INTEGER NOT NULL,
+	"flipped" BOOLEAN NOT NULL,
+	"recorded_on" TIMESTAMP NOT NULL
 );
 
 CREATE FUNCTION get_available_machine()
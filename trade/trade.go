@@ -0,0 +1,382 @@
+// Package trade moves items between the inventories of two characters.
+// A proposal takes the offered items out of the proposer's inventory into
+// escrow, accepting swaps the escrow with the requested items, and
+// cancelling returns the escrow.
+//
+// Every step runs in one transaction of a Store. A Store locks rows the
+// way Postgres does with SELECT ... FOR UPDATE: a locked row is held until
+// the transaction ends and other transactions wait for it. Steps lock the
+// trade before characters, and characters in id order, so concurrent
+// trades on the same inventories serialize instead of deadlocking.
+package trade
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/inventory"
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+var ErrTradeNotExist = errors.New("trade: trade does not exist")
+var ErrNotPending = errors.New("trade: trade is no longer pending")
+var ErrNotParty = errors.New("trade: character is not part of the trade")
+var ErrSameCharacter = errors.New("trade: can't trade with yourself")
+var ErrEmpty = errors.New("trade: nothing to trade")
+var ErrNotTradable = errors.New("trade: item can't be traded")
+var ErrOffline = errors.New("trade: both characters must be online")
+
+// inventory log actions of trades
+const (
+	ActionEscrow = "trade_escrow"
+	ActionSwap   = "trade"
+	ActionReturn = "trade_return"
+)
+
+// Holder is the locked inventory of a character.
+type Holder struct {
+	CharacterId int
+	ClassId     int
+	Online      bool
+	Inventory   []model.Item
+}
+
+type Store interface {
+	Begin() (Tx, error)
+}
+
+type Tx interface {
+	// Holders locks the characters in id order and returns them by id.
+	Holders(characterIds ...int) (map[int]*Holder, error)
+
+	// Trade locks a trade, ErrTradeNotExist if there is none.
+	Trade(tradeId int) (*model.Trade, error)
+
+	CreateTrade(trade *model.Trade) (int, error)
+	UpdateTrade(trade *model.Trade) error
+
+	// SetInventory stores holder.Inventory and logs the change from before.
+	SetInventory(holder *Holder, before []model.Item, action string, tradeId int) error
+
+	Commit() error
+	Rollback() error
+}
+
+type Service struct {
+	Catalog *inventory.Catalog
+	Store   Store
+}
+
+// Propose offers items from one character to another in exchange for the
+// requested items. The offered items are moved into escrow.
+func (s *Service) Propose(fromId int, toId int, offer []model.Item, request []model.Item) (*model.Trade, error) {
+
+	if fromId == toId {
+		return nil, ErrSameCharacter
+	}
+
+	offer, err := s.normalize(offer)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err = s.normalize(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(offer) == 0 && len(request) == 0 {
+		return nil, ErrEmpty
+	}
+
+	tx, err := s.Store.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	trade, err := s.propose(tx, fromId, toId, offer, request)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return trade, nil
+}
+
+func (s *Service) propose(tx Tx, fromId int, toId int, offer []model.Item, request []model.Item) (*model.Trade, error) {
+
+	holders, err := tx.Holders(fromId, toId)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := holders[fromId], holders[toId]
+	if !from.Online || !to.Online {
+		return nil, ErrOffline
+	}
+
+	// fail early on items the other side could never hold
+	err = s.checkClasses(offer, to.ClassId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkClasses(request, from.ClassId)
+	if err != nil {
+		return nil, err
+	}
+
+	before := from.Inventory
+	for _, item := range offer {
+		from.Inventory, err = s.Catalog.Consume(from.Inventory, item.ItemId, item.Stacks)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	trade := &model.Trade{
+		FromCharacterId: fromId,
+		ToCharacterId:   toId,
+		Offer:           offer,
+		Request:         request,
+		Status:          model.TradePending,
+		CreatedOn:       time.Now()}
+
+	trade.TradeId, err = tx.CreateTrade(trade)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(offer) > 0 {
+		err = tx.SetInventory(from, before, ActionEscrow, trade.TradeId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return trade, nil
+}
+
+// Accept completes a pending trade for its recipient. The requested items
+// leave the recipient's inventory and the escrow enters it.
+func (s *Service) Accept(tradeId int, characterId int) (*model.Trade, error) {
+
+	tx, err := s.Store.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	trade, err := s.accept(tx, tradeId, characterId)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return trade, nil
+}
+
+func (s *Service) accept(tx Tx, tradeId int, characterId int) (*model.Trade, error) {
+
+	trade, err := tx.Trade(tradeId)
+	if err != nil {
+		return nil, err
+	}
+
+	if trade.ToCharacterId != characterId {
+		return nil, ErrNotParty
+	}
+
+	if trade.Status != model.TradePending {
+		return nil, ErrNotPending
+	}
+
+	holders, err := tx.Holders(trade.FromCharacterId, trade.ToCharacterId)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := holders[trade.FromCharacterId], holders[trade.ToCharacterId]
+	if !from.Online || !to.Online {
+		return nil, ErrOffline
+	}
+
+	fromBefore, toBefore := from.Inventory, to.Inventory
+
+	for _, item := range trade.Request {
+		to.Inventory, err = s.Catalog.Consume(to.Inventory, item.ItemId, item.Stacks)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, item := range trade.Offer {
+		to.Inventory, err = s.Catalog.Grant(to.Inventory, to.ClassId, item.ItemId, item.Stacks)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, item := range trade.Request {
+		from.Inventory, err = s.Catalog.Grant(from.Inventory, from.ClassId, item.ItemId, item.Stacks)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(trade.Request) > 0 {
+		err = tx.SetInventory(from, fromBefore, ActionSwap, trade.TradeId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.SetInventory(to, toBefore, ActionSwap, trade.TradeId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.close(tx, trade, model.TradeAccepted)
+}
+
+// Cancel withdraws or declines a pending trade and returns the escrow to
+// the proposer. Either character can cancel, online or not.
+func (s *Service) Cancel(tradeId int, characterId int) (*model.Trade, error) {
+
+	tx, err := s.Store.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	trade, err := s.cancel(tx, tradeId, characterId)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return trade, nil
+}
+
+func (s *Service) cancel(tx Tx, tradeId int, characterId int) (*model.Trade, error) {
+
+	trade, err := tx.Trade(tradeId)
+	if err != nil {
+		return nil, err
+	}
+
+	if trade.FromCharacterId != characterId && trade.ToCharacterId != characterId {
+		return nil, ErrNotParty
+	}
+
+	if trade.Status != model.TradePending {
+		return nil, ErrNotPending
+	}
+
+	if len(trade.Offer) > 0 {
+
+		holders, err := tx.Holders(trade.FromCharacterId)
+		if err != nil {
+			return nil, err
+		}
+
+		from := holders[trade.FromCharacterId]
+		before := from.Inventory
+		for _, item := range trade.Offer {
+			from.Inventory = s.Catalog.Return(from.Inventory, item.ItemId, item.Stacks)
+		}
+
+		err = tx.SetInventory(from, before, ActionReturn, trade.TradeId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.close(tx, trade, model.TradeCancelled)
+}
+
+func (s *Service) close(tx Tx, trade *model.Trade, status string) (*model.Trade, error) {
+
+	now := time.Now()
+	trade.Status = status
+	trade.ClosedOn = &now
+
+	err := tx.UpdateTrade(trade)
+	if err != nil {
+		return nil, err
+	}
+
+	return trade, nil
+}
+
+// normalize merges entries of the same item and checks they can be traded.
+func (s *Service) normalize(items []model.Item) ([]model.Item, error) {
+
+	counts := make(map[int]int)
+	for _, item := range items {
+
+		if item.Stacks <= 0 {
+			return nil, inventory.ErrBadCount
+		}
+
+		def, ok := s.Catalog.Item(item.ItemId)
+		if !ok {
+			return nil, inventory.ErrUnknownItem
+		}
+
+		if !def.Tradable {
+			return nil, ErrNotTradable
+		}
+
+		counts[item.ItemId] += item.Stacks
+	}
+
+	result := make([]model.Item, 0, len(counts))
+	for itemId, count := range counts {
+		result = append(result, model.Item{ItemId: itemId, Stacks: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ItemId < result[j].ItemId })
+	return result, nil
+}
+
+func (s *Service) checkClasses(items []model.Item, classId int) error {
+
+	for _, item := range items {
+		def, _ := s.Catalog.Item(item.ItemId)
+		if !def.Allowed(classId) {
+			return inventory.ErrClassRestricted
+		}
+	}
+	return nil
+}
+
+// SortedIds returns character ids in the order they have to be locked.
+func SortedIds(characterIds ...int) []int {
+
+	ids := make([]int, 0, len(characterIds))
+	seen := make(map[int]bool)
+	for _, id := range characterIds {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Ints(ids)
+	return ids
+}
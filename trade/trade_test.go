@@ -0,0 +1,392 @@
+package trade
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jaybennett89/thorium-go/inventory"
+	"github.com/jaybennett89/thorium-go/model"
+)
+
+var errNoCharacter = errors.New("character does not exist")
+
+// memStore is a Store with row locks like Postgres: a transaction holds
+// the lock of every character and trade it read until it ends.
+type memStore struct {
+	mu         sync.Mutex
+	characters map[int]*Holder
+	trades     map[int]*model.Trade
+	rowLocks   map[string]*sync.Mutex
+	nextTrade  int
+}
+
+func newMemStore(holders ...Holder) *memStore {
+
+	s := &memStore{
+		characters: make(map[int]*Holder),
+		trades:     make(map[int]*model.Trade),
+		rowLocks:   make(map[string]*sync.Mutex)}
+
+	for i := range holders {
+		h := holders[i]
+		s.characters[h.CharacterId] = &h
+	}
+	return s
+}
+
+func (s *memStore) lock(key string) *sync.Mutex {
+
+	s.mu.Lock()
+	l, ok := s.rowLocks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		s.rowLocks[key] = l
+	}
+	s.mu.Unlock()
+
+	l.Lock()
+	return l
+}
+
+func (s *memStore) Begin() (Tx, error) {
+	return &memTx{store: s, locked: make(map[string]*sync.Mutex), holders: make(map[int]*Holder)}, nil
+}
+
+type memTx struct {
+	store   *memStore
+	locked  map[string]*sync.Mutex
+	holders map[int]*Holder
+	trades  []*model.Trade
+	created []*model.Trade
+}
+
+func (tx *memTx) lockRow(key string) {
+
+	if _, ok := tx.locked[key]; !ok {
+		tx.locked[key] = tx.store.lock(key)
+	}
+}
+
+func (tx *memTx) Holders(characterIds ...int) (map[int]*Holder, error) {
+
+	result := make(map[int]*Holder)
+	for _, id := range SortedIds(characterIds...) {
+
+		tx.lockRow(fmt.Sprintf("character/%d", id))
+
+		tx.store.mu.Lock()
+		stored, ok := tx.store.characters[id]
+		tx.store.mu.Unlock()
+		if !ok {
+			return nil, errNoCharacter
+		}
+
+		working := *stored
+		working.Inventory = inventory.Copy(stored.Inventory)
+		tx.holders[id] = &working
+		result[id] = &working
+	}
+	return result, nil
+}
+
+func (tx *memTx) Trade(tradeId int) (*model.Trade, error) {
+
+	tx.lockRow(fmt.Sprintf("trade/%d", tradeId))
+
+	tx.store.mu.Lock()
+	stored, ok := tx.store.trades[tradeId]
+	tx.store.mu.Unlock()
+	if !ok {
+		return nil, ErrTradeNotExist
+	}
+
+	working := *stored
+	return &working, nil
+}
+
+func (tx *memTx) CreateTrade(trade *model.Trade) (int, error) {
+
+	tx.store.mu.Lock()
+	tx.store.nextTrade++
+	id := tx.store.nextTrade
+	tx.store.mu.Unlock()
+
+	tx.created = append(tx.created, trade)
+	return id, nil
+}
+
+func (tx *memTx) UpdateTrade(trade *model.Trade) error {
+
+	tx.trades = append(tx.trades, trade)
+	return nil
+}
+
+func (tx *memTx) SetInventory(holder *Holder, before []model.Item, action string, tradeId int) error {
+	return nil
+}
+
+func (tx *memTx) Commit() error {
+
+	tx.store.mu.Lock()
+	for id, holder := range tx.holders {
+		tx.store.characters[id] = holder
+	}
+	for _, trade := range append(tx.created, tx.trades...) {
+		tx.store.trades[trade.TradeId] = trade
+	}
+	tx.store.mu.Unlock()
+
+	return tx.Rollback()
+}
+
+func (tx *memTx) Rollback() error {
+
+	for _, l := range tx.locked {
+		l.Unlock()
+	}
+	tx.locked = nil
+	return nil
+}
+
+func (s *memStore) count(characterId int, itemId int) int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return inventory.Count(s.characters[characterId].Inventory, itemId)
+}
+
+// total counts an item across inventories and pending escrow
+func (s *memStore) total(itemId int) int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for _, h := range s.characters {
+		total += inventory.Count(h.Inventory, itemId)
+	}
+	for _, t := range s.trades {
+		if t.Status == model.TradePending {
+			total += inventory.Count(t.Offer, itemId)
+		}
+	}
+	return total
+}
+
+func newService(t *testing.T, holders ...Holder) (*Service, *memStore) {
+
+	catalog, err := inventory.LoadFile("../data/items.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newMemStore(holders...)
+	return &Service{Catalog: catalog, Store: store}, store
+}
+
+const ore = 5
+const potion = 1
+
+func online(characterId int, items ...model.Item) Holder {
+	return Holder{CharacterId: characterId, ClassId: 1, Online: true, Inventory: items}
+}
+
+// parallel runs n calls at once and returns how many succeeded
+func parallel(t *testing.T, n int, call func(i int) error) int {
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			if call(i) == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	close(start)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("trades deadlocked")
+	}
+
+	return succeeded
+}
+
+func TestTrade_AcceptSwaps(t *testing.T) {
+
+	s, store := newService(t, online(1, model.Item{ItemId: ore, Stacks: 10}), online(2, model.Item{ItemId: potion, Stacks: 3}))
+
+	trade, err := s.Propose(1, 2, []model.Item{{ItemId: ore, Stacks: 4}, {ItemId: ore, Stacks: 2}}, []model.Item{{ItemId: potion, Stacks: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if store.count(1, ore) != 4 || len(trade.Offer) != 1 || trade.Offer[0].Stacks != 6 {
+		t.Fatalf("escrow not taken: %d ore left, offer %v", store.count(1, ore), trade.Offer)
+	}
+
+	if _, err = s.Accept(trade.TradeId, 1); err != ErrNotParty {
+		t.Fatalf("proposer accepted own trade: %v", err)
+	}
+
+	_, err = s.Accept(trade.TradeId, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if store.count(1, ore) != 4 || store.count(1, potion) != 3 || store.count(2, ore) != 6 || store.count(2, potion) != 0 {
+		t.Fatal("items not swapped")
+	}
+}
+
+func TestTrade_Rejects(t *testing.T) {
+
+	offline := online(3)
+	offline.Online = false
+
+	s, _ := newService(t, online(1, model.Item{ItemId: 6, Stacks: 1}, model.Item{ItemId: 3, Stacks: 1}), online(2), offline)
+
+	cases := []struct {
+		to    int
+		offer []model.Item
+		err   error
+	}{
+		{1, []model.Item{{ItemId: ore, Stacks: 1}}, ErrSameCharacter},
+		{2, nil, ErrEmpty},
+		{2, []model.Item{{ItemId: 6, Stacks: 1}}, ErrNotTradable},
+		{2, []model.Item{{ItemId: 3, Stacks: 1}}, inventory.ErrClassRestricted},
+		{2, []model.Item{{ItemId: ore, Stacks: 1}}, inventory.ErrNotEnough},
+		{3, []model.Item{{ItemId: 3, Stacks: 1}}, ErrOffline},
+	}
+
+	for _, c := range cases {
+		if _, err := s.Propose(1, c.to, c.offer, nil); err != c.err {
+			t.Errorf("offer %v to %d: got %v, want %v", c.offer, c.to, err, c.err)
+		}
+	}
+}
+
+func TestTrade_ParallelEscrowOfSameStack(t *testing.T) {
+
+	s, store := newService(t, online(1, model.Item{ItemId: ore, Stacks: 10}), online(2))
+
+	// ten proposals of 3 ore each, only three fit into the stack
+	succeeded := parallel(t, 10, func(i int) error {
+		_, err := s.Propose(1, 2, []model.Item{{ItemId: ore, Stacks: 3}}, nil)
+		if err != nil && err != inventory.ErrNotEnough {
+			t.Error(err)
+		}
+		return err
+	})
+
+	if succeeded != 3 || store.count(1, ore) != 1 || store.total(ore) != 10 {
+		t.Fatalf("%d proposals succeeded, %d ore left, %d in total", succeeded, store.count(1, ore), store.total(ore))
+	}
+}
+
+func TestTrade_ParallelAcceptAndCancel(t *testing.T) {
+
+	for round := 0; round < 20; round++ {
+
+		s, store := newService(t, online(1, model.Item{ItemId: ore, Stacks: 5}), online(2, model.Item{ItemId: potion, Stacks: 5}))
+
+		trade, err := s.Propose(1, 2, []model.Item{{ItemId: ore, Stacks: 5}}, []model.Item{{ItemId: potion, Stacks: 5}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// both parties cancel while the recipient accepts twice
+		succeeded := parallel(t, 4, func(i int) error {
+			var err error
+			switch i {
+			case 0, 1:
+				_, err = s.Accept(trade.TradeId, 2)
+			case 2:
+				_, err = s.Cancel(trade.TradeId, 1)
+			case 3:
+				_, err = s.Cancel(trade.TradeId, 2)
+			}
+			if err != nil && err != ErrNotPending {
+				t.Error(err)
+			}
+			return err
+		})
+
+		if succeeded != 1 {
+			t.Fatalf("%d of accept and cancel succeeded", succeeded)
+		}
+
+		accepted := store.count(2, ore) == 5 && store.count(1, potion) == 5
+		cancelled := store.count(1, ore) == 5 && store.count(2, potion) == 5
+		if accepted == cancelled || store.total(ore) != 5 || store.total(potion) != 5 {
+			t.Fatal("trade applied partially or twice")
+		}
+	}
+}
+
+func TestTrade_ParallelCrossTrades(t *testing.T) {
+
+	holders := make([]Holder, 0)
+	for id := 1; id <= 4; id++ {
+		holders = append(holders, online(id, model.Item{ItemId: ore, Stacks: 20}, model.Item{ItemId: potion, Stacks: 20}))
+	}
+	s, store := newService(t, holders...)
+
+	// every pair trades in both directions so accepts lock the same rows in
+	// opposite party order
+	trades := make([]*model.Trade, 0)
+	for from := 1; from <= 4; from++ {
+		for to := 1; to <= 4; to++ {
+			if from == to {
+				continue
+			}
+			trade, err := s.Propose(from, to, []model.Item{{ItemId: ore, Stacks: 2}}, []model.Item{{ItemId: potion, Stacks: 3}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			trades = append(trades, trade)
+		}
+	}
+
+	parallel(t, len(trades), func(i int) error {
+		var err error
+		if i%3 == 0 {
+			_, err = s.Cancel(trades[i].TradeId, trades[i].FromCharacterId)
+		} else {
+			_, err = s.Accept(trades[i].TradeId, trades[i].ToCharacterId)
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		return err
+	})
+
+	if store.total(ore) != 80 || store.total(potion) != 80 {
+		t.Fatalf("items not conserved: %d ore, %d potions", store.total(ore), store.total(potion))
+	}
+
+	for id := 1; id <= 4; id++ {
+		if store.count(id, ore) < 0 || store.count(id, potion) < 0 {
+			t.Fatalf("character %d went negative", id)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package world keeps the state of the open world: which faction holds
+// each fortress, town and outpost of a region, and how strongly.
+//
+// A site's FactionScore is the strength of its owner's hold. Matches won
+// at a site add points for the winning faction; points against the owner
+// wear its score down, and once it would drop below zero the site flips
+// to the winner, which keeps the remainder. Neutral sites flip to the
+// first faction that wins there.
+package world
+
+import (
+	"errors"
+
+	"github.com/jaybennett89/thorium-go/generate"
+)
+
+// OpenWorldMap is the map of games that host a region.
+const OpenWorldMap = "mp_openworld"
+
+var ErrNoSite = errors.New("world: region has no such site")
+var ErrNoFaction = errors.New("world: team has no faction")
+
+// quest tiers unlocked by a site's score
+const (
+	QuestNone         = "none"
+	QuestBasic        = "basic"
+	QuestIntermediate = "intermediate"
+	QuestAdvanced     = "advanced"
+)
+
+// Site names a fortress, town or outpost of the region at X, Y. Town and
+// Outpost count from 1; without a town the site is the fortress, without
+// an outpost it's the town.
+type Site struct {
+	X       int `json:"x"`
+	Y       int `json:"y"`
+	Town    int `json:"town,omitempty"`
+	Outpost int `json:"outpost,omitempty"`
+}
+
+// Rules sets how many points a won match is worth at each kind of site.
+// Outposts change hands quickly, fortresses slowly.
+type Rules struct {
+	FortressPoints int
+	TownPoints     int
+	OutpostPoints  int
+	MaxScore       int
+}
+
+var DefaultRules = Rules{
+	FortressPoints: 25,
+	TownPoints:     50,
+	OutpostPoints:  100,
+	MaxScore:       2000,
+}
+
+// SiteState is the ownership of a site.
+type SiteState struct {
+	Site
+	Owner     int    `json:"owner"`
+	Score     int    `json:"score"`
+	QuestTier string `json:"questTier"`
+	Flipped   bool   `json:"flipped,omitempty"`
+}
+
+// RegionOwnership is a region's sites as shown on the world map.
+type RegionOwnership struct {
+	Index    int                   `json:"index"`
+	Location generate.Coordinate2D `json:"location"`
+	Owner    int                   `json:"owner"`
+	Sites    []SiteState           `json:"sites"`
+}
+
+// FactionForTeam maps the teams of a match to factions.
+func FactionForTeam(team int) int {
+
+	switch team {
+	case 1:
+		return generate.Red
+	case 2:
+		return generate.Blue
+	}
+	return 0
+}
+
+// QuestTier is the tier of quests a site's score unlocks: basic from 1,
+// intermediate from 200 and advanced from 1000.
+func QuestTier(score int) string {
+
+	switch {
+	case score >= 1000:
+		return QuestAdvanced
+	case score >= 200:
+		return QuestIntermediate
+	case score >= 1:
+		return QuestBasic
+	}
+	return QuestNone
+}
+
+// Apply scores a match won by faction at a site of the region and returns
+// the site's new state.
+func (r *Rules) Apply(region *generate.Region, site Site, faction int) (*SiteState, error) {
+
+	if faction != generate.Red && faction != generate.Blue {
+		return nil, ErrNoFaction
+	}
+
+	owner, score, points, err := r.locate(region, site)
+	if err != nil {
+		return nil, err
+	}
+
+	flipped := false
+	if *owner == faction {
+		*score += points
+	} else {
+		*score -= points
+		if *score < 0 {
+			*owner = faction
+			*score = -*score
+			flipped = true
+		}
+	}
+
+	if *score > r.MaxScore {
+		*score = r.MaxScore
+	}
+
+	return &SiteState{Site: site, Owner: *owner, Score: *score, QuestTier: QuestTier(*score), Flipped: flipped}, nil
+}
+
+func (r *Rules) locate(region *generate.Region, site Site) (*int, *int, int, error) {
+
+	fortress := region.Fortress
+	if fortress == nil {
+		return nil, nil, 0, ErrNoSite
+	}
+
+	if site.Town == 0 {
+		if site.Outpost != 0 {
+			return nil, nil, 0, ErrNoSite
+		}
+		return &fortress.Owner, &fortress.FactionScore, r.FortressPoints, nil
+	}
+
+	if site.Town < 1 || site.Town > len(fortress.Towns) {
+		return nil, nil, 0, ErrNoSite
+	}
+
+	town := &fortress.Towns[site.Town-1]
+	if site.Outpost == 0 {
+		return &town.Owner, &town.FactionScore, r.TownPoints, nil
+	}
+
+	if site.Outpost < 1 || site.Outpost > len(town.Outposts) {
+		return nil, nil, 0, ErrNoSite
+	}
+
+	outpost := &town.Outposts[site.Outpost-1]
+	return &outpost.Owner, &outpost.FactionScore, r.OutpostPoints, nil
+}
+
+// Ownership lists every site of the region. The region's owner is the
+// owner of its fortress.
+func Ownership(region *generate.Region) RegionOwnership {
+
+	result := RegionOwnership{
+		Index:    region.Index,
+		Location: region.Location,
+		Sites:    make([]SiteState, 0)}
+
+	if region.Fortress == nil {
+		return result
+	}
+
+	x, y := region.Location.X, region.Location.Y
+	fortress := region.Fortress
+	result.Owner = fortress.Owner
+	result.Sites = append(result.Sites, siteState(Site{X: x, Y: y}, fortress.Owner, fortress.FactionScore))
+
+	for i, town := range fortress.Towns {
+		result.Sites = append(result.Sites, siteState(Site{X: x, Y: y, Town: i + 1}, town.Owner, town.FactionScore))
+		for j, outpost := range town.Outposts {
+			result.Sites = append(result.Sites, siteState(Site{X: x, Y: y, Town: i + 1, Outpost: j + 1}, outpost.Owner, outpost.FactionScore))
+		}
+	}
+
+	return result
+}
+
+func siteState(site Site, owner int, score int) SiteState {
+	return SiteState{Site: site, Owner: owner, Score: score, QuestTier: QuestTier(score)}
+}
@@ -0,0 +1,105 @@
+package world
+
+import (
+	"testing"
+
+	"github.com/jaybennett89/thorium-go/generate"
+)
+
+func testRegion() *generate.Region {
+	return generate.GenerateRegion(5, generate.Coordinate2D{X: 1, Y: 0}, &generate.DefaultConfig)
+}
+
+func TestApply_FlipsAtZero(t *testing.T) {
+
+	region := testRegion()
+	rules := Rules{FortressPoints: 10, TownPoints: 20, OutpostPoints: 150, MaxScore: 300}
+	outpost := Site{X: 1, Y: 0, Town: 1, Outpost: 1}
+
+	state, err := rules.Apply(region, outpost, generate.Red)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Flipped || state.Owner != generate.Red || state.Score != 150 || state.QuestTier != QuestBasic {
+		t.Fatalf("neutral outpost not taken: %+v", state)
+	}
+
+	state, _ = rules.Apply(region, outpost, generate.Red)
+	if state.Flipped || state.Score != 300 || state.QuestTier != QuestIntermediate {
+		t.Fatalf("owner not strengthened: %+v", state)
+	}
+
+	state, _ = rules.Apply(region, outpost, generate.Red)
+	if state.Score != 300 {
+		t.Fatalf("score above max: %+v", state)
+	}
+
+	state, _ = rules.Apply(region, outpost, generate.Blue)
+	state, _ = rules.Apply(region, outpost, generate.Blue)
+	if state.Flipped || state.Owner != generate.Red || state.Score != 0 {
+		t.Fatalf("hold not worn down to zero: %+v", state)
+	}
+
+	state, _ = rules.Apply(region, outpost, generate.Blue)
+	if !state.Flipped || state.Owner != generate.Blue || state.Score != 150 {
+		t.Fatalf("outpost did not flip: %+v", state)
+	}
+
+	if region.Fortress.Towns[0].Outposts[0].Owner != generate.Blue {
+		t.Fatal("region not updated")
+	}
+}
+
+func TestApply_Sites(t *testing.T) {
+
+	region := testRegion()
+	towns := len(region.Fortress.Towns)
+
+	cases := []struct {
+		site Site
+		err  error
+	}{
+		{Site{}, nil},
+		{Site{Town: towns}, nil},
+		{Site{Town: towns + 1}, ErrNoSite},
+		{Site{Outpost: 1}, ErrNoSite},
+		{Site{Town: 1, Outpost: 99}, ErrNoSite},
+	}
+
+	for _, c := range cases {
+		if _, err := DefaultRules.Apply(region, c.site, generate.Blue); err != c.err {
+			t.Errorf("site %+v: got %v, want %v", c.site, err, c.err)
+		}
+	}
+
+	if _, err := DefaultRules.Apply(region, Site{}, 0); err != ErrNoFaction {
+		t.Errorf("applied without a faction: %v", err)
+	}
+}
+
+func TestQuestTier(t *testing.T) {
+
+	tiers := map[int]string{0: QuestNone, 1: QuestBasic, 199: QuestBasic, 200: QuestIntermediate, 999: QuestIntermediate, 1000: QuestAdvanced}
+	for score, tier := range tiers {
+		if QuestTier(score) != tier {
+			t.Errorf("score %d: got %s, want %s", score, QuestTier(score), tier)
+		}
+	}
+}
+
+func TestOwnership(t *testing.T) {
+
+	region := testRegion()
+	DefaultRules.Apply(region, Site{X: 1}, generate.Red)
+
+	ownership := Ownership(region)
+
+	sites := 1
+	for _, town := range region.Fortress.Towns {
+		sites += 1 + len(town.Outposts)
+	}
+
+	if ownership.Owner != generate.Red || len(ownership.Sites) != sites || ownership.Sites[0].Score != DefaultRules.FortressPoints {
+		t.Fatalf("unexpected ownership %+v", ownership)
+	}
+}